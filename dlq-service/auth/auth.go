@@ -0,0 +1,76 @@
+// Package auth carries the permissions of the API callers.
+package auth
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Permission is what an API caller is allowed to do on top of reading and replaying the messages.
+type Permission string
+
+// The permissions of the API callers.
+const (
+	// PermissionDecrypt lets the caller read the encrypted payloads and header values in plain.
+	PermissionDecrypt Permission = "decrypt"
+	// PermissionReveal lets the caller read the payloads and header values without their redaction.
+	PermissionReveal Permission = "reveal"
+)
+
+// APIKeys is the permissions of the API keys.
+type APIKeys map[string][]Permission
+
+// ParseAPIKeys parses the comma separated API keys, the permissions of a key follow it after a colon and are separated by a plus,
+// e.g. `3f2b9c:decrypt+reveal,7a1d4e`.
+func ParseAPIKeys(value string) (keys APIKeys, err error) {
+	keys = make(APIKeys)
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		key, permissions := entry, ""
+		if i := strings.Index(entry, ":"); i >= 0 {
+			key, permissions = entry[:i], entry[i+1:]
+		}
+		if key == "" {
+			err = fmt.Errorf("auth: API key of %q is empty", entry)
+			return
+		}
+
+		keys[key] = []Permission{}
+		for _, permission := range strings.Split(permissions, "+") {
+			switch Permission(permission) {
+			case "":
+			case PermissionDecrypt, PermissionReveal:
+				keys[key] = append(keys[key], Permission(permission))
+			default:
+				err = fmt.Errorf("auth: unknown permission %q", permission)
+				return
+			}
+		}
+	}
+
+	return
+}
+
+type permissionsKey struct{}
+
+// WithPermissions returns the context of the caller with the permissions.
+func WithPermissions(ctx context.Context, permissions []Permission) context.Context {
+	return context.WithValue(ctx, permissionsKey{}, permissions)
+}
+
+// HasPermission reports whether the caller of the context has the permission, the context without a caller has none.
+func HasPermission(ctx context.Context, permission Permission) bool {
+	permissions, _ := ctx.Value(permissionsKey{}).([]Permission)
+	for _, p := range permissions {
+		if p == permission {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,34 @@
+package auth_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/auth"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseAPIKeys(t *testing.T) {
+	keys, err := auth.ParseAPIKeys(" 3f2b9c:decrypt+reveal, 7a1d4e ,")
+	assert.NoError(t, err)
+	assert.Equal(t, auth.APIKeys{
+		"3f2b9c": {auth.PermissionDecrypt, auth.PermissionReveal},
+		"7a1d4e": {},
+	}, keys)
+
+	keys, err = auth.ParseAPIKeys("")
+	assert.NoError(t, err)
+	assert.Empty(t, keys)
+
+	_, err = auth.ParseAPIKeys("3f2b9c:delete")
+	assert.Error(t, err)
+	_, err = auth.ParseAPIKeys(":decrypt")
+	assert.Error(t, err)
+}
+
+func TestHasPermission(t *testing.T) {
+	ctx := context.TODO()
+	assert.False(t, auth.HasPermission(ctx, auth.PermissionDecrypt))
+	assert.False(t, auth.HasPermission(auth.WithPermissions(ctx, []auth.Permission{}), auth.PermissionDecrypt))
+	assert.True(t, auth.HasPermission(auth.WithPermissions(ctx, []auth.Permission{auth.PermissionDecrypt}), auth.PermissionDecrypt))
+}
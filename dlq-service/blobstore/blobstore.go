@@ -0,0 +1,21 @@
+// Package blobstore stores the message payloads that are too large to be kept in the database.
+package blobstore
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrNotFound is returned when the blob of the key does not exist.
+var ErrNotFound = errors.New("blobstore: blob is not found")
+
+// ErrInvalidKey is returned when the key is empty or escapes the store.
+var ErrInvalidKey = errors.New("blobstore: invalid key")
+
+// Store is a collection of behavior of a blob store, it follows the object operations of the S3 API
+// so that an S3-compatible store can be plugged in with the slash separated keys as the object keys.
+type Store interface {
+	Put(ctx context.Context, key string, data []byte) (err error)
+	Get(ctx context.Context, key string) (data []byte, err error)
+	Delete(ctx context.Context, key string) (err error)
+}
@@ -0,0 +1,95 @@
+package blobstore
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+type fileStore struct {
+	dir string
+}
+
+// NewFileStore returns a Store that keeps the blobs as the files under the directory, the slash separated keys are its sub-paths.
+func NewFileStore(dir string) Store {
+	return &fileStore{
+		dir: dir,
+	}
+}
+
+// Put writes the blob to a temporary file first, so that the blob is either complete or missing.
+func (s *fileStore) Put(ctx context.Context, key string, data []byte) (err error) {
+	name, err := s.path(key)
+	if err != nil {
+		return
+	}
+
+	if err = os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return
+	}
+
+	file, err := ioutil.TempFile(filepath.Dir(name), ".blob-*")
+	if err != nil {
+		return
+	}
+	defer os.Remove(file.Name())
+
+	if _, err = file.Write(data); err != nil {
+		file.Close()
+		return
+	}
+	if err = file.Sync(); err != nil {
+		file.Close()
+		return
+	}
+	if err = file.Close(); err != nil {
+		return
+	}
+
+	err = os.Rename(file.Name(), name)
+
+	return
+}
+
+func (s *fileStore) Get(ctx context.Context, key string) (data []byte, err error) {
+	name, err := s.path(key)
+	if err != nil {
+		return
+	}
+
+	data, err = ioutil.ReadFile(name)
+	if os.IsNotExist(err) {
+		err = ErrNotFound
+	}
+
+	return
+}
+
+func (s *fileStore) Delete(ctx context.Context, key string) (err error) {
+	name, err := s.path(key)
+	if err != nil {
+		return
+	}
+
+	err = os.Remove(name)
+	if os.IsNotExist(err) {
+		err = nil
+	}
+
+	return
+}
+
+func (s *fileStore) path(key string) (name string, err error) {
+	cleaned := path.Clean("/" + key)
+	if key == "" || cleaned != "/"+key || strings.HasSuffix(key, "/") {
+		err = ErrInvalidKey
+		return
+	}
+
+	name = filepath.Join(s.dir, filepath.FromSlash(strings.TrimPrefix(cleaned, "/")))
+
+	return
+}
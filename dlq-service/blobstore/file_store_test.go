@@ -0,0 +1,36 @@
+package blobstore_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/blobstore"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileStore(t *testing.T) {
+	ctx := context.TODO()
+	store := blobstore.NewFileStore(t.TempDir())
+
+	assert.NoError(t, store.Put(ctx, "dlq-message/1", []byte("payload")))
+	assert.NoError(t, store.Put(ctx, "dlq-message/1", []byte("overwritten payload")))
+
+	data, err := store.Get(ctx, "dlq-message/1")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("overwritten payload"), data)
+
+	assert.NoError(t, store.Delete(ctx, "dlq-message/1"))
+	assert.NoError(t, store.Delete(ctx, "dlq-message/1"))
+
+	_, err = store.Get(ctx, "dlq-message/1")
+	assert.Equal(t, blobstore.ErrNotFound, err)
+}
+
+func TestFileStore_InvalidKey(t *testing.T) {
+	ctx := context.TODO()
+	store := blobstore.NewFileStore(t.TempDir())
+
+	for _, key := range []string{"", "../escaped", "dlq-message/../../escaped", "/absolute", "dlq-message/"} {
+		assert.Equal(t, blobstore.ErrInvalidKey, store.Put(ctx, key, []byte("payload")), key)
+	}
+}
@@ -0,0 +1,36 @@
+package controller
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/auth"
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/model"
+	"github.com/sirupsen/logrus"
+)
+
+// APIKeyHeader is the header of the API key of the caller.
+const APIKeyHeader = "X-API-Key"
+
+// AuthMiddleware gives the requests the permissions of their API key, the requests without an API key have no permission
+// and the ones with an unknown API key are rejected.
+func AuthMiddleware(logger *logrus.Logger, keys auth.APIKeys) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(APIKeyHeader)
+			if key == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			permissions, ok := keys[key]
+			if !ok {
+				logger.Warnf("[AuthMiddleware] Request of %s is rejected by its unknown API key", r.URL.Path)
+				writeResponse(w, model.Response{Status: model.StatusUnauthorizedError, Error: "unknown API key"})
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(auth.WithPermissions(r.Context(), permissions)))
+		})
+	}
+}
@@ -2,6 +2,7 @@ package controller
 
 import (
 	"encoding/json"
+	"io"
 	"net/http"
 	"strconv"
 
@@ -23,17 +24,77 @@ func InitDLQController(logger *logrus.Logger, router *mux.Router, usecase usecas
 	}
 
 	router.HandleFunc("/dlq-service/messages", controller.GetMany).Methods(http.MethodGet)
+	router.HandleFunc("/dlq-service/v2/messages", controller.GetManyV2).Methods(http.MethodGet)
+	router.HandleFunc("/dlq-service/messages/{id}", controller.Get).Methods(http.MethodGet)
+	router.HandleFunc("/dlq-service/messages/{id}/republish", controller.Republish).Methods(http.MethodPost)
+	router.HandleFunc("/dlq-service/stats", controller.Stats).Methods(http.MethodGet)
 }
 
+// GetMany lists the messages in the first version of the API, where the key, the message and the header values are plain strings.
 func (c *DLQController) GetMany(w http.ResponseWriter, r *http.Request) {
+	response := c.getMany(r)
+	if bunchOfMessage, ok := response.Data.([]model.Message); ok {
+		response.Data = model.NewMessagesV1(bunchOfMessage)
+	}
+
+	writeResponse(w, response)
+}
+
+// GetManyV2 lists the messages with the key, the message and the header values as base64 bytes, so the binary payloads are kept exact.
+func (c *DLQController) GetManyV2(w http.ResponseWriter, r *http.Request) {
+	response := c.getMany(r)
+
+	writeResponse(w, response)
+}
+
+func (c *DLQController) getMany(r *http.Request) (response model.Response) {
 	ctx := r.Context()
 
 	queryString := r.URL.Query()
 	page, _ := strconv.ParseInt(queryString.Get("page"), 10, 64)
 	size, _ := strconv.ParseInt(queryString.Get("size"), 10, 64)
+	status := queryString.Get("status")
 
-	response := c.Usecase.GetMany(ctx, page, size)
+	return c.Usecase.GetMany(ctx, status, page, size)
+}
+
+func (c *DLQController) Get(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	ID := mux.Vars(r)["id"]
+
+	response := c.Usecase.Get(ctx, ID)
+
+	writeResponse(w, response)
+}
+
+// Republish sends the stored message, or the edited one of the optional body, back to its channel.
+func (c *DLQController) Republish(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	ID := mux.Vars(r)["id"]
+
+	var payload model.RepublishParams
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil && err != io.EOF {
+		writeResponse(w, model.Response{Status: model.StatusBadRequestError, Error: err.Error()})
+		return
+	}
+
+	response := c.Usecase.Republish(ctx, ID, payload)
+
+	writeResponse(w, response)
+}
+
+// Stats shows the storage savings of the payload compression.
+func (c *DLQController) Stats(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	response := c.Usecase.Stats(ctx)
+
+	writeResponse(w, response)
+}
 
+func writeResponse(w http.ResponseWriter, response model.Response) {
 	httpStatusCode := model.GetHTTPStatusCodeByResponseStatus(response.Status)
 
 	w.Header().Set("Content-Type", "application/json")
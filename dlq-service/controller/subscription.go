@@ -0,0 +1,93 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/model"
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/usecase"
+	"github.com/sirupsen/logrus"
+)
+
+type SubscriptionController struct {
+	Logger  *logrus.Logger
+	Usecase usecase.SubscriptionUsecase
+}
+
+func InitSubscriptionController(logger *logrus.Logger, router *mux.Router, usecase usecase.SubscriptionUsecase) {
+	controller := &SubscriptionController{
+		Logger:  logger,
+		Usecase: usecase,
+	}
+
+	router.HandleFunc("/dlq-service/subscriptions", controller.Get).Methods(http.MethodGet)
+	router.HandleFunc("/dlq-service/subscriptions", controller.Add).Methods(http.MethodPost)
+	router.HandleFunc("/dlq-service/subscriptions", controller.Remove).Methods(http.MethodDelete)
+	router.HandleFunc("/dlq-service/subscriptions/pause", controller.Pause).Methods(http.MethodPost)
+	router.HandleFunc("/dlq-service/subscriptions/resume", controller.Resume).Methods(http.MethodPost)
+}
+
+func (c *SubscriptionController) Get(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	response := c.Usecase.Get(ctx)
+
+	writeResponse(w, response)
+}
+
+func (c *SubscriptionController) Add(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var payload model.SubscriptionParams
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeResponse(w, model.Response{Status: model.StatusBadRequestError, Error: err.Error()})
+		return
+	}
+
+	response := c.Usecase.Add(ctx, payload)
+
+	writeResponse(w, response)
+}
+
+func (c *SubscriptionController) Remove(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var payload model.SubscriptionParams
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeResponse(w, model.Response{Status: model.StatusBadRequestError, Error: err.Error()})
+		return
+	}
+
+	response := c.Usecase.Remove(ctx, payload)
+
+	writeResponse(w, response)
+}
+
+func (c *SubscriptionController) Pause(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var payload model.PartitionParams
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeResponse(w, model.Response{Status: model.StatusBadRequestError, Error: err.Error()})
+		return
+	}
+
+	response := c.Usecase.Pause(ctx, payload)
+
+	writeResponse(w, response)
+}
+
+func (c *SubscriptionController) Resume(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var payload model.PartitionParams
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeResponse(w, model.Response{Status: model.StatusBadRequestError, Error: err.Error()})
+		return
+	}
+
+	response := c.Usecase.Resume(ctx, payload)
+
+	writeResponse(w, response)
+}
@@ -0,0 +1,92 @@
+// Package encryption encrypts the message payloads and header values at rest with the envelope encryption,
+// every message is encrypted by its own data key which is stored wrapped by a key of the key provider.
+package encryption
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"io"
+)
+
+// ErrUnknownKey is returned when the key of the key ID is not provided.
+var ErrUnknownKey = errors.New("encryption: unknown key")
+
+// ErrMalformedCiphertext is returned when the ciphertext is too short to be opened.
+var ErrMalformedCiphertext = errors.New("encryption: malformed ciphertext")
+
+// KeyProvider is a collection of behavior of the keys that wrap the data keys, it follows the Encrypt and Decrypt operations
+// of a KMS so that one can be plugged in with its key IDs.
+type KeyProvider interface {
+	// PrimaryKeyID is the key that wraps the data keys of the new messages and the rotated ones.
+	PrimaryKeyID() string
+	WrapKey(ctx context.Context, keyID string, dataKey []byte) (wrapped []byte, err error)
+	UnwrapKey(ctx context.Context, keyID string, wrapped []byte) (dataKey []byte, err error)
+}
+
+// dataKeySize makes the data keys AES-256 keys.
+const dataKeySize = 32
+
+// NewDataKey returns a random data key.
+func NewDataKey() (dataKey []byte, err error) {
+	dataKey = make([]byte, dataKeySize)
+	_, err = io.ReadFull(rand.Reader, dataKey)
+
+	return
+}
+
+// Seal encrypts the plaintext with AES-GCM, the random nonce is prepended to the ciphertext.
+func Seal(key, plaintext []byte) (ciphertext []byte, err error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return
+	}
+
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return
+	}
+
+	ciphertext = aead.Seal(nonce, nonce, plaintext, nil)
+
+	return
+}
+
+// Open decrypts the ciphertext of Seal.
+func Open(key, ciphertext []byte) (plaintext []byte, err error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return
+	}
+
+	if len(ciphertext) < aead.NonceSize()+aead.Overhead() {
+		err = ErrMalformedCiphertext
+		return
+	}
+
+	return aead.Open(nil, ciphertext[:aead.NonceSize()], ciphertext[aead.NonceSize():], nil)
+}
+
+func newAEAD(key []byte) (aead cipher.AEAD, err error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return
+	}
+
+	return cipher.NewGCM(block)
+}
+
+type decryptionKey struct{}
+
+// WithDecryption lets the reads of the context return the messages decrypted.
+func WithDecryption(ctx context.Context) context.Context {
+	return context.WithValue(ctx, decryptionKey{}, true)
+}
+
+// DecryptionAllowed reports whether the reads of the context return the messages decrypted.
+func DecryptionAllowed(ctx context.Context) bool {
+	allowed, _ := ctx.Value(decryptionKey{}).(bool)
+	return allowed
+}
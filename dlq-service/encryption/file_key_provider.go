@@ -0,0 +1,78 @@
+package encryption
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+)
+
+// keyFile is the JSON document of the local keys, the keys are base64 encoded AES-256 keys by their ID, e.g.
+//
+//	{"primaryKeyId": "2021-11", "keys": {"2021-10": "<base64>", "2021-11": "<base64>"}}
+//
+// The keys are rotated by adding a new key as the primary one, the old key is removed once the messages are rotated.
+type keyFile struct {
+	PrimaryKeyID string            `json:"primaryKeyId"`
+	Keys         map[string][]byte `json:"keys"`
+}
+
+type fileKeyProvider struct {
+	primaryKeyID string
+	keys         map[string][]byte
+}
+
+// NewFileKeyProvider returns a KeyProvider of the keys of the local key file, the file is read once.
+func NewFileKeyProvider(path string) (provider KeyProvider, err error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return
+	}
+
+	var file keyFile
+	if err = json.Unmarshal(data, &file); err != nil {
+		err = fmt.Errorf("encryption: key file %s is malformed: %w", path, err)
+		return
+	}
+	for keyID, key := range file.Keys {
+		if len(key) != dataKeySize {
+			err = fmt.Errorf("encryption: key %q must be %d bytes", keyID, dataKeySize)
+			return
+		}
+	}
+	if _, ok := file.Keys[file.PrimaryKeyID]; !ok {
+		err = fmt.Errorf("encryption: primary key %q: %w", file.PrimaryKeyID, ErrUnknownKey)
+		return
+	}
+
+	provider = &fileKeyProvider{
+		primaryKeyID: file.PrimaryKeyID,
+		keys:         file.Keys,
+	}
+
+	return
+}
+
+func (p *fileKeyProvider) PrimaryKeyID() string {
+	return p.primaryKeyID
+}
+
+func (p *fileKeyProvider) WrapKey(ctx context.Context, keyID string, dataKey []byte) (wrapped []byte, err error) {
+	key, ok := p.keys[keyID]
+	if !ok {
+		err = fmt.Errorf("encryption: key %q: %w", keyID, ErrUnknownKey)
+		return
+	}
+
+	return Seal(key, dataKey)
+}
+
+func (p *fileKeyProvider) UnwrapKey(ctx context.Context, keyID string, wrapped []byte) (dataKey []byte, err error) {
+	key, ok := p.keys[keyID]
+	if !ok {
+		err = fmt.Errorf("encryption: key %q: %w", keyID, ErrUnknownKey)
+		return
+	}
+
+	return Open(key, wrapped)
+}
@@ -0,0 +1,82 @@
+package encryption_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/encryption"
+	"github.com/stretchr/testify/assert"
+)
+
+func writeKeyFile(t *testing.T, primaryKeyID string, keyIDs ...string) string {
+	keys := ""
+	for i, keyID := range keyIDs {
+		if i > 0 {
+			keys += ","
+		}
+		keys += fmt.Sprintf("%q:%q", keyID, base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{byte(i + 1)}, 32)))
+	}
+
+	path := filepath.Join(t.TempDir(), "keys.json")
+	assert.NoError(t, ioutil.WriteFile(path, []byte(fmt.Sprintf(`{"primaryKeyId":%q,"keys":{%s}}`, primaryKeyID, keys)), 0600))
+
+	return path
+}
+
+func TestFileKeyProvider(t *testing.T) {
+	ctx := context.TODO()
+	provider, err := encryption.NewFileKeyProvider(writeKeyFile(t, "2021-11", "2021-10", "2021-11"))
+	assert.NoError(t, err)
+	assert.Equal(t, "2021-11", provider.PrimaryKeyID())
+
+	dataKey, err := encryption.NewDataKey()
+	assert.NoError(t, err)
+
+	wrapped, err := provider.WrapKey(ctx, "2021-10", dataKey)
+	assert.NoError(t, err)
+	assert.NotEqual(t, dataKey, wrapped)
+
+	unwrapped, err := provider.UnwrapKey(ctx, "2021-10", wrapped)
+	assert.NoError(t, err)
+	assert.Equal(t, dataKey, unwrapped)
+
+	// The data key is wrapped by the key of its key ID only.
+	_, err = provider.UnwrapKey(ctx, "2021-11", wrapped)
+	assert.Error(t, err)
+
+	_, err = provider.WrapKey(ctx, "2021-09", dataKey)
+	assert.True(t, errors.Is(err, encryption.ErrUnknownKey))
+	_, err = provider.UnwrapKey(ctx, "2021-09", wrapped)
+	assert.True(t, errors.Is(err, encryption.ErrUnknownKey))
+}
+
+func TestNewFileKeyProvider_UnknownPrimaryKey(t *testing.T) {
+	_, err := encryption.NewFileKeyProvider(writeKeyFile(t, "2021-12", "2021-10", "2021-11"))
+	assert.True(t, errors.Is(err, encryption.ErrUnknownKey))
+}
+
+func TestSealAndOpen(t *testing.T) {
+	dataKey, err := encryption.NewDataKey()
+	assert.NoError(t, err)
+
+	ciphertext, err := encryption.Seal(dataKey, []byte(`{"email":"customer@example.com"}`))
+	assert.NoError(t, err)
+	assert.NotContains(t, string(ciphertext), "customer@example.com")
+
+	plaintext, err := encryption.Open(dataKey, ciphertext)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte(`{"email":"customer@example.com"}`), plaintext)
+
+	ciphertext[len(ciphertext)-1] ^= 1
+	_, err = encryption.Open(dataKey, ciphertext)
+	assert.Error(t, err)
+
+	_, err = encryption.Open(dataKey, []byte("short"))
+	assert.Equal(t, encryption.ErrMalformedCiphertext, err)
+}
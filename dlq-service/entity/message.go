@@ -1,7 +1,63 @@
 package entity
 
-// MessageHeaders is an entity.
-type MessageHeaders map[string]string
+import (
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+)
+
+// MessageHeader is an entity.
+type MessageHeader struct {
+	Key   string `json:"key" bson:"key"`
+	Value []byte `json:"value" bson:"value"`
+}
+
+// MessageHeaders is an entity, it keeps the order of the headers and the duplicate keys.
+type MessageHeaders []MessageHeader
+
+// UnmarshalBSONValue decodes both the ordered list and the document of string values which is stored before the list.
+func (mh *MessageHeaders) UnmarshalBSONValue(t bsontype.Type, data []byte) (err error) {
+	switch t {
+	case bsontype.EmbeddedDocument:
+		elements, err := bson.Raw(data).Elements()
+		if err != nil {
+			return err
+		}
+
+		headers := make(MessageHeaders, 0, len(elements))
+		for _, element := range elements {
+			value, _ := element.Value().StringValueOK()
+			headers = append(headers, MessageHeader{Key: element.Key(), Value: []byte(value)})
+		}
+		*mh = headers
+	case bsontype.Array:
+		var headers []MessageHeader
+		if err = (bson.RawValue{Type: t, Value: data}).Unmarshal(&headers); err != nil {
+			return
+		}
+		*mh = headers
+	case bsontype.Null, bsontype.Undefined:
+		*mh = nil
+	default:
+		err = fmt.Errorf("entity: cannot decode %s into message headers", t)
+	}
+
+	return
+}
+
+// The statuses of the message.
+const (
+	MessageStatusNew      = "NEW"
+	MessageStatusReplayed = "REPLAYED"
+)
+
+// The codecs of the stored message payload, the payload without a codec is stored as it is.
+const (
+	MessageCodecZstd = "zstd"
+	MessageCodecGzip = "gzip"
+)
 
 // Message is an entity.
 type Message struct {
@@ -9,9 +65,57 @@ type Message struct {
 	Channel           string         `json:"channel" bson:"channel"`
 	Publisher         string         `json:"publisher" bson:"publisher"`
 	Consumer          string         `json:"consumer" bson:"consumer"`
-	Key               string         `json:"key" bson:"key"`
+	Key               []byte         `json:"key" bson:"key"`
 	Headers           MessageHeaders `json:"headers" bson:"headers"`
-	Message           string         `json:"message" bson:"message"`
+	Message           []byte         `json:"message" bson:"message"`
+	ContentType       string         `json:"contentType" bson:"contentType"`
+	SchemaVersion     int            `json:"schemaVersion" bson:"schemaVersion"`
 	CausedBy          string         `json:"causedBy" bson:"causedBy"`
-	FailedConsumeDate string         `json:"failedConsumeDate" bson:"failedConsumeDate"`
+	StackTrace        string         `json:"stackTrace,omitempty" bson:"stackTrace,omitempty"`
+	FailedConsumeDate time.Time      `json:"failedConsumeDate" bson:"failedConsumeDate"`
+	Partition         int32          `json:"partition" bson:"partition"`
+	Offset            int64          `json:"offset" bson:"offset"`
+	ProducedDate      *time.Time     `json:"producedDate,omitempty" bson:"producedDate,omitempty"`
+	ConsumerGroup     string         `json:"consumerGroup" bson:"consumerGroup"`
+	InstanceID        string         `json:"instanceId" bson:"instanceId"`
+	Attempt           int            `json:"attempt" bson:"attempt"`
+	DLQTopic          string         `json:"dlqTopic,omitempty" bson:"dlqTopic,omitempty"`
+	DLQPartition      int32          `json:"dlqPartition" bson:"dlqPartition"`
+	DLQOffset         int64          `json:"dlqOffset" bson:"dlqOffset"`
+	DLQKey            string         `json:"dlqKey,omitempty" bson:"dlqKey,omitempty"`
+	IngestedAt        time.Time      `json:"ingestedAt" bson:"ingestedAt"`
+	UpdatedAt         time.Time      `json:"updatedAt" bson:"updatedAt"`
+	Status            string         `json:"status" bson:"status"`
+	ReplayedAt        *time.Time     `json:"replayedAt,omitempty" bson:"replayedAt,omitempty"`
+	ExpireAt          *time.Time     `json:"expireAt,omitempty" bson:"expireAt,omitempty"`
+	ArchivedAt        *time.Time     `json:"archivedAt,omitempty" bson:"archivedAt,omitempty"`
+	ClaimedUntil      *time.Time     `json:"claimedUntil,omitempty" bson:"claimedUntil,omitempty"`
+	MessageCodec      string         `json:"messageCodec,omitempty" bson:"messageCodec,omitempty"`
+	MessageSize       int64          `json:"messageSize" bson:"messageSize"`
+	StoredMessageSize int64          `json:"storedMessageSize" bson:"storedMessageSize"`
+	MessageRef        string         `json:"messageRef,omitempty" bson:"messageRef,omitempty"`
+	MessageChecksum   string         `json:"messageChecksum,omitempty" bson:"messageChecksum,omitempty"`
+	// Encryption is set when the payload and the header values are encrypted at rest.
+	Encryption *MessageEncryption `json:"encryption,omitempty" bson:"encryption,omitempty"`
+}
+
+// MessageEncryption is an entity, it is the envelope of the encrypted message. The payload and the values of the headers
+// are encrypted by the data key of the message which is stored wrapped by the key of the key ID.
+type MessageEncryption struct {
+	KeyID   string `json:"keyId" bson:"keyId"`
+	DataKey []byte `json:"dataKey" bson:"dataKey"`
+	// Headers are the keys of the headers whose values are encrypted.
+	Headers []string `json:"headers,omitempty" bson:"headers,omitempty"`
+	// Decrypted is set on the messages that are read decrypted, it is never stored.
+	Decrypted bool `json:"-" bson:"-"`
+}
+
+// StorageStats is an entity, it shows how much storage the compression of the message payloads saves.
+type StorageStats struct {
+	Messages           int64   `json:"messages" bson:"messages"`
+	CompressedMessages int64   `json:"compressedMessages" bson:"compressedMessages"`
+	MessageSize        int64   `json:"messageSize" bson:"messageSize"`
+	StoredMessageSize  int64   `json:"storedMessageSize" bson:"storedMessageSize"`
+	SavedSize          int64   `json:"savedSize" bson:"savedSize"`
+	SavingRatio        float64 `json:"savingRatio" bson:"savingRatio"`
 }
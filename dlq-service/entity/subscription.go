@@ -0,0 +1,8 @@
+package entity
+
+// Subscription is an entity.
+type Subscription struct {
+	ID        string   `json:"id" bson:"id"`
+	Topics    []string `json:"topics" bson:"topics"`
+	UpdatedAt string   `json:"updatedAt" bson:"updatedAt"`
+}
@@ -0,0 +1,309 @@
+package eventbus
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// ErrCircuitBreakerOpen is returned by `CircuitBreakerHandler` when the message is rejected by an open breaker.
+var ErrCircuitBreakerOpen = errors.New("circuit breaker is open")
+
+// CircuitBreakerState is a state of `CircuitBreakerHandler`.
+type CircuitBreakerState string
+
+const (
+	CircuitBreakerClosed   CircuitBreakerState = "closed"
+	CircuitBreakerOpen     CircuitBreakerState = "open"
+	CircuitBreakerHalfOpen CircuitBreakerState = "half-open"
+)
+
+// CircuitBreakerConfig is a configuration of `CircuitBreakerHandler`.
+//
+// FIELDS:
+//
+// `Name` is used for the logs and the metrics.
+//
+// `WindowSize` is the number of the latest handled messages that are taken into account.
+//
+// `FailureRatio` is the ratio of failed messages within the window (0 to 1) that opens the breaker.
+//
+// `CoolDown` is the duration of the open state before a probe message is let through, it must be positive.
+//
+// `Pauser` is optional. When it is set, an open breaker pauses the partition of the message and holds the message until it can be probed.
+//
+// `Publisher` and `RetryTopic` are optional. When they are set, an open breaker sends the message to the retry topic instead.
+//
+// When neither is set, an open breaker rejects the message with `ErrCircuitBreakerOpen`.
+//
+// `Meter` is optional. The metrics of the breaker are recorded by it, the zero meter records nothing.
+type CircuitBreakerConfig struct {
+	Name         string
+	WindowSize   int
+	FailureRatio float64
+	CoolDown     time.Duration
+	Pauser       Pauser
+	Publisher    Publisher
+	RetryTopic   string
+	Meter        metric.Meter
+}
+
+// CircuitBreakerHandler is an event handler that guards another event handler with a circuit breaker.
+type CircuitBreakerHandler struct {
+	logger       *logrus.Logger
+	config       *CircuitBreakerConfig
+	eventHandler EventHandler
+	metrics      circuitBreakerMetrics
+
+	mu       sync.Mutex
+	state    CircuitBreakerState
+	window   *failureWindow
+	openedAt time.Time
+	probing  bool
+	paused   map[string]map[int32]bool
+}
+
+// Validate will return an error when the breaker could not work with the configuration.
+func (c *CircuitBreakerConfig) Validate() (err error) {
+	switch {
+	case c.WindowSize < 1:
+		err = errors.New("circuit breaker window size must be positive")
+	case c.FailureRatio <= 0 || c.FailureRatio > 1:
+		err = errors.New("circuit breaker failure ratio must be greater than 0 and at most 1")
+	case c.CoolDown <= 0:
+		err = errors.New("circuit breaker cool-down must be positive")
+	}
+
+	return
+}
+
+// CircuitBreakerMiddleware guards the rest of the chain with a `CircuitBreakerHandler`.
+// The breaker is shared by all the partitions, so it is the one to use together with `SetConcurrency`,
+// where the partition breaker of `DefaultSaramaConsumerGroupHandler` is not applied.
+func CircuitBreakerMiddleware(logger *logrus.Logger, config *CircuitBreakerConfig) Middleware {
+	return func(next EventHandler) EventHandler {
+		return NewCircuitBreakerHandler(logger, next, config)
+	}
+}
+
+// NewCircuitBreakerHandler is a constructor.
+func NewCircuitBreakerHandler(logger *logrus.Logger, eventHandler EventHandler, config *CircuitBreakerConfig) *CircuitBreakerHandler {
+	h := &CircuitBreakerHandler{
+		logger:       logger,
+		config:       config,
+		eventHandler: eventHandler,
+		window:       newFailureWindow(config.WindowSize),
+		paused:       make(map[string]map[int32]bool),
+	}
+	h.setState(CircuitBreakerClosed)
+	h.metrics = newCircuitBreakerMetrics(h)
+
+	return h
+}
+
+// State returns the current state of the breaker.
+func (h *CircuitBreakerHandler) State() CircuitBreakerState {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.state
+}
+
+// Handle will call the guarded event handler when the breaker allows it.
+// When the partition is paused and the context is done while waiting, the message is rejected with `ErrCircuitBreakerOpen`.
+func (h *CircuitBreakerHandler) Handle(ctx context.Context, message interface{}) (err error) {
+	for {
+		allowed, probe, wait := h.acquire()
+		if allowed {
+			// A panic is recorded as a failure as well, otherwise the breaker would wait for the probe forever.
+			failed := true
+			defer func() { h.record(probe, failed) }()
+
+			err = h.eventHandler.Handle(ctx, message)
+			failed = err != nil
+			return
+		}
+
+		h.metrics.rejected.Add(ctx, 1, h.metrics.attributes...)
+
+		if h.config.Publisher != nil && h.config.RetryTopic != "" {
+			return h.shortCircuit(ctx, message)
+		}
+
+		if h.config.Pauser == nil {
+			return ErrCircuitBreakerOpen
+		}
+
+		h.pause(message)
+
+		select {
+		case <-ctx.Done():
+			return ErrCircuitBreakerOpen
+		case <-time.After(wait):
+		}
+	}
+}
+
+// acquire will decide whether the message may be handled, and whether it is the probe of the half-open state.
+// When it is not allowed, it returns how long to wait before asking again.
+func (h *CircuitBreakerHandler) acquire() (allowed bool, probe bool, wait time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	switch h.state {
+	case CircuitBreakerOpen:
+		remaining := h.config.CoolDown - time.Since(h.openedAt)
+		if remaining > 0 {
+			return false, false, remaining
+		}
+		h.setState(CircuitBreakerHalfOpen)
+		h.probing = true
+		return true, true, 0
+	case CircuitBreakerHalfOpen:
+		if h.probing {
+			return false, false, h.config.CoolDown
+		}
+		h.probing = true
+		return true, true, 0
+	default:
+		return true, false, 0
+	}
+}
+
+func (h *CircuitBreakerHandler) record(probe bool, failed bool) {
+	if failed {
+		h.metrics.failures.Add(context.Background(), 1, h.metrics.attributes...)
+	} else {
+		h.metrics.successes.Add(context.Background(), 1, h.metrics.attributes...)
+	}
+
+	h.mu.Lock()
+
+	if probe {
+		h.probing = false
+		if failed {
+			h.trip()
+			h.mu.Unlock()
+			return
+		}
+
+		h.setState(CircuitBreakerClosed)
+		h.window.reset()
+		paused := h.paused
+		h.paused = make(map[string]map[int32]bool)
+		h.mu.Unlock()
+
+		h.resume(paused)
+		return
+	}
+
+	if h.state == CircuitBreakerClosed {
+		h.window.add(failed)
+		if h.window.full() && h.window.ratio() >= h.config.FailureRatio {
+			h.trip()
+		}
+	}
+
+	h.mu.Unlock()
+}
+
+// trip will open the breaker. The caller must hold the lock.
+func (h *CircuitBreakerHandler) trip() {
+	h.openedAt = time.Now()
+	h.metrics.opened.Add(context.Background(), 1, h.metrics.attributes...)
+	h.setState(CircuitBreakerOpen)
+}
+
+// setState will change the state. The caller must hold the lock.
+func (h *CircuitBreakerHandler) setState(state CircuitBreakerState) {
+	if h.state != "" && h.state != state {
+		h.logger.Infof("[CircuitBreaker] %s is changed from %s to %s", h.config.Name, h.state, state)
+	}
+
+	h.state = state
+}
+
+// circuitBreakerMetrics are the instruments of the breaker, the breakers share them and are told apart by the `breaker` attribute.
+type circuitBreakerMetrics struct {
+	rejected   metric.Int64Counter
+	failures   metric.Int64Counter
+	successes  metric.Int64Counter
+	opened     metric.Int64Counter
+	attributes []attribute.KeyValue
+}
+
+// newCircuitBreakerMetrics creates the instruments of the breaker, its state is observed as 1 for the current state and 0 for the others.
+func newCircuitBreakerMetrics(h *CircuitBreakerHandler) (metrics circuitBreakerMetrics) {
+	must := metric.Must(h.config.Meter)
+	metrics = circuitBreakerMetrics{
+		rejected:   must.NewInt64Counter("circuit_breaker.rejected", metric.WithDescription("The messages that are rejected by the open breaker.")),
+		failures:   must.NewInt64Counter("circuit_breaker.failures", metric.WithDescription("The messages that are failed to be handled.")),
+		successes:  must.NewInt64Counter("circuit_breaker.successes", metric.WithDescription("The messages that are handled.")),
+		opened:     must.NewInt64Counter("circuit_breaker.opened", metric.WithDescription("The times the breaker is opened.")),
+		attributes: []attribute.KeyValue{attribute.String("breaker", h.config.Name)},
+	}
+
+	must.NewInt64GaugeObserver("circuit_breaker.state", func(ctx context.Context, result metric.Int64ObserverResult) {
+		current := h.State()
+		for _, state := range []CircuitBreakerState{CircuitBreakerClosed, CircuitBreakerOpen, CircuitBreakerHalfOpen} {
+			var value int64
+			if state == current {
+				value = 1
+			}
+			result.Observe(value, append(metrics.attributes, attribute.String("state", string(state)))...)
+		}
+	}, metric.WithDescription("The state of the breaker."))
+
+	return
+}
+
+func (h *CircuitBreakerHandler) pause(message interface{}) {
+	kafkaMessage, ok := message.(*sarama.ConsumerMessage)
+	if !ok {
+		return
+	}
+
+	h.mu.Lock()
+	partitions, ok := h.paused[kafkaMessage.Topic]
+	if !ok {
+		partitions = make(map[int32]bool)
+		h.paused[kafkaMessage.Topic] = partitions
+	}
+	alreadyPaused := partitions[kafkaMessage.Partition]
+	partitions[kafkaMessage.Partition] = true
+	h.mu.Unlock()
+
+	if !alreadyPaused {
+		h.config.Pauser.Pause(kafkaMessage.Topic, []int32{kafkaMessage.Partition})
+	}
+}
+
+func (h *CircuitBreakerHandler) resume(paused map[string]map[int32]bool) {
+	for topic, partitions := range paused {
+		bunchOfPartition := make([]int32, 0, len(partitions))
+		for partition := range partitions {
+			bunchOfPartition = append(bunchOfPartition, partition)
+		}
+		h.config.Pauser.Resume(topic, bunchOfPartition)
+	}
+}
+
+func (h *CircuitBreakerHandler) shortCircuit(ctx context.Context, message interface{}) (err error) {
+	kafkaMessage, ok := message.(*sarama.ConsumerMessage)
+	if !ok {
+		return ErrCircuitBreakerOpen
+	}
+
+	headers := MessageHeadersOf(kafkaMessage.Headers)
+	headers.Set("retry-origin-topic", kafkaMessage.Topic)
+
+	err = h.config.Publisher.Send(ctx, h.config.RetryTopic, string(kafkaMessage.Key), headers, kafkaMessage.Value)
+
+	return
+}
@@ -0,0 +1,160 @@
+package eventbus_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	eventbus "github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/eventbus"
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/eventbus/mocks"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric/metrictest"
+)
+
+func getCircuitBreakerMessage() *sarama.ConsumerMessage {
+	return &sarama.ConsumerMessage{
+		Headers: []*sarama.RecordHeader{
+			{Key: []byte("test"), Value: []byte("header")},
+		},
+		Key:       []byte("test-key"),
+		Value:     []byte("test-message"),
+		Partition: int32(1),
+		Offset:    int64(40),
+		Topic:     "test-topic",
+	}
+}
+
+func TestCircuitBreakerHandler_RejectWhenOpen(t *testing.T) {
+	eventHandler := &mocks.EventHandler{}
+	eventHandler.On("Handle", mock.Anything, mock.Anything).Return(fmt.Errorf("error")).Twice()
+
+	meterProvider := metrictest.NewMeterProvider()
+
+	cb := eventbus.NewCircuitBreakerHandler(logrus.New(), eventHandler, &eventbus.CircuitBreakerConfig{
+		Name:         "test-reject",
+		WindowSize:   2,
+		FailureRatio: 1,
+		CoolDown:     time.Hour,
+		Meter:        meterProvider.Meter("test"),
+	})
+
+	assert.Error(t, cb.Handle(context.TODO(), getCircuitBreakerMessage()))
+	assert.Equal(t, eventbus.CircuitBreakerClosed, cb.State())
+	assert.Error(t, cb.Handle(context.TODO(), getCircuitBreakerMessage()))
+	assert.Equal(t, eventbus.CircuitBreakerOpen, cb.State())
+
+	err := cb.Handle(context.TODO(), getCircuitBreakerMessage())
+	assert.Equal(t, eventbus.ErrCircuitBreakerOpen, err)
+
+	breaker := attribute.String("breaker", "test-reject")
+	assert.Equal(t, int64(2), sumOf(meterProvider, "circuit_breaker.failures", breaker))
+	assert.Equal(t, int64(1), sumOf(meterProvider, "circuit_breaker.opened", breaker))
+	assert.Equal(t, int64(1), sumOf(meterProvider, "circuit_breaker.rejected", breaker))
+
+	// The current state is observed as 1, the others as 0.
+	meterProvider.RunAsyncInstruments()
+	for _, measured := range measurementsOf(meterProvider, "circuit_breaker.state", breaker) {
+		expected := int64(0)
+		if measured.Labels["state"] == attribute.StringValue(string(eventbus.CircuitBreakerOpen)) {
+			expected = 1
+		}
+		assert.Equal(t, expected, measured.Number.AsInt64(), measured.Labels["state"].AsString())
+	}
+	assert.Len(t, measurementsOf(meterProvider, "circuit_breaker.state", breaker), 3)
+
+	eventHandler.AssertExpectations(t)
+}
+
+func TestCircuitBreakerHandler_ShortCircuitToRetryTopic(t *testing.T) {
+	eventHandler := &mocks.EventHandler{}
+	eventHandler.On("Handle", mock.Anything, mock.Anything).Return(fmt.Errorf("error")).Once()
+
+	publisher := &mocks.Publisher{}
+	publisher.On("Send", mock.Anything, "test-retry-topic", "test-key", mock.Anything, []byte("test-message")).Return(nil).Once()
+
+	cb := eventbus.NewCircuitBreakerHandler(logrus.New(), eventHandler, &eventbus.CircuitBreakerConfig{
+		Name:         "test-retry",
+		WindowSize:   1,
+		FailureRatio: 1,
+		CoolDown:     time.Hour,
+		Publisher:    publisher,
+		RetryTopic:   "test-retry-topic",
+	})
+
+	assert.Error(t, cb.Handle(context.TODO(), getCircuitBreakerMessage()))
+	assert.NoError(t, cb.Handle(context.TODO(), getCircuitBreakerMessage()))
+
+	eventHandler.AssertExpectations(t)
+	publisher.AssertExpectations(t)
+}
+
+func TestCircuitBreakerHandler_PauseAndProbe(t *testing.T) {
+	eventHandler := &mocks.EventHandler{}
+	eventHandler.On("Handle", mock.Anything, mock.Anything).Return(fmt.Errorf("error")).Once()
+	eventHandler.On("Handle", mock.Anything, mock.Anything).Return(nil).Once()
+
+	pauser := &mocks.Pauser{}
+	pauser.On("Pause", "test-topic", []int32{1}).Once()
+	pauser.On("Resume", "test-topic", []int32{1}).Once()
+
+	cb := eventbus.NewCircuitBreakerHandler(logrus.New(), eventHandler, &eventbus.CircuitBreakerConfig{
+		Name:         "test-pause",
+		WindowSize:   1,
+		FailureRatio: 1,
+		CoolDown:     time.Millisecond * 10,
+		Pauser:       pauser,
+	})
+
+	assert.Error(t, cb.Handle(context.TODO(), getCircuitBreakerMessage()))
+	assert.Equal(t, eventbus.CircuitBreakerOpen, cb.State())
+	assert.NoError(t, cb.Handle(context.TODO(), getCircuitBreakerMessage()))
+	assert.Equal(t, eventbus.CircuitBreakerClosed, cb.State())
+
+	eventHandler.AssertExpectations(t)
+	pauser.AssertExpectations(t)
+}
+
+func TestCircuitBreakerMiddleware_RecordPanicOfProbe(t *testing.T) {
+	calls := 0
+	eventHandler := eventbus.EventHandlerFunc(func(ctx context.Context, message interface{}) (err error) {
+		calls++
+		switch calls {
+		case 1:
+			return fmt.Errorf("error")
+		case 2:
+			panic("boom")
+		}
+		return nil
+	})
+
+	config := &eventbus.CircuitBreakerConfig{
+		Name:         "test-middleware",
+		WindowSize:   1,
+		FailureRatio: 1,
+		CoolDown:     time.Millisecond,
+	}
+	assert.NoError(t, config.Validate())
+
+	handler := eventbus.Chain(eventHandler, eventbus.RecoverMiddleware(), eventbus.CircuitBreakerMiddleware(logrus.New(), config))
+
+	assert.Error(t, handler.Handle(context.TODO(), getCircuitBreakerMessage()))
+
+	time.Sleep(time.Millisecond * 5)
+	assert.IsType(t, &eventbus.PanicError{}, handler.Handle(context.TODO(), getCircuitBreakerMessage()))
+
+	time.Sleep(time.Millisecond * 5)
+	assert.NoError(t, handler.Handle(context.TODO(), getCircuitBreakerMessage()))
+	assert.Equal(t, 3, calls)
+}
+
+func TestCircuitBreakerConfig_Validate(t *testing.T) {
+	assert.NoError(t, (&eventbus.CircuitBreakerConfig{WindowSize: 1, FailureRatio: 1, CoolDown: time.Second}).Validate())
+	assert.Error(t, (&eventbus.CircuitBreakerConfig{WindowSize: 1, FailureRatio: 1}).Validate())
+	assert.Error(t, (&eventbus.CircuitBreakerConfig{WindowSize: 1, CoolDown: time.Second}).Validate())
+	assert.Error(t, (&eventbus.CircuitBreakerConfig{FailureRatio: 1, CoolDown: time.Second}).Validate())
+}
@@ -3,20 +3,105 @@ package eventbus
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"os"
+	"strconv"
+	"strings"
 	"time"
+	"unicode/utf8"
+
+	"github.com/Shopify/sarama"
 )
 
+// DeadLetterQueueSchemaVersion is the version of `DeadLetterQueueMessage` that is published by `DLQHandlerAdapter`.
+//
+// Version 1 (no `schemaVersion` field) carries the key and the message as plain strings.
+// Version 2 carries them as base64 bytes along with their content type, so binary payloads are kept as they are.
+// Version 3 carries the headers as an ordered list of key and base64 value instead of an object.
+const DeadLetterQueueSchemaVersion = 3
+
 // DeadLetterQueueMessage is an entity.
 type DeadLetterQueueMessage struct {
+	SchemaVersion     int            `json:"schemaVersion"`
 	Channel           string         `json:"channel"`
 	Publisher         string         `json:"publisher"`
 	Consumer          string         `json:"consumer"`
-	Key               string         `json:"key"`
+	Key               []byte         `json:"key"`
 	Headers           MessageHeaders `json:"headers"`
-	Message           string         `json:"message"`
+	Message           []byte         `json:"message"`
+	ContentType       string         `json:"contentType"`
 	CausedBy          string         `json:"causedBy"`
+	StackTrace        string         `json:"stackTrace,omitempty"`
 	FailedConsumeDate string         `json:"failedConsumeDate"`
+	Partition         int32          `json:"partition"`
+	Offset            int64          `json:"offset"`
+	ProducedDate      string         `json:"producedDate"`
+	ConsumerGroup     string         `json:"consumerGroup"`
+	InstanceID        string         `json:"instanceId"`
+	Attempt           int            `json:"attempt"`
+}
+
+// AttemptHeader is the header that counts how many times the message has been sent to the DLQ.
+// It is set when the message is republished, so the next failure increments it.
+const AttemptHeader = "dlq-attempt"
+
+// instanceID identifies the process that failed to handle the message.
+var instanceID = func() string {
+	hostname, _ := os.Hostname()
+	return fmt.Sprintf("%s:%d", hostname, os.Getpid())
+}()
+
+// newDeadLetterQueueMessage wraps the message that is failed to be handled by the consumer.
+func newDeadLetterQueueMessage(consumer string, consumerGroup string, message *sarama.ConsumerMessage, err error) *DeadLetterQueueMessage {
+	originalHeaders := MessageHeadersOf(message.Headers)
+
+	previousAttempt, _ := strconv.Atoi(originalHeaders.Get(AttemptHeader))
+
+	dlqMessage := &DeadLetterQueueMessage{
+		SchemaVersion:     DeadLetterQueueSchemaVersion,
+		Channel:           message.Topic,
+		Publisher:         originalHeaders.Get("origin"),
+		Consumer:          consumer,
+		Key:               message.Key,
+		Headers:           originalHeaders,
+		Message:           message.Value,
+		ContentType:       contentTypeOf(originalHeaders, message.Value),
+		CausedBy:          err.Error(),
+		FailedConsumeDate: time.Now().UTC().Format(time.RFC3339Nano),
+		Partition:         message.Partition,
+		Offset:            message.Offset,
+		ProducedDate:      message.Timestamp.UTC().Format(time.RFC3339Nano),
+		ConsumerGroup:     consumerGroup,
+		InstanceID:        instanceID,
+		Attempt:           previousAttempt + 1,
+	}
+
+	var panicErr *PanicError
+	if errors.As(err, &panicErr) {
+		dlqMessage.CausedBy = fmt.Sprint(panicErr.Value)
+		dlqMessage.StackTrace = string(panicErr.Stack)
+	}
+
+	return dlqMessage
+}
+
+// contentTypeOf returns the content type header of the message, or detects it from the value when there is none.
+func contentTypeOf(headers MessageHeaders, value []byte) string {
+	for _, header := range headers {
+		if strings.EqualFold(header.Key, "content-type") {
+			return string(header.Value)
+		}
+	}
+
+	switch {
+	case json.Valid(value):
+		return "application/json"
+	case utf8.Valid(value):
+		return "text/plain; charset=utf-8"
+	default:
+		return "application/octet-stream"
+	}
 }
 
 // DLQHandlerAdapter is an dead letter queue adapter.
@@ -38,7 +123,7 @@ func (dlqHandlerAdapter *DLQHandlerAdapter) Send(ctx context.Context, dlqMessage
 	key := fmt.Sprintf("%s:%s:%s:%d",
 		dlqMessage.Consumer,
 		dlqMessage.Channel,
-		dlqMessage.Key,
+		string(dlqMessage.Key),
 		time.Now().UnixNano(),
 	)
 
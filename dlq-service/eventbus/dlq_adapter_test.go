@@ -0,0 +1,119 @@
+package eventbus_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/Shopify/sarama"
+	eventbus "github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/eventbus"
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/eventbus/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.elastic.co/apm"
+)
+
+func TestDLQHandlerAdapter_BinaryPayload(t *testing.T) {
+	binaryKey := []byte{0x00, 0xff, 0xfe, 0x01}
+	binaryValue := []byte{0x00, 0x00, 0x00, 0x00, 0x2a, 0xc3, 0x28, 0xa0, 0xa1}
+
+	eventHandler := &mocks.EventHandler{}
+	eventHandler.On("Handle", mock.Anything, mock.Anything).Return(fmt.Errorf("error"))
+
+	var published []byte
+	publisher := &mocks.Publisher{}
+	publisher.On("Send", mock.Anything, "dlq-test-topic", mock.AnythingOfType("string"), mock.Anything, mock.AnythingOfType("[]uint8")).Run(func(args mock.Arguments) {
+		published = args.Get(4).([]byte)
+	}).Return(nil).Once()
+
+	messageChan := make(chan *sarama.ConsumerMessage, 1)
+	messageChan <- &sarama.ConsumerMessage{
+		Headers: []*sarama.RecordHeader{
+			{Key: []byte("trace"), Value: []byte("1")},
+			{Key: []byte("binary"), Value: []byte{0xff}},
+			{Key: []byte("trace"), Value: []byte("2")},
+		},
+		Key:       binaryKey,
+		Value:     binaryValue,
+		Partition: int32(1),
+		Offset:    int64(40),
+		Topic:     "test-topic",
+	}
+	close(messageChan)
+
+	cgSess := &mocks.SaramaConsumerGroupSession{}
+	cgSess.On("MarkMessage", mock.AnythingOfType("*sarama.ConsumerMessage"), mock.AnythingOfType("string"))
+	cgSess.On("Context").Return(context.TODO())
+
+	cgClaim := &mocks.SaramaConsumerGroupClaim{}
+	cgClaim.On("Messages").Return((<-chan *sarama.ConsumerMessage)(messageChan))
+
+	cgh := eventbus.NewDefaultSaramaConsumerGroupHandler(eventbus.NewElasticAPMTracer(apm.DefaultTracer), "service-test", eventHandler, eventbus.NewDLQHandlerAdapter("dlq-test-topic", publisher))
+	cgh.ConsumeClaim(cgSess, cgClaim)
+
+	publisher.AssertExpectations(t)
+
+	var dlqMessage eventbus.DeadLetterQueueMessage
+	assert.NoError(t, json.Unmarshal(published, &dlqMessage))
+	assert.Equal(t, eventbus.DeadLetterQueueSchemaVersion, dlqMessage.SchemaVersion)
+	assert.Equal(t, binaryKey, dlqMessage.Key)
+	assert.Equal(t, binaryValue, dlqMessage.Message)
+	assert.Equal(t, "application/octet-stream", dlqMessage.ContentType)
+	assert.Equal(t, eventbus.MessageHeaders{
+		{Key: "trace", Value: []byte("1")},
+		{Key: "binary", Value: []byte{0xff}},
+		{Key: "trace", Value: []byte("2")},
+	}, dlqMessage.Headers)
+}
+
+func TestDLQHeadersHandlerAdapter_RoundTrip(t *testing.T) {
+	binaryValue := []byte{0x00, 0x00, 0x00, 0x00, 0x2a, 0xc3, 0x28}
+
+	var (
+		publishedKey     string
+		publishedHeaders eventbus.MessageHeaders
+		publishedValue   []byte
+	)
+	publisher := &mocks.Publisher{}
+	publisher.On("Send", mock.Anything, "dlq-test-topic", "test-key", mock.Anything, binaryValue).Run(func(args mock.Arguments) {
+		publishedKey = args.String(2)
+		publishedHeaders = args.Get(3).(eventbus.MessageHeaders)
+		publishedValue = args.Get(4).([]byte)
+	}).Return(nil).Once()
+
+	dlqMessage := &eventbus.DeadLetterQueueMessage{
+		SchemaVersion: eventbus.DeadLetterQueueSchemaVersion,
+		Channel:       "test-topic",
+		Publisher:     "test-publisher",
+		Consumer:      "service-test",
+		Key:           []byte("test-key"),
+		Headers: eventbus.MessageHeaders{
+			{Key: "test", Value: []byte("header")},
+			{Key: "binary", Value: []byte{0xff, 0x00}},
+			{Key: "test", Value: []byte("duplicate")},
+		},
+		Message:           binaryValue,
+		ContentType:       "application/octet-stream",
+		CausedBy:          "error",
+		FailedConsumeDate: "2021-07-01T00:00:01Z",
+		Partition:         3,
+		Offset:            40,
+		ProducedDate:      "2021-07-01T00:00:00Z",
+		ConsumerGroup:     "group-test",
+		InstanceID:        "host:1",
+		Attempt:           2,
+	}
+
+	err := eventbus.NewDLQHeadersHandlerAdapter("dlq-test-topic", publisher).Send(context.TODO(), dlqMessage)
+	assert.NoError(t, err)
+	publisher.AssertExpectations(t)
+
+	record := &sarama.ConsumerMessage{Key: []byte(publishedKey), Value: publishedValue}
+	for _, header := range publishedHeaders {
+		record.Headers = append(record.Headers, &sarama.RecordHeader{Key: []byte(header.Key), Value: header.Value})
+	}
+
+	assert.True(t, eventbus.IsDLQHeadersFormat(record))
+	assert.Equal(t, dlqMessage, eventbus.DeadLetterQueueMessageFromHeaders(record))
+}
@@ -0,0 +1,139 @@
+package eventbus
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+// The well-known headers of `DLQHeadersHandlerAdapter`.
+// The original headers are kept as they are, except the ones with the `dlq-` prefix which are reserved.
+const (
+	HeaderDLQFormat        = "dlq-format"
+	HeaderDLQCausedBy      = "dlq-caused-by"
+	HeaderDLQStackTrace    = "dlq-stack-trace"
+	HeaderDLQTopic         = "dlq-original-topic"
+	HeaderDLQPartition     = "dlq-original-partition"
+	HeaderDLQOffset        = "dlq-original-offset"
+	HeaderDLQPublisher     = "dlq-publisher"
+	HeaderDLQConsumer      = "dlq-consumer"
+	HeaderDLQConsumerGroup = "dlq-consumer-group"
+	HeaderDLQInstanceID    = "dlq-instance-id"
+	HeaderDLQProducedDate  = "dlq-produced-date"
+	HeaderDLQFailedDate    = "dlq-failed-date"
+	HeaderDLQContentType   = "dlq-content-type"
+
+	// DLQFormatHeaders is the value of `HeaderDLQFormat` for the records that are published by `DLQHeadersHandlerAdapter`.
+	DLQFormatHeaders = "headers"
+)
+
+const headerDLQPrefix = "dlq-"
+
+// DLQHeadersHandlerAdapter is an dead letter queue adapter that publishes the original key and message unchanged,
+// and carries the metadata in the `dlq-*` headers, so the DLQ topic stays readable by the standard tooling.
+type DLQHeadersHandlerAdapter struct {
+	topic     string
+	publisher Publisher
+}
+
+// NewDLQHeadersHandlerAdapter is a constructor.
+func NewDLQHeadersHandlerAdapter(topic string, publisher Publisher) *DLQHeadersHandlerAdapter {
+	return &DLQHeadersHandlerAdapter{topic, publisher}
+}
+
+// Send will publish the dlq message to the assigned topic.
+func (dlqHandlerAdapter *DLQHeadersHandlerAdapter) Send(ctx context.Context, dlqMessage *DeadLetterQueueMessage) (err error) {
+	headers := MessageHeaders{}
+	for _, header := range dlqMessage.Headers {
+		if strings.HasPrefix(header.Key, headerDLQPrefix) {
+			continue
+		}
+		headers.AddBytes(header.Key, header.Value)
+	}
+
+	headers.Add("dlq", "true")
+	headers.Add(HeaderDLQFormat, DLQFormatHeaders)
+	headers.Add(HeaderDLQCausedBy, dlqMessage.CausedBy)
+	headers.Add(HeaderDLQTopic, dlqMessage.Channel)
+	headers.Add(HeaderDLQPartition, strconv.FormatInt(int64(dlqMessage.Partition), 10))
+	headers.Add(HeaderDLQOffset, strconv.FormatInt(dlqMessage.Offset, 10))
+	headers.Add(HeaderDLQPublisher, dlqMessage.Publisher)
+	headers.Add(HeaderDLQConsumer, dlqMessage.Consumer)
+	headers.Add(HeaderDLQConsumerGroup, dlqMessage.ConsumerGroup)
+	headers.Add(HeaderDLQInstanceID, dlqMessage.InstanceID)
+	headers.Add(HeaderDLQProducedDate, dlqMessage.ProducedDate)
+	headers.Add(HeaderDLQFailedDate, dlqMessage.FailedConsumeDate)
+	headers.Add(HeaderDLQContentType, dlqMessage.ContentType)
+	headers.Add(AttemptHeader, strconv.Itoa(dlqMessage.Attempt))
+	if dlqMessage.StackTrace != "" {
+		headers.Add(HeaderDLQStackTrace, dlqMessage.StackTrace)
+	}
+
+	err = dlqHandlerAdapter.publisher.Send(
+		ctx,
+		dlqHandlerAdapter.topic,
+		string(dlqMessage.Key),
+		headers,
+		dlqMessage.Message,
+	)
+
+	return
+}
+
+// IsDLQHeadersFormat reports whether the record is published by `DLQHeadersHandlerAdapter`.
+func IsDLQHeadersFormat(message *sarama.ConsumerMessage) bool {
+	for _, header := range message.Headers {
+		if string(header.Key) == HeaderDLQFormat {
+			return string(header.Value) == DLQFormatHeaders
+		}
+	}
+
+	return false
+}
+
+// DeadLetterQueueMessageFromHeaders restores the dlq message of a record that is published by `DLQHeadersHandlerAdapter`.
+func DeadLetterQueueMessageFromHeaders(message *sarama.ConsumerMessage) *DeadLetterQueueMessage {
+	metadata := MessageHeaders{}
+	originalHeaders := MessageHeaders{}
+
+	for _, header := range message.Headers {
+		key := string(header.Key)
+		if key == "dlq" || strings.HasPrefix(key, headerDLQPrefix) {
+			metadata.AddBytes(key, header.Value)
+			continue
+		}
+		originalHeaders.AddBytes(key, header.Value)
+	}
+
+	partition, _ := strconv.ParseInt(metadata.Get(HeaderDLQPartition), 10, 32)
+	offset, _ := strconv.ParseInt(metadata.Get(HeaderDLQOffset), 10, 64)
+	attempt, _ := strconv.Atoi(metadata.Get(AttemptHeader))
+
+	failedConsumeDate := metadata.Get(HeaderDLQFailedDate)
+	if failedConsumeDate == "" {
+		failedConsumeDate = message.Timestamp.UTC().Format(time.RFC3339Nano)
+	}
+
+	return &DeadLetterQueueMessage{
+		SchemaVersion:     DeadLetterQueueSchemaVersion,
+		Channel:           metadata.Get(HeaderDLQTopic),
+		Publisher:         metadata.Get(HeaderDLQPublisher),
+		Consumer:          metadata.Get(HeaderDLQConsumer),
+		Key:               message.Key,
+		Headers:           originalHeaders,
+		Message:           message.Value,
+		ContentType:       metadata.Get(HeaderDLQContentType),
+		CausedBy:          metadata.Get(HeaderDLQCausedBy),
+		StackTrace:        metadata.Get(HeaderDLQStackTrace),
+		FailedConsumeDate: failedConsumeDate,
+		Partition:         int32(partition),
+		Offset:            offset,
+		ProducedDate:      metadata.Get(HeaderDLQProducedDate),
+		ConsumerGroup:     metadata.Get(HeaderDLQConsumerGroup),
+		InstanceID:        metadata.Get(HeaderDLQInstanceID),
+		Attempt:           attempt,
+	}
+}
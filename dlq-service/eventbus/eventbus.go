@@ -12,6 +12,15 @@ type EventHandler interface {
 	Handle(ctx context.Context, message interface{}) (err error)
 }
 
+// BatchFailures holds the error of the failed messages by their index in the batch.
+type BatchFailures map[int]error
+
+// BatchEventHandler is an event handler for a batch of messages. It will be called after the batch is accumulated by consumer.
+// Only the messages within the returned failures are considered failed, the others are considered handled.
+type BatchEventHandler interface {
+	HandleBatch(ctx context.Context, messages []interface{}) (failures BatchFailures)
+}
+
 // Publisher is a collection of behavior of a publisher
 type Publisher interface {
 	// Will send the message to the assigned topic.
@@ -19,8 +28,32 @@ type Publisher interface {
 	Close() (err error)
 }
 
+// Pauser is a collection of behavior to suspend and continue the consumption of topic partitions.
+type Pauser interface {
+	// Will stop fetching the messages of the partitions until they are resumed.
+	Pause(topic string, partitions []int32)
+	// Will continue fetching the messages of the partitions that were paused.
+	Resume(topic string, partitions []int32)
+}
+
+// Redactor is a collection of behavior to hide the personal data of the messages before they are logged.
+type Redactor interface {
+	Payload(data []byte) []byte
+	Header(key string, value []byte) []byte
+}
+
 // Subscriber is a collection of behavior of a subscriber
 type Subscriber interface {
 	Subscribe()
+	// Will stop fetching the messages of the partitions until they are resumed.
+	Pause(topic string, partitions []int32)
+	// Will continue fetching the messages of the partitions that were paused.
+	Resume(topic string, partitions []int32)
+	// Will return the topics that are currently subscribed.
+	Topics() (topics []string)
+	// Will subscribe the additional topics without restarting the process.
+	AddTopics(topics ...string)
+	// Will unsubscribe the topics without restarting the process.
+	RemoveTopics(topics ...string)
 	Close() (err error)
 }
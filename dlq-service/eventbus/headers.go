@@ -1,9 +1,116 @@
 package eventbus
 
-// MessageHeaders is type of message headers
-type MessageHeaders map[string]string
+import "github.com/Shopify/sarama"
 
-// Add will add the key and value to headers.
-func (mh MessageHeaders) Add(key, value string) {
-	mh[key] = value
+// MessageHeader is a header of a message, the value is kept as the bytes it is consumed with.
+type MessageHeader struct {
+	Key   string `json:"key"`
+	Value []byte `json:"value"`
+}
+
+// MessageHeaders is type of message headers, it keeps the order of the headers and the duplicate keys.
+type MessageHeaders []MessageHeader
+
+// MessageHeadersOf copies the headers of the consumed record.
+func MessageHeadersOf(recordHeaders []*sarama.RecordHeader) MessageHeaders {
+	headers := make(MessageHeaders, 0, len(recordHeaders))
+	for _, header := range recordHeaders {
+		if header == nil {
+			continue
+		}
+		headers.AddBytes(string(header.Key), header.Value)
+	}
+
+	return headers
+}
+
+// Add will append the key and value to headers.
+func (mh *MessageHeaders) Add(key, value string) {
+	mh.AddBytes(key, []byte(value))
+}
+
+// AddBytes will append the key and the raw value to headers.
+func (mh *MessageHeaders) AddBytes(key string, value []byte) {
+	*mh = append(*mh, MessageHeader{Key: key, Value: append([]byte{}, value...)})
+}
+
+// Set will replace every value of the key with the value, in place of the first one.
+func (mh *MessageHeaders) Set(key, value string) {
+	headers := make(MessageHeaders, 0, len(*mh)+1)
+	isSet := false
+	for _, header := range *mh {
+		if header.Key != key {
+			headers = append(headers, header)
+			continue
+		}
+		if !isSet {
+			headers = append(headers, MessageHeader{Key: key, Value: []byte(value)})
+			isSet = true
+		}
+	}
+	if !isSet {
+		headers = append(headers, MessageHeader{Key: key, Value: []byte(value)})
+	}
+
+	*mh = headers
+}
+
+// Del will remove every value of the key.
+func (mh *MessageHeaders) Del(key string) {
+	headers := make(MessageHeaders, 0, len(*mh))
+	for _, header := range *mh {
+		if header.Key != key {
+			headers = append(headers, header)
+		}
+	}
+
+	*mh = headers
+}
+
+// Get returns the first value of the key.
+func (mh MessageHeaders) Get(key string) string {
+	return string(mh.GetBytes(key))
+}
+
+// GetBytes returns the first raw value of the key.
+func (mh MessageHeaders) GetBytes(key string) []byte {
+	for _, header := range mh {
+		if header.Key == key {
+			return header.Value
+		}
+	}
+
+	return nil
+}
+
+// Values returns every value of the key in order.
+func (mh MessageHeaders) Values(key string) (values []string) {
+	for _, header := range mh {
+		if header.Key == key {
+			values = append(values, string(header.Value))
+		}
+	}
+
+	return
+}
+
+// Has reports whether the key exists.
+func (mh MessageHeaders) Has(key string) bool {
+	for _, header := range mh {
+		if header.Key == key {
+			return true
+		}
+	}
+
+	return false
+}
+
+// RecordHeaders returns the headers to be produced in order.
+func (mh MessageHeaders) RecordHeaders() []sarama.RecordHeader {
+	recordHeaders := make([]sarama.RecordHeader, 0, len(mh))
+	for _, header := range mh {
+		recordHeaders = append(recordHeaders, sarama.RecordHeader{Key: []byte(header.Key), Value: header.Value})
+	}
+
+	return recordHeaders
 }
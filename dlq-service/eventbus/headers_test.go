@@ -0,0 +1,66 @@
+package eventbus_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/Shopify/sarama/mocks"
+	eventbus "github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/eventbus"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMessageHeaders(t *testing.T) {
+	headers := eventbus.MessageHeadersOf([]*sarama.RecordHeader{
+		{Key: []byte("b"), Value: []byte("1")},
+		{Key: []byte("a"), Value: []byte{0xff, 0xfe}},
+		{Key: []byte("b"), Value: []byte("2")},
+	})
+
+	assert.Equal(t, "1", headers.Get("b"))
+	assert.Equal(t, []string{"1", "2"}, headers.Values("b"))
+	assert.Equal(t, []byte{0xff, 0xfe}, headers.GetBytes("a"))
+	assert.False(t, headers.Has("c"))
+
+	headers.Add("c", "3")
+	headers.Set("b", "4")
+	assert.Equal(t, eventbus.MessageHeaders{
+		{Key: "b", Value: []byte("4")},
+		{Key: "a", Value: []byte{0xff, 0xfe}},
+		{Key: "c", Value: []byte("3")},
+	}, headers)
+
+	headers.Del("a")
+	assert.Equal(t, eventbus.MessageHeaders{
+		{Key: "b", Value: []byte("4")},
+		{Key: "c", Value: []byte("3")},
+	}, headers)
+}
+
+func TestSaramaKafkaProducer_HeadersOrder(t *testing.T) {
+	headers := eventbus.MessageHeaders{}
+	headers.Add("b", "1")
+	headers.AddBytes("a", []byte{0xff})
+	headers.Add("b", "2")
+
+	var produced []sarama.RecordHeader
+	saramaProducer := mocks.NewAsyncProducer(t, nil)
+	saramaProducer.ExpectInputWithMessageCheckerFunctionAndSucceed(func(message *sarama.ProducerMessage) error {
+		produced = message.Headers
+		return nil
+	})
+
+	publisher := eventbus.NewSaramaKafkaProducerAdapter(logrus.New(), &eventbus.SaramaKafkaProducerAdapterConfig{
+		AsyncProducer: saramaProducer,
+	})
+
+	publisher.Send(context.TODO(), "test-topic", "test-key", headers, []byte("Hola"))
+	publisher.Close()
+
+	assert.Equal(t, []sarama.RecordHeader{
+		{Key: []byte("b"), Value: []byte("1")},
+		{Key: []byte("a"), Value: []byte{0xff}},
+		{Key: []byte("b"), Value: []byte("2")},
+	}, produced)
+}
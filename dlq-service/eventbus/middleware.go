@@ -0,0 +1,150 @@
+package eventbus
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/unit"
+)
+
+// Middleware is a function that wraps an event handler to add a cross-cutting behavior.
+type Middleware func(EventHandler) EventHandler
+
+// EventHandlerFunc is an adapter to allow the use of ordinary functions as event handlers.
+type EventHandlerFunc func(ctx context.Context, message interface{}) (err error)
+
+// Handle calls f(ctx, message).
+func (f EventHandlerFunc) Handle(ctx context.Context, message interface{}) (err error) {
+	return f(ctx, message)
+}
+
+// Chain wraps the event handler with the middlewares.
+// The first middleware is the outermost one, so it is the first to see the message.
+func Chain(eventHandler EventHandler, middlewares ...Middleware) EventHandler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		eventHandler = middlewares[i](eventHandler)
+	}
+
+	return eventHandler
+}
+
+// PanicError is an error that is recovered from a panic in an event handler.
+type PanicError struct {
+	Value interface{}
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.Value)
+}
+
+// RecoverMiddleware turns a panic of the event handler into a `*PanicError`,
+// so the message goes to the DLQ handler instead of crashing the process.
+func RecoverMiddleware() Middleware {
+	return func(next EventHandler) EventHandler {
+		return EventHandlerFunc(func(ctx context.Context, message interface{}) (err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					err = &PanicError{Value: r, Stack: debug.Stack()}
+				}
+			}()
+
+			return next.Handle(ctx, message)
+		})
+	}
+}
+
+// TimeoutMiddleware cancels the context of the event handler after the timeout.
+// The event handler must respect the context for the timeout to take effect.
+func TimeoutMiddleware(timeout time.Duration) Middleware {
+	return func(next EventHandler) EventHandler {
+		return EventHandlerFunc(func(ctx context.Context, message interface{}) (err error) {
+			ctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+
+			err = next.Handle(ctx, message)
+			if err != nil && ctx.Err() == context.DeadlineExceeded {
+				err = fmt.Errorf("event handler is timed out after %s: %w", timeout, err)
+			}
+
+			return
+		})
+	}
+}
+
+// LoggingMiddleware logs every handled message with its coordinates, duration and error.
+func LoggingMiddleware(logger *logrus.Logger) Middleware {
+	return func(next EventHandler) EventHandler {
+		return EventHandlerFunc(func(ctx context.Context, message interface{}) (err error) {
+			start := time.Now()
+			err = next.Handle(ctx, message)
+
+			entry := logger.WithContext(ctx).WithField("duration", time.Since(start).String())
+			if kafkaMessage, ok := message.(*sarama.ConsumerMessage); ok {
+				entry = entry.WithFields(logrus.Fields{
+					"topic":     kafkaMessage.Topic,
+					"partition": kafkaMessage.Partition,
+					"offset":    kafkaMessage.Offset,
+				})
+			}
+
+			if err != nil {
+				entry.WithError(err).Error("[EventHandler] Message is failed to be handled")
+				return
+			}
+
+			entry.Info("[EventHandler] Message is handled")
+			return
+		})
+	}
+}
+
+// TracingMiddleware wraps the event handler in a span of the transaction within the context.
+func TracingMiddleware(tracer Tracer, name string) Middleware {
+	tracer = tracerOrNoop(tracer)
+
+	return func(next EventHandler) EventHandler {
+		return EventHandlerFunc(func(ctx context.Context, message interface{}) (err error) {
+			span, ctx := tracer.StartSpan(ctx, name, "eventbus.handle")
+			defer span.End()
+
+			if err = next.Handle(ctx, message); err != nil {
+				span.RecordError(err)
+			}
+
+			return
+		})
+	}
+}
+
+// MetricsMiddleware counts the handled and failed messages and records their duration in milliseconds by the meter,
+// the event handlers share the instruments and are told apart by the `handler` attribute.
+func MetricsMiddleware(meter metric.Meter, name string) Middleware {
+	must := metric.Must(meter)
+	handled := must.NewInt64Counter("event_handler.handled", metric.WithDescription("The messages that are handled."))
+	failed := must.NewInt64Counter("event_handler.failed", metric.WithDescription("The messages that are failed to be handled."))
+	duration := must.NewFloat64Histogram("event_handler.duration", metric.WithDescription("The duration of the handling."),
+		metric.WithUnit(unit.Milliseconds))
+	attributes := []attribute.KeyValue{attribute.String("handler", name)}
+
+	return func(next EventHandler) EventHandler {
+		return EventHandlerFunc(func(ctx context.Context, message interface{}) (err error) {
+			start := time.Now()
+			err = next.Handle(ctx, message)
+
+			handled.Add(ctx, 1, attributes...)
+			duration.Record(ctx, float64(time.Since(start))/float64(time.Millisecond), attributes...)
+			if err != nil {
+				failed.Add(ctx, 1, attributes...)
+			}
+
+			return
+		})
+	}
+}
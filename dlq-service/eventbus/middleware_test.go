@@ -0,0 +1,109 @@
+package eventbus_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	eventbus "github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/eventbus"
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/eventbus/mocks"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.elastic.co/apm"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric/metrictest"
+)
+
+func TestChain_Order(t *testing.T) {
+	calls := make([]string, 0)
+	tag := func(name string) eventbus.Middleware {
+		return func(next eventbus.EventHandler) eventbus.EventHandler {
+			return eventbus.EventHandlerFunc(func(ctx context.Context, message interface{}) error {
+				calls = append(calls, name)
+				return next.Handle(ctx, message)
+			})
+		}
+	}
+
+	eventHandler := &mocks.EventHandler{}
+	eventHandler.On("Handle", mock.Anything, mock.Anything).Return(nil)
+
+	handler := eventbus.Chain(eventHandler, tag("first"), tag("second"))
+
+	assert.NoError(t, handler.Handle(context.TODO(), getCircuitBreakerMessage()))
+	assert.Equal(t, []string{"first", "second"}, calls)
+	eventHandler.AssertExpectations(t)
+}
+
+func TestRecoverMiddleware(t *testing.T) {
+	handler := eventbus.Chain(eventbus.EventHandlerFunc(func(ctx context.Context, message interface{}) error {
+		panic("boom")
+	}), eventbus.RecoverMiddleware())
+
+	err := handler.Handle(context.TODO(), getCircuitBreakerMessage())
+
+	var panicErr *eventbus.PanicError
+	assert.True(t, errors.As(err, &panicErr))
+	assert.Equal(t, "boom", panicErr.Value)
+	assert.NotEmpty(t, panicErr.Stack)
+}
+
+func TestTimeoutMiddleware(t *testing.T) {
+	handler := eventbus.Chain(eventbus.EventHandlerFunc(func(ctx context.Context, message interface{}) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}), eventbus.TimeoutMiddleware(time.Millisecond))
+
+	err := handler.Handle(context.TODO(), getCircuitBreakerMessage())
+
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+}
+
+func TestLoggingTracingMetricsMiddleware(t *testing.T) {
+	eventHandler := &mocks.EventHandler{}
+	eventHandler.On("Handle", mock.Anything, mock.Anything).Return(nil).Once()
+	eventHandler.On("Handle", mock.Anything, mock.Anything).Return(fmt.Errorf("error")).Once()
+	meterProvider := metrictest.NewMeterProvider()
+
+	handler := eventbus.Chain(eventHandler,
+		eventbus.LoggingMiddleware(logrus.New()),
+		eventbus.TracingMiddleware(eventbus.NewElasticAPMTracer(apm.DefaultTracer), "test-handle"),
+		eventbus.MetricsMiddleware(meterProvider.Meter("test"), "test-metrics"),
+	)
+
+	tx := apm.DefaultTracer.StartTransaction("test", "test")
+	defer tx.End()
+	ctx := apm.ContextWithTransaction(context.TODO(), tx)
+
+	assert.NoError(t, handler.Handle(ctx, getCircuitBreakerMessage()))
+	assert.Error(t, handler.Handle(ctx, getCircuitBreakerMessage()))
+
+	handlerName := attribute.String("handler", "test-metrics")
+	assert.Equal(t, int64(2), sumOf(meterProvider, "event_handler.handled", handlerName))
+	assert.Equal(t, int64(1), sumOf(meterProvider, "event_handler.failed", handlerName))
+	assert.Len(t, measurementsOf(meterProvider, "event_handler.duration", handlerName), 2)
+	eventHandler.AssertExpectations(t)
+}
+
+// measurementsOf returns the measurements of the instrument that have the attribute.
+func measurementsOf(meterProvider *metrictest.MeterProvider, name string, kv attribute.KeyValue) (measurements []metrictest.Measured) {
+	for _, measured := range metrictest.AsStructs(meterProvider.MeasurementBatches) {
+		if measured.Name == name && measured.Labels[kv.Key] == kv.Value {
+			measurements = append(measurements, measured)
+		}
+	}
+
+	return
+}
+
+// sumOf sums the measurements of the integer counter that have the attribute.
+func sumOf(meterProvider *metrictest.MeterProvider, name string, kv attribute.KeyValue) (sum int64) {
+	for _, measured := range measurementsOf(meterProvider, name, kv) {
+		sum += measured.Number.AsInt64()
+	}
+
+	return
+}
@@ -58,3 +58,23 @@ func (_m *SaramaConsumerGroup) Errors() <-chan error {
 
 	return r0
 }
+
+// Pause provides a mock function with given fields: partitions
+func (_m *SaramaConsumerGroup) Pause(partitions map[string][]int32) {
+	_m.Called(partitions)
+}
+
+// PauseAll provides a mock function with given fields:
+func (_m *SaramaConsumerGroup) PauseAll() {
+	_m.Called()
+}
+
+// Resume provides a mock function with given fields: partitions
+func (_m *SaramaConsumerGroup) Resume(partitions map[string][]int32) {
+	_m.Called(partitions)
+}
+
+// ResumeAll provides a mock function with given fields:
+func (_m *SaramaConsumerGroup) ResumeAll() {
+	_m.Called()
+}
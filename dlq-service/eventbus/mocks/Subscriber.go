@@ -9,6 +9,17 @@ type Subscriber struct {
 	mock.Mock
 }
 
+// AddTopics provides a mock function with given fields: topics
+func (_m *Subscriber) AddTopics(topics ...string) {
+	_va := make([]interface{}, len(topics))
+	for _i := range topics {
+		_va[_i] = topics[_i]
+	}
+	var _ca []interface{}
+	_ca = append(_ca, _va...)
+	_m.Called(_ca...)
+}
+
 // Close provides a mock function with given fields:
 func (_m *Subscriber) Close() error {
 	ret := _m.Called()
@@ -23,7 +34,44 @@ func (_m *Subscriber) Close() error {
 	return r0
 }
 
+// Pause provides a mock function with given fields: topic, partitions
+func (_m *Subscriber) Pause(topic string, partitions []int32) {
+	_m.Called(topic, partitions)
+}
+
+// RemoveTopics provides a mock function with given fields: topics
+func (_m *Subscriber) RemoveTopics(topics ...string) {
+	_va := make([]interface{}, len(topics))
+	for _i := range topics {
+		_va[_i] = topics[_i]
+	}
+	var _ca []interface{}
+	_ca = append(_ca, _va...)
+	_m.Called(_ca...)
+}
+
+// Resume provides a mock function with given fields: topic, partitions
+func (_m *Subscriber) Resume(topic string, partitions []int32) {
+	_m.Called(topic, partitions)
+}
+
 // Subscribe provides a mock function with given fields:
 func (_m *Subscriber) Subscribe() {
 	_m.Called()
 }
+
+// Topics provides a mock function with given fields:
+func (_m *Subscriber) Topics() []string {
+	ret := _m.Called()
+
+	var r0 []string
+	if rf, ok := ret.Get(0).(func() []string); ok {
+		r0 = rf()
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]string)
+		}
+	}
+
+	return r0
+}
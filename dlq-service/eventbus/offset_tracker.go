@@ -0,0 +1,56 @@
+package eventbus
+
+import (
+	"hash/fnv"
+	"sync"
+
+	"github.com/Shopify/sarama"
+)
+
+// offsetTracker marks the messages of a partition in the order they were dispatched,
+// so the marked offset never passes a message that is still in progress.
+type offsetTracker struct {
+	mu        sync.Mutex
+	session   sarama.ConsumerGroupSession
+	pending   []*sarama.ConsumerMessage
+	completed map[int64]bool
+}
+
+func newOffsetTracker(session sarama.ConsumerGroupSession) *offsetTracker {
+	return &offsetTracker{
+		session:   session,
+		pending:   make([]*sarama.ConsumerMessage, 0),
+		completed: make(map[int64]bool),
+	}
+}
+
+// add must be called in the order of the offsets, before the message is dispatched.
+func (t *offsetTracker) add(message *sarama.ConsumerMessage) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.pending = append(t.pending, message)
+}
+
+// complete will mark the lowest contiguous completed messages.
+func (t *offsetTracker) complete(message *sarama.ConsumerMessage) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.completed[message.Offset] = true
+
+	for len(t.pending) > 0 && t.completed[t.pending[0].Offset] {
+		head := t.pending[0]
+		t.session.MarkMessage(head, "")
+		delete(t.completed, head.Offset)
+		t.pending = t.pending[1:]
+	}
+}
+
+// workerOf returns the worker of the key, so messages with the same key are handled in order by the same worker.
+func workerOf(key []byte, workers int) int {
+	hash := fnv.New32a()
+	hash.Write(key)
+
+	return int(hash.Sum32() % uint32(workers))
+}
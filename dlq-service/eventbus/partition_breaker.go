@@ -0,0 +1,158 @@
+package eventbus
+
+import (
+	"errors"
+	"time"
+)
+
+// DefaultPartitionBreakerMaxProbes is the number of failed probes of a held message when `MaxProbes` is not set.
+const DefaultPartitionBreakerMaxProbes = 3
+
+// PartitionBreakerConfig is a configuration of the circuit breaker that pauses a partition of `DefaultSaramaConsumerGroupHandler`.
+//
+// FIELDS:
+//
+// `Pauser` will be called to suspend and continue fetching the partition, usually it is the `Subscriber`.
+//
+// `WindowSize` is the number of the latest handled messages that are taken into account.
+//
+// `FailureRatio` is the ratio of failed messages within the window (0 to 1) that opens the breaker.
+//
+// `CoolDown` is the duration to wait before the failed message is tried again as a probe, it must be positive.
+//
+// `MaxProbes` is the number of failed probes after which the held message is given up and sent to the DLQ handler,
+// so a poison message does not hold its partition forever. The next message is the new probe while the breaker stays open.
+type PartitionBreakerConfig struct {
+	Pauser       Pauser
+	WindowSize   int
+	FailureRatio float64
+	CoolDown     time.Duration
+	MaxProbes    int
+}
+
+// Validate will return an error when the breaker could not work with the configuration.
+func (c *PartitionBreakerConfig) Validate() (err error) {
+	switch {
+	case c.WindowSize < 1:
+		err = errors.New("circuit breaker window size must be positive")
+	case c.FailureRatio <= 0 || c.FailureRatio > 1:
+		err = errors.New("circuit breaker failure ratio must be greater than 0 and at most 1")
+	case c.CoolDown <= 0:
+		err = errors.New("circuit breaker cool-down must be positive")
+	case c.MaxProbes < 0:
+		err = errors.New("circuit breaker max probes must not be negative")
+	}
+
+	return
+}
+
+func (c *PartitionBreakerConfig) maxProbes() int {
+	if c.MaxProbes < 1 {
+		return DefaultPartitionBreakerMaxProbes
+	}
+	return c.MaxProbes
+}
+
+// failureWindow keeps the results of the latest handled messages.
+type failureWindow struct {
+	results []bool
+	next    int
+	filled  int
+	failed  int
+}
+
+func newFailureWindow(size int) *failureWindow {
+	if size < 1 {
+		size = 1
+	}
+	return &failureWindow{results: make([]bool, size)}
+}
+
+func (w *failureWindow) add(failed bool) {
+	if w.filled == len(w.results) {
+		if w.results[w.next] {
+			w.failed--
+		}
+	} else {
+		w.filled++
+	}
+
+	w.results[w.next] = failed
+	if failed {
+		w.failed++
+	}
+	w.next = (w.next + 1) % len(w.results)
+}
+
+func (w *failureWindow) full() bool {
+	return w.filled == len(w.results)
+}
+
+func (w *failureWindow) ratio() float64 {
+	if w.filled == 0 {
+		return 0
+	}
+	return float64(w.failed) / float64(w.filled)
+}
+
+func (w *failureWindow) reset() {
+	w.next, w.filled, w.failed = 0, 0, 0
+}
+
+// partitionBreaker is the circuit breaker state of a single claimed partition.
+// It is only used by the goroutine of the claim, so it is not guarded.
+type partitionBreaker struct {
+	config *PartitionBreakerConfig
+	window *failureWindow
+	open   bool
+	held   bool
+	probes int
+}
+
+func newPartitionBreaker(config *PartitionBreakerConfig) *partitionBreaker {
+	if config == nil {
+		return nil
+	}
+	return &partitionBreaker{
+		config: config,
+		window: newFailureWindow(config.WindowSize),
+	}
+}
+
+// record will store the result of a handled message and return true when the failed message is held by the open breaker.
+func (b *partitionBreaker) record(failed bool) bool {
+	if b == nil {
+		return false
+	}
+
+	if b.open {
+		if !failed {
+			b.open, b.held, b.probes = false, false, 0
+			b.window.reset()
+			return false
+		}
+
+		b.probes++
+		b.held = b.probes < b.config.maxProbes()
+		if !b.held {
+			b.probes = 0
+		}
+		return b.held
+	}
+
+	b.window.add(failed)
+	if b.window.full() && b.window.ratio() >= b.config.FailureRatio {
+		b.open = true
+	}
+
+	b.held = b.open && failed
+	return b.held
+}
+
+func (b *partitionBreaker) isOpen() bool {
+	return b != nil && b.open
+}
+
+func (b *partitionBreaker) holds() bool {
+	return b != nil && b.held
+}
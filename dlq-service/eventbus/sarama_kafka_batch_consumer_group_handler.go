@@ -0,0 +1,220 @@
+package eventbus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+// BatchSaramaConsumerGroupHandlerConfig is a configuration of `BatchSaramaConsumerGroupHandler`.
+//
+// FIELDS:
+//
+// `BatchSize` is the maximum number of messages of a batch.
+//
+// `FlushInterval` is the maximum duration to wait for a batch to be full, counted from its first message.
+//
+// `MaxRetries` is the number of times the failed messages that could not be sent to the DLQ handler are handled again.
+// When they still fail, the claim is ended without marking the batch, so the session is closed and the batch is redelivered.
+//
+// `RetryBackoff` is the duration to wait before the first retry, it is doubled on every next retry.
+type BatchSaramaConsumerGroupHandlerConfig struct {
+	BatchSize     int
+	FlushInterval time.Duration
+	MaxRetries    int
+	RetryBackoff  time.Duration
+}
+
+// ErrBatchNotHandled is returned by `BatchSaramaConsumerGroupHandler.ConsumeClaim` when the messages of a batch are neither handled nor sent to the DLQ handler.
+var ErrBatchNotHandled = errors.New("batch is not handled")
+
+// PermanentError is an error of a message that would fail the same way when it is handled again, e.g. a message that could not be decoded.
+// `BatchSaramaConsumerGroupHandler` does not retry it, and the message is dropped when there is no DLQ handler.
+type PermanentError struct {
+	Err error
+}
+
+func (e *PermanentError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *PermanentError) Unwrap() error {
+	return e.Err
+}
+
+// BatchSaramaConsumerGroupHandler is a consumer group handler for sarama kafka client that handles the messages of a claim in batches.
+// It is the implementation of `sarama.KafkaConsumerGroupHandler`
+type BatchSaramaConsumerGroupHandler struct {
+	tracer            Tracer
+	serviceName       string
+	consumerGroup     string
+	batchEventHandler BatchEventHandler
+	dlqHandler        DLQHandler
+	config            *BatchSaramaConsumerGroupHandlerConfig
+}
+
+// NewBatchSaramaConsumerGroupHandler is a constructor.
+func NewBatchSaramaConsumerGroupHandler(tracer Tracer, serviceName string, batchEventHandler BatchEventHandler, dlqHandler DLQHandler, config *BatchSaramaConsumerGroupHandlerConfig) *BatchSaramaConsumerGroupHandler {
+	return &BatchSaramaConsumerGroupHandler{
+		tracer:            tracerOrNoop(tracer),
+		serviceName:       serviceName,
+		batchEventHandler: batchEventHandler,
+		dlqHandler:        dlqHandler,
+		config:            config,
+	}
+}
+
+// SetConsumerGroup sets the consumer group that is recorded in the DLQ messages.
+func (consumer *BatchSaramaConsumerGroupHandler) SetConsumerGroup(consumerGroup string) {
+	consumer.consumerGroup = consumerGroup
+}
+
+// Setup is run at the beginning of a new session, before ConsumeClaim
+func (consumer *BatchSaramaConsumerGroupHandler) Setup(sarama.ConsumerGroupSession) error {
+	return nil
+}
+
+// Cleanup is run at the end of a session, once all ConsumeClaim goroutines have exited
+func (consumer *BatchSaramaConsumerGroupHandler) Cleanup(sarama.ConsumerGroupSession) error {
+	return nil
+}
+
+// ConsumeClaim must start a consumer loop of ConsumerGroupClaim's Messages().
+// The offsets are marked once the whole batch is handled, the failed messages are handled when they are sent to the DLQ handler.
+// A batch that is not handled ends the claim with `ErrBatchNotHandled`, so the session is closed and the batch is redelivered.
+func (consumer *BatchSaramaConsumerGroupHandler) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	batch := make([]*sarama.ConsumerMessage, 0, consumer.config.BatchSize)
+	var flushTimeout <-chan time.Time
+
+	flush := func() (err error) {
+		if len(batch) > 0 {
+			if err = consumer.claim(session.Context(), batch); err != nil {
+				return
+			}
+			session.MarkMessage(batch[len(batch)-1], "")
+		}
+		batch = make([]*sarama.ConsumerMessage, 0, consumer.config.BatchSize)
+		flushTimeout = nil
+
+		return
+	}
+
+	for {
+		select {
+		case message, ok := <-claim.Messages():
+			if !ok {
+				return flush()
+			}
+
+			batch = append(batch, message)
+			if len(batch) == 1 {
+				flushTimeout = time.After(consumer.config.FlushInterval)
+			}
+			if len(batch) >= consumer.config.BatchSize {
+				if err := flush(); err != nil {
+					return err
+				}
+			}
+		case <-flushTimeout:
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// claim will handle the batch and return an error when any of its messages is neither handled nor sent to the DLQ handler.
+func (consumer *BatchSaramaConsumerGroupHandler) claim(ctx context.Context, batch []*sarama.ConsumerMessage) (err error) {
+	txName := fmt.Sprintf("On Batch: %s", batch[0].Topic)
+	txType := "Kafka Consumer"
+
+	tx, ctx := consumer.tracer.StartTransaction(ctx, txName, txType, nil)
+	defer tx.End()
+
+	pending := consumer.claimOnce(ctx, batch)
+	backoff := consumer.config.RetryBackoff
+	for retry := 0; len(pending) > 0 && retry < consumer.config.MaxRetries && ctx.Err() == nil; retry++ {
+		select {
+		case <-ctx.Done():
+			continue
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+		pending = consumer.claimOnce(ctx, pending)
+	}
+
+	if len(pending) > 0 {
+		err = fmt.Errorf("%w: %d of %d messages of %s partition %d", ErrBatchNotHandled, len(pending), len(batch), batch[0].Topic, batch[0].Partition)
+		tx.SetResult(err.Error())
+
+		return
+	}
+
+	tx.SetResult("Success")
+
+	return
+}
+
+// claimOnce will handle the messages and return the ones that are failed and could not be sent to the DLQ handler.
+func (consumer *BatchSaramaConsumerGroupHandler) claimOnce(ctx context.Context, batch []*sarama.ConsumerMessage) (pending []*sarama.ConsumerMessage) {
+	failures := consumer.handle(ctx, batch)
+	for i, err := range failures {
+		if i < 0 || i >= len(batch) || err == nil {
+			continue
+		}
+
+		var permanentErr *PermanentError
+		if consumer.dlqHandler == nil && errors.As(err, &permanentErr) {
+			continue
+		}
+
+		if consumer.sendToDLQ(ctx, batch[i], err) != nil {
+			pending = append(pending, batch[i])
+		}
+	}
+
+	return
+}
+
+// handle will call the batch event handler and recover its panic as a `*PanicError` of every message of the batch.
+func (consumer *BatchSaramaConsumerGroupHandler) handle(ctx context.Context, batch []*sarama.ConsumerMessage) (failures BatchFailures) {
+	defer func() {
+		if r := recover(); r != nil {
+			err := &PanicError{Value: r, Stack: debug.Stack()}
+			failures = BatchFailures{}
+			for i := range batch {
+				failures[i] = err
+			}
+		}
+	}()
+
+	messages := make([]interface{}, len(batch))
+	for i, message := range batch {
+		messages[i] = message
+	}
+
+	failures = consumer.batchEventHandler.HandleBatch(ctx, messages)
+	return
+}
+
+// sendToDLQ will return the error of the message when there is no DLQ handler, so the message is not considered handled.
+func (consumer *BatchSaramaConsumerGroupHandler) sendToDLQ(ctx context.Context, message *sarama.ConsumerMessage, err error) error {
+	if consumer.dlqHandler == nil {
+		return err
+	}
+
+	span, ctx := consumer.tracer.StartSpan(ctx, fmt.Sprintf("DLQ Send: %s", message.Topic), "eventbus.dlq")
+	defer span.End()
+
+	if sendErr := consumer.dlqHandler.Send(ctx, newDeadLetterQueueMessage(consumer.serviceName, consumer.consumerGroup, message, err)); sendErr != nil {
+		span.RecordError(sendErr)
+		return sendErr
+	}
+
+	return nil
+}
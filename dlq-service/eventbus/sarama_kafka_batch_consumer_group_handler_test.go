@@ -0,0 +1,206 @@
+package eventbus_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	eventbus "github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/eventbus"
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/eventbus/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.elastic.co/apm"
+)
+
+func getBatchConsumerMessageMock(count int, closed bool) <-chan *sarama.ConsumerMessage {
+	messageChan := make(chan *sarama.ConsumerMessage, count)
+
+	for i := 0; i < count; i++ {
+		messageChan <- &sarama.ConsumerMessage{
+			Key:       []byte(fmt.Sprintf("test-key-%d", i)),
+			Value:     []byte("test-message"),
+			Partition: int32(1),
+			Offset:    int64(i),
+			Topic:     "test-topic",
+		}
+	}
+
+	if closed {
+		close(messageChan)
+	}
+
+	return messageChan
+}
+
+func TestBatchSaramaConsumerGroupHandler_FlushBySizeAndPartialFailure(t *testing.T) {
+	batchEventHandler := &mocks.BatchEventHandler{}
+	batchEventHandler.On("HandleBatch", mock.Anything, mock.MatchedBy(func(messages []interface{}) bool {
+		return len(messages) == 2
+	})).Return(eventbus.BatchFailures{1: fmt.Errorf("error")}).Once()
+	batchEventHandler.On("HandleBatch", mock.Anything, mock.MatchedBy(func(messages []interface{}) bool {
+		return len(messages) == 1
+	})).Return(nil).Once()
+
+	dlqHandler := &mocks.DLQHandler{}
+	dlqHandler.On("Send", mock.Anything, mock.MatchedBy(func(dlqMessage *eventbus.DeadLetterQueueMessage) bool {
+		return string(dlqMessage.Key) == "test-key-1" && dlqMessage.CausedBy == "error"
+	})).Return(nil).Once()
+
+	cgSess := &mocks.SaramaConsumerGroupSession{}
+	cgSess.On("MarkMessage", mock.MatchedBy(func(message *sarama.ConsumerMessage) bool { return message.Offset == 1 }), "").Once()
+	cgSess.On("MarkMessage", mock.MatchedBy(func(message *sarama.ConsumerMessage) bool { return message.Offset == 2 }), "").Once()
+	cgSess.On("Context").Return(context.TODO())
+
+	cgClaim := &mocks.SaramaConsumerGroupClaim{}
+	cgClaim.On("Messages").Return(getBatchConsumerMessageMock(3, true))
+
+	cgh := eventbus.NewBatchSaramaConsumerGroupHandler(eventbus.NewElasticAPMTracer(apm.DefaultTracer), "service-test", batchEventHandler, dlqHandler, &eventbus.BatchSaramaConsumerGroupHandlerConfig{
+		BatchSize:     2,
+		FlushInterval: time.Hour,
+	})
+	cgh.Setup(cgSess)
+	cgh.ConsumeClaim(cgSess, cgClaim)
+	cgh.Cleanup(cgSess)
+
+	cgSess.AssertExpectations(t)
+	batchEventHandler.AssertExpectations(t)
+	dlqHandler.AssertExpectations(t)
+}
+
+func TestBatchSaramaConsumerGroupHandler_FlushByInterval(t *testing.T) {
+	flushed := make(chan struct{})
+
+	batchEventHandler := &mocks.BatchEventHandler{}
+	batchEventHandler.On("HandleBatch", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		close(flushed)
+	}).Return(nil).Once()
+
+	cgSess := &mocks.SaramaConsumerGroupSession{}
+	cgSess.On("MarkMessage", mock.AnythingOfType("*sarama.ConsumerMessage"), "").Once()
+	cgSess.On("Context").Return(context.TODO())
+
+	cgClaim := &mocks.SaramaConsumerGroupClaim{}
+	cgClaim.On("Messages").Return(getBatchConsumerMessageMock(2, false))
+
+	cgh := eventbus.NewBatchSaramaConsumerGroupHandler(eventbus.NewElasticAPMTracer(apm.DefaultTracer), "service-test", batchEventHandler, nil, &eventbus.BatchSaramaConsumerGroupHandlerConfig{
+		BatchSize:     10,
+		FlushInterval: time.Millisecond * 10,
+	})
+	go cgh.ConsumeClaim(cgSess, cgClaim)
+
+	select {
+	case <-flushed:
+	case <-time.After(time.Second):
+		t.Fatal("batch is not flushed by interval")
+	}
+	<-time.After(time.Millisecond * 10)
+
+	batchEventHandler.AssertExpectations(t)
+	cgSess.AssertExpectations(t)
+}
+
+func TestBatchSaramaConsumerGroupHandler_Panic(t *testing.T) {
+	batchEventHandler := &mocks.BatchEventHandler{}
+	batchEventHandler.On("HandleBatch", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		panic("boom")
+	})
+
+	dlqHandler := &mocks.DLQHandler{}
+	dlqHandler.On("Send", mock.Anything, mock.MatchedBy(func(dlqMessage *eventbus.DeadLetterQueueMessage) bool {
+		return dlqMessage.CausedBy == "boom"
+	})).Return(nil).Twice()
+
+	cgSess := &mocks.SaramaConsumerGroupSession{}
+	cgSess.On("MarkMessage", mock.AnythingOfType("*sarama.ConsumerMessage"), "").Once()
+	cgSess.On("Context").Return(context.TODO())
+
+	cgClaim := &mocks.SaramaConsumerGroupClaim{}
+	cgClaim.On("Messages").Return(getBatchConsumerMessageMock(2, true))
+
+	cgh := eventbus.NewBatchSaramaConsumerGroupHandler(eventbus.NewElasticAPMTracer(apm.DefaultTracer), "service-test", batchEventHandler, dlqHandler, &eventbus.BatchSaramaConsumerGroupHandlerConfig{
+		BatchSize:     10,
+		FlushInterval: time.Hour,
+	})
+	cgh.ConsumeClaim(cgSess, cgClaim)
+
+	cgSess.AssertExpectations(t)
+	dlqHandler.AssertExpectations(t)
+}
+
+func TestBatchSaramaConsumerGroupHandler_NotHandled_WithoutDLQHandler(t *testing.T) {
+	batchEventHandler := &mocks.BatchEventHandler{}
+	batchEventHandler.On("HandleBatch", mock.Anything, mock.Anything).Return(eventbus.BatchFailures{0: fmt.Errorf("error"), 1: fmt.Errorf("error")}).Times(3)
+
+	cgSess := &mocks.SaramaConsumerGroupSession{}
+	cgSess.On("Context").Return(context.TODO())
+
+	cgClaim := &mocks.SaramaConsumerGroupClaim{}
+	cgClaim.On("Messages").Return(getBatchConsumerMessageMock(2, true))
+
+	cgh := eventbus.NewBatchSaramaConsumerGroupHandler(eventbus.NewElasticAPMTracer(apm.DefaultTracer), "service-test", batchEventHandler, nil, &eventbus.BatchSaramaConsumerGroupHandlerConfig{
+		BatchSize:     10,
+		FlushInterval: time.Hour,
+		MaxRetries:    2,
+		RetryBackoff:  time.Millisecond,
+	})
+	err := cgh.ConsumeClaim(cgSess, cgClaim)
+
+	assert.ErrorIs(t, err, eventbus.ErrBatchNotHandled)
+	batchEventHandler.AssertExpectations(t)
+	cgSess.AssertNotCalled(t, "MarkMessage", mock.Anything, mock.Anything)
+}
+
+func TestBatchSaramaConsumerGroupHandler_RetryFailedMessages(t *testing.T) {
+	batchEventHandler := &mocks.BatchEventHandler{}
+	batchEventHandler.On("HandleBatch", mock.Anything, mock.MatchedBy(func(messages []interface{}) bool {
+		return len(messages) == 2
+	})).Return(eventbus.BatchFailures{1: fmt.Errorf("error")}).Once()
+	batchEventHandler.On("HandleBatch", mock.Anything, mock.MatchedBy(func(messages []interface{}) bool {
+		return len(messages) == 1 && messages[0].(*sarama.ConsumerMessage).Offset == 1
+	})).Return(nil).Once()
+
+	cgSess := &mocks.SaramaConsumerGroupSession{}
+	cgSess.On("MarkMessage", mock.MatchedBy(func(message *sarama.ConsumerMessage) bool { return message.Offset == 1 }), "").Once()
+	cgSess.On("Context").Return(context.TODO())
+
+	cgClaim := &mocks.SaramaConsumerGroupClaim{}
+	cgClaim.On("Messages").Return(getBatchConsumerMessageMock(2, true))
+
+	cgh := eventbus.NewBatchSaramaConsumerGroupHandler(eventbus.NewElasticAPMTracer(apm.DefaultTracer), "service-test", batchEventHandler, nil, &eventbus.BatchSaramaConsumerGroupHandlerConfig{
+		BatchSize:     10,
+		FlushInterval: time.Hour,
+		MaxRetries:    2,
+		RetryBackoff:  time.Millisecond,
+	})
+	err := cgh.ConsumeClaim(cgSess, cgClaim)
+
+	assert.NoError(t, err)
+	batchEventHandler.AssertExpectations(t)
+	cgSess.AssertExpectations(t)
+}
+
+func TestBatchSaramaConsumerGroupHandler_DropPermanentError_WithoutDLQHandler(t *testing.T) {
+	batchEventHandler := &mocks.BatchEventHandler{}
+	batchEventHandler.On("HandleBatch", mock.Anything, mock.Anything).Return(eventbus.BatchFailures{0: &eventbus.PermanentError{Err: fmt.Errorf("error")}}).Once()
+
+	cgSess := &mocks.SaramaConsumerGroupSession{}
+	cgSess.On("MarkMessage", mock.MatchedBy(func(message *sarama.ConsumerMessage) bool { return message.Offset == 1 }), "").Once()
+	cgSess.On("Context").Return(context.TODO())
+
+	cgClaim := &mocks.SaramaConsumerGroupClaim{}
+	cgClaim.On("Messages").Return(getBatchConsumerMessageMock(2, true))
+
+	cgh := eventbus.NewBatchSaramaConsumerGroupHandler(eventbus.NewElasticAPMTracer(apm.DefaultTracer), "service-test", batchEventHandler, nil, &eventbus.BatchSaramaConsumerGroupHandlerConfig{
+		BatchSize:     10,
+		FlushInterval: time.Hour,
+		MaxRetries:    2,
+		RetryBackoff:  time.Millisecond,
+	})
+	err := cgh.ConsumeClaim(cgSess, cgClaim)
+
+	assert.NoError(t, err)
+	batchEventHandler.AssertExpectations(t)
+	cgSess.AssertExpectations(t)
+}
@@ -2,6 +2,7 @@ package eventbus
 
 import (
 	"context"
+	"sync"
 
 	"github.com/Shopify/sarama"
 	"github.com/sirupsen/logrus"
@@ -17,7 +18,7 @@ import (
 // `ConsumerGroupHandler` is an implementation of `sarama.ConsumerGroupHandler`.
 //
 //
-// `Topics` is a kafka topic to be subscribed.
+// `Topics` is a kafka topic to be subscribed. It is only the initial set, use `AddTopics` and `RemoveTopics` to change it at runtime.
 type SaramaKafkaConsumserGroupAdapterConfig struct {
 	ConsumerGroupClient  sarama.ConsumerGroup
 	ConsumerGroupHandler sarama.ConsumerGroupHandler
@@ -26,9 +27,14 @@ type SaramaKafkaConsumserGroupAdapterConfig struct {
 
 // SaramaKafkaConsumserGroupAdapter is an adapter for eventbus's subcriber
 type SaramaKafkaConsumserGroupAdapter struct {
-	logger    *logrus.Logger
-	closeChan chan struct{}
-	config    *SaramaKafkaConsumserGroupAdapterConfig
+	logger      *logrus.Logger
+	closeChan   chan struct{}
+	restartChan chan struct{}
+	config      *SaramaKafkaConsumserGroupAdapterConfig
+
+	mu     sync.RWMutex
+	topics []string
+	cancel context.CancelFunc
 }
 
 // NewSaramaKafkaConsumserGroupAdapter is a constructor
@@ -36,7 +42,14 @@ type SaramaKafkaConsumserGroupAdapter struct {
 // This Constructor is deprecated and use `NewSaramaKafkaConsumerGroupFullConfigAdapter` instead.
 func NewSaramaKafkaConsumserGroupAdapter(logger *logrus.Logger, config *SaramaKafkaConsumserGroupAdapterConfig) Subscriber {
 	closeChan := make(chan struct{}, 1)
-	return &SaramaKafkaConsumserGroupAdapter{logger, closeChan, config}
+	restartChan := make(chan struct{}, 1)
+	return &SaramaKafkaConsumserGroupAdapter{
+		logger:      logger,
+		closeChan:   closeChan,
+		restartChan: restartChan,
+		config:      config,
+		topics:      uniqueTopics(nil, config.Topics),
+	}
 }
 
 // Subscribe will consume the published message
@@ -48,10 +61,31 @@ func (skcga *SaramaKafkaConsumserGroupAdapter) Subscribe() {
 			case <-skcga.closeChan:
 				break POLL
 			default:
-				err := skcga.config.ConsumerGroupClient.Consume(context.Background(), skcga.config.Topics, skcga.config.ConsumerGroupHandler)
+				ctx, cancel := context.WithCancel(context.Background())
+
+				// The topics and the cancel function are swapped together, so a concurrent change is either
+				// picked up here or cancels the session that is about to start.
+				skcga.mu.Lock()
+				topics := append([]string{}, skcga.topics...)
+				skcga.cancel = cancel
+				skcga.mu.Unlock()
+
+				if len(topics) < 1 {
+					cancel()
+					// Nothing to consume, wait until a topic is added or the consumer is closed.
+					select {
+					case <-skcga.closeChan:
+						break POLL
+					case <-skcga.restartChan:
+						continue POLL
+					}
+				}
+
+				err := skcga.config.ConsumerGroupClient.Consume(ctx, topics, skcga.config.ConsumerGroupHandler)
 				if err != nil {
 					skcga.logger.Errorf("[Sarama] %s", err.Error())
 				}
+				cancel()
 			}
 		}
 	}()
@@ -59,6 +93,74 @@ func (skcga *SaramaKafkaConsumserGroupAdapter) Subscribe() {
 	return
 }
 
+// Topics returns the topics that are currently subscribed.
+func (skcga *SaramaKafkaConsumserGroupAdapter) Topics() (topics []string) {
+	skcga.mu.RLock()
+	defer skcga.mu.RUnlock()
+
+	topics = make([]string, len(skcga.topics))
+	copy(topics, skcga.topics)
+
+	return
+}
+
+// AddTopics will add the topics to the subscription and restart the consumer loop.
+func (skcga *SaramaKafkaConsumserGroupAdapter) AddTopics(topics ...string) {
+	skcga.mu.Lock()
+	skcga.topics = uniqueTopics(skcga.topics, topics)
+	skcga.restart()
+	skcga.mu.Unlock()
+
+	skcga.logger.Infof("[Sarama] Consumer is restarted with topics %v", skcga.Topics())
+}
+
+// RemoveTopics will remove the topics from the subscription and restart the consumer loop.
+func (skcga *SaramaKafkaConsumserGroupAdapter) RemoveTopics(topics ...string) {
+	removed := make(map[string]bool)
+	for _, topic := range topics {
+		removed[topic] = true
+	}
+
+	skcga.mu.Lock()
+	remaining := make([]string, 0, len(skcga.topics))
+	for _, topic := range skcga.topics {
+		if !removed[topic] {
+			remaining = append(remaining, topic)
+		}
+	}
+	skcga.topics = remaining
+	skcga.restart()
+	skcga.mu.Unlock()
+
+	skcga.logger.Infof("[Sarama] Consumer is restarted with topics %v", skcga.Topics())
+}
+
+// Pause will stop fetching the messages of the partitions until they are resumed.
+// The partitions are paused for the current session only, a rebalance will resume them.
+func (skcga *SaramaKafkaConsumserGroupAdapter) Pause(topic string, partitions []int32) {
+	skcga.config.ConsumerGroupClient.Pause(map[string][]int32{topic: partitions})
+	skcga.logger.Infof("[Sarama] Consumer is paused on topic %s partitions %v", topic, partitions)
+}
+
+// Resume will continue fetching the messages of the partitions that were paused.
+func (skcga *SaramaKafkaConsumserGroupAdapter) Resume(topic string, partitions []int32) {
+	skcga.config.ConsumerGroupClient.Resume(map[string][]int32{topic: partitions})
+	skcga.logger.Infof("[Sarama] Consumer is resumed on topic %s partitions %v", topic, partitions)
+}
+
+// restart will end the current session so the consumer loop joins the group again with the latest topics.
+// The caller must hold the lock.
+func (skcga *SaramaKafkaConsumserGroupAdapter) restart() {
+	if skcga.cancel != nil {
+		skcga.cancel()
+	}
+
+	select {
+	case skcga.restartChan <- struct{}{}:
+	default:
+	}
+}
+
 // Close will stop the kafka consumer
 func (skcga *SaramaKafkaConsumserGroupAdapter) Close() (err error) {
 	defer close(skcga.closeChan)
@@ -74,10 +176,29 @@ func (skcga *SaramaKafkaConsumserGroupAdapter) Close() (err error) {
 	return
 }
 
+func uniqueTopics(current []string, additional []string) (topics []string) {
+	seen := make(map[string]bool)
+	topics = make([]string, 0, len(current)+len(additional))
+
+	for _, topic := range append(append([]string{}, current...), additional...) {
+		if topic == "" || seen[topic] {
+			continue
+		}
+		seen[topic] = true
+		topics = append(topics, topic)
+	}
+
+	return
+}
+
 // SaramaConsumerGroup is an interface that purposed for mock creation for unit testing.
 // Do not use this for an implementation.
 type SaramaConsumerGroup interface {
 	Consume(ctx context.Context, topics []string, handler sarama.ConsumerGroupHandler) error
 	Errors() <-chan error
 	Close() error
+	Pause(partitions map[string][]int32)
+	Resume(partitions map[string][]int32)
+	PauseAll()
+	ResumeAll()
 }
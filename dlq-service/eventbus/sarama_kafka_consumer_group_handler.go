@@ -4,34 +4,64 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"runtime/debug"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/Shopify/sarama"
-	"go.elastic.co/apm"
 )
 
 // DefaultSaramaConsumerGroupHandler is a default consumer group handler for sarama kafka client.
 // Create your own to address some customization.
 // It is the implementation of `sarama.KafkaConsumerGroupHandler`
 type DefaultSaramaConsumerGroupHandler struct {
-	utcTZ        *time.Location
-	tracer       *apm.Tracer
-	serviceName  string
-	eventHandler EventHandler
-	dlqHandler   DLQHandler
+	tracer        Tracer
+	serviceName   string
+	consumerGroup string
+	eventHandler  EventHandler
+	dlqHandler    DLQHandler
+	breaker       *PartitionBreakerConfig
+	workers       int
+	redactor      Redactor
 }
 
-// NewDefaultSaramaConsumerGroupHandler is a constructor.
-func NewDefaultSaramaConsumerGroupHandler(tracer *apm.Tracer, serviceName string, eventHandler EventHandler, dlqHandler DLQHandler) *DefaultSaramaConsumerGroupHandler {
-	utcTz, _ := time.LoadLocation("UTC")
+// NewDefaultSaramaConsumerGroupHandler is a constructor, the nil tracer records nothing.
+func NewDefaultSaramaConsumerGroupHandler(tracer Tracer, serviceName string, eventHandler EventHandler, dlqHandler DLQHandler) *DefaultSaramaConsumerGroupHandler {
 	return &DefaultSaramaConsumerGroupHandler{
-		utcTZ:        utcTz,
-		tracer:       tracer,
+		tracer:       tracerOrNoop(tracer),
+		serviceName:  serviceName,
 		eventHandler: eventHandler,
 		dlqHandler:   dlqHandler,
 	}
 }
 
+// SetPartitionBreaker enables the circuit breaker that pauses a partition when the handler keeps failing.
+// While the breaker is open, the failed message is held instead of being sent to the DLQ handler,
+// and it is tried again after the cool-down. The partition is resumed once the probe succeeds,
+// or once the message is given up after `MaxProbes` failed probes, so the next message can be fetched as the probe.
+func (consumer *DefaultSaramaConsumerGroupHandler) SetPartitionBreaker(config *PartitionBreakerConfig) {
+	consumer.breaker = config
+}
+
+// SetConcurrency enables handling the messages of a partition by the workers concurrently.
+// The messages are distributed by the hash of their key, so the messages with the same key are still handled in order.
+// The offsets are only marked up to the lowest message that is not completed yet.
+// The partition breaker is not applied in this mode, wrap the event handler with `CircuitBreakerMiddleware` instead.
+func (consumer *DefaultSaramaConsumerGroupHandler) SetConcurrency(workers int) {
+	consumer.workers = workers
+}
+
+// SetRedactor redacts the payloads and the header values of the messages that are logged without an event handler.
+func (consumer *DefaultSaramaConsumerGroupHandler) SetRedactor(redactor Redactor) {
+	consumer.redactor = redactor
+}
+
+// SetConsumerGroup sets the consumer group that is recorded in the DLQ messages.
+func (consumer *DefaultSaramaConsumerGroupHandler) SetConsumerGroup(consumerGroup string) {
+	consumer.consumerGroup = consumerGroup
+}
+
 // Setup is run at the beginning of a new session, before ConsumeClaim
 func (consumer *DefaultSaramaConsumerGroupHandler) Setup(sarama.ConsumerGroupSession) error {
 	// Mark the consumer as ready
@@ -51,39 +81,153 @@ func (consumer *DefaultSaramaConsumerGroupHandler) ConsumeClaim(session sarama.C
 	// Do not move the code below to a goroutine.
 	// The `ConsumeClaim` itself is called within a goroutine, see:
 	// https://github.com/Shopify/sarama/blob/master/consumer_group.go#L27-L29
+	if consumer.workers > 1 {
+		return consumer.consumeClaimConcurrently(session, claim)
+	}
+
+	breaker := newPartitionBreaker(consumer.breaker)
+	paused := false
+
 	for message := range claim.Messages() {
-		consumer.claim(session.Context(), message)
+		for {
+			if err := consumer.claim(session.Context(), message, breaker); err == nil || !breaker.holds() {
+				break
+			}
+
+			if !paused {
+				log.Printf("Circuit breaker is open: topic = %s, partition = %d, offset = %d", message.Topic, message.Partition, message.Offset)
+				consumer.pause(message.Topic, message.Partition)
+				paused = true
+			}
+
+			select {
+			case <-session.Context().Done():
+				return nil
+			case <-time.After(consumer.breaker.CoolDown):
+			}
+		}
+
+		if paused {
+			if breaker.isOpen() {
+				log.Printf("Circuit breaker gave up the message: topic = %s, partition = %d, offset = %d", message.Topic, message.Partition, message.Offset)
+			} else {
+				log.Printf("Circuit breaker is closed: topic = %s, partition = %d, offset = %d", message.Topic, message.Partition, message.Offset)
+			}
+			consumer.resume(message.Topic, message.Partition)
+			paused = false
+		}
+
 		session.MarkMessage(message, "")
 	}
 
 	return nil
 }
 
-func (consumer *DefaultSaramaConsumerGroupHandler) claim(ctx context.Context, message *sarama.ConsumerMessage) {
+func (consumer *DefaultSaramaConsumerGroupHandler) consumeClaimConcurrently(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	tracker := newOffsetTracker(session)
+	queues := make([]chan *sarama.ConsumerMessage, consumer.workers)
+
+	var wg sync.WaitGroup
+	for i := range queues {
+		queues[i] = make(chan *sarama.ConsumerMessage, 1)
+
+		wg.Add(1)
+		go func(queue <-chan *sarama.ConsumerMessage) {
+			defer wg.Done()
+			for message := range queue {
+				// Once the session is done, the remaining messages are left unmarked to be redelivered.
+				if session.Context().Err() != nil {
+					continue
+				}
+				consumer.claim(session.Context(), message, nil)
+				tracker.complete(message)
+			}
+		}(queues[i])
+	}
+
+	for message := range claim.Messages() {
+		tracker.add(message)
+		queues[workerOf(message.Key, consumer.workers)] <- message
+	}
+
+	for _, queue := range queues {
+		close(queue)
+	}
+	wg.Wait()
+
+	return nil
+}
+
+func (consumer *DefaultSaramaConsumerGroupHandler) pause(topic string, partition int32) {
+	if consumer.breaker.Pauser != nil {
+		consumer.breaker.Pauser.Pause(topic, []int32{partition})
+	}
+}
+
+func (consumer *DefaultSaramaConsumerGroupHandler) resume(topic string, partition int32) {
+	if consumer.breaker.Pauser != nil {
+		consumer.breaker.Pauser.Resume(topic, []int32{partition})
+	}
+}
+
+func (consumer *DefaultSaramaConsumerGroupHandler) claim(ctx context.Context, message *sarama.ConsumerMessage, breaker *partitionBreaker) (err error) {
 	txName := fmt.Sprintf("On Event: %s", message.Topic)
 	txType := "Kafka Consumer"
 	txSuccess := "Success"
 
-	tx := consumer.tracer.StartTransaction(txName, txType)
+	// The transaction continues the trace of the producer, e.g. the one that sent the message to the DLQ.
+	tx, ctx := consumer.tracer.StartTransaction(ctx, txName, txType, MessageHeadersOf(message.Headers))
 	defer tx.End()
 
-	ctx = apm.ContextWithTransaction(ctx, tx)
-
 	if consumer.eventHandler == nil {
 		consumer.printMessage(message)
-		tx.Result = txSuccess
+		tx.SetResult(txSuccess)
 		return
 	}
 
-	if err := consumer.eventHandler.Handle(ctx, message); err != nil {
+	if err = consumer.handle(ctx, message); err != nil {
+		tx.SetResult(err.Error())
+		if breaker.record(true) {
+			// The message is held by the open breaker and will be tried again.
+			return
+		}
 		consumer.sendToDLQ(ctx, message, err)
-		tx.Result = err.Error()
+		return
 	}
+
+	breaker.record(false)
+	tx.SetResult(txSuccess)
+	return
+}
+
+// handle will call the event handler and recover its panic as a `*PanicError`, so the claim continues with the next message.
+func (consumer *DefaultSaramaConsumerGroupHandler) handle(ctx context.Context, message *sarama.ConsumerMessage) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &PanicError{Value: r, Stack: debug.Stack()}
+		}
+	}()
+
+	err = consumer.eventHandler.Handle(ctx, message)
 	return
 }
 
 func (consumer *DefaultSaramaConsumerGroupHandler) printMessage(message *sarama.ConsumerMessage) {
-	log.Printf("Message claimed: value = %s, timestamp = %v, topic = %s, partition = %d", string(message.Value), message.Timestamp, message.Topic, message.Partition)
+	value := message.Value
+	headers := make([]string, 0, len(message.Headers))
+	for _, header := range message.Headers {
+		headerValue := header.Value
+		if consumer.redactor != nil {
+			headerValue = consumer.redactor.Header(string(header.Key), headerValue)
+		}
+		headers = append(headers, fmt.Sprintf("%s=%s", header.Key, headerValue))
+	}
+	if consumer.redactor != nil {
+		value = consumer.redactor.Payload(value)
+	}
+
+	log.Printf("Message claimed: value = %s, headers = [%s], timestamp = %v, topic = %s, partition = %d",
+		string(value), strings.Join(headers, ", "), message.Timestamp, message.Topic, message.Partition)
 }
 
 func (consumer *DefaultSaramaConsumerGroupHandler) sendToDLQ(ctx context.Context, message *sarama.ConsumerMessage, err error) {
@@ -91,24 +235,14 @@ func (consumer *DefaultSaramaConsumerGroupHandler) sendToDLQ(ctx context.Context
 		return
 	}
 
-	originalHeaders := MessageHeaders{}
+	span, ctx := consumer.tracer.StartSpan(ctx, fmt.Sprintf("DLQ Send: %s", message.Topic), "eventbus.dlq")
+	defer span.End()
 
-	for _, header := range message.Headers {
-		originalHeaders.Add(string(header.Key), string(header.Value))
-	}
+	dlqMessage := newDeadLetterQueueMessage(consumer.serviceName, consumer.consumerGroup, message, err)
 
-	dlqMessage := &DeadLetterQueueMessage{
-		Channel:           message.Topic,
-		Publisher:         originalHeaders["origin"],
-		Consumer:          consumer.serviceName,
-		Key:               string(message.Key),
-		Headers:           originalHeaders,
-		Message:           string(message.Value),
-		CausedBy:          err.Error(),
-		FailedConsumeDate: message.Timestamp.In(consumer.utcTZ).Format(time.RFC3339Nano),
+	if err := consumer.dlqHandler.Send(ctx, dlqMessage); err != nil {
+		span.RecordError(err)
 	}
-
-	consumer.dlqHandler.Send(ctx, dlqMessage)
 }
 
 // SaramaConsumerGroupSession is an interface that purposed for mock creation for unit testing.
@@ -1,14 +1,22 @@
 package eventbus_test
 
 import (
+	"bytes"
 	"context"
 	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/Shopify/sarama"
 
 	eventbus "github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/eventbus"
 	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/eventbus/mocks"
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/redaction"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"go.elastic.co/apm"
 )
@@ -40,7 +48,7 @@ func TestSaramaKafkaConsumerGroupHandler_SuccessProceedMessage_WithoutEventHandl
 	cgClaim := &mocks.SaramaConsumerGroupClaim{}
 	cgClaim.On("Messages").Return(geConsumerMessageMock())
 
-	cgh := eventbus.NewDefaultSaramaConsumerGroupHandler(apm.DefaultTracer, "service-test", nil, nil)
+	cgh := eventbus.NewDefaultSaramaConsumerGroupHandler(eventbus.NewElasticAPMTracer(apm.DefaultTracer), "service-test", nil, nil)
 	cgh.Setup(cgSess)
 	cgh.ConsumeClaim(cgSess, cgClaim)
 	cgh.Cleanup(cgSess)
@@ -49,6 +57,31 @@ func TestSaramaKafkaConsumerGroupHandler_SuccessProceedMessage_WithoutEventHandl
 	cgClaim.AssertExpectations(t)
 }
 
+func TestSaramaKafkaConsumerGroupHandler_PrintMessage_WithRedactor(t *testing.T) {
+	var output bytes.Buffer
+	log.SetOutput(&output)
+	defer log.SetOutput(os.Stderr)
+
+	cgSess := &mocks.SaramaConsumerGroupSession{}
+	cgSess.On("MarkMessage", mock.AnythingOfType("*sarama.ConsumerMessage"), mock.AnythingOfType("string"))
+	cgSess.On("Context").Return(context.TODO())
+
+	cgClaim := &mocks.SaramaConsumerGroupClaim{}
+	cgClaim.On("Messages").Return(geConsumerMessageMock())
+
+	redactor, err := redaction.NewRedactor(redaction.Rules{Headers: []string{"test"}, Patterns: []string{"message"}})
+	assert.NoError(t, err)
+
+	cgh := eventbus.NewDefaultSaramaConsumerGroupHandler(eventbus.NewElasticAPMTracer(apm.DefaultTracer), "service-test", nil, nil)
+	cgh.SetRedactor(redactor)
+	cgh.Setup(cgSess)
+	cgh.ConsumeClaim(cgSess, cgClaim)
+	cgh.Cleanup(cgSess)
+
+	assert.Contains(t, output.String(), "value = test-[REDACTED], headers = [test=[REDACTED]]")
+	assert.NotContains(t, output.String(), "header]")
+}
+
 func TestSaramaKafkaConsumerGroupHandler_SuccessProceedMessage_WithEventHandler_WithoutDLQHandler(t *testing.T) {
 	eventHandler := &mocks.EventHandler{}
 	eventHandler.On("Handle", mock.Anything, mock.Anything).Return(nil)
@@ -60,7 +93,7 @@ func TestSaramaKafkaConsumerGroupHandler_SuccessProceedMessage_WithEventHandler_
 	cgClaim := &mocks.SaramaConsumerGroupClaim{}
 	cgClaim.On("Messages").Return(geConsumerMessageMock())
 
-	cgh := eventbus.NewDefaultSaramaConsumerGroupHandler(apm.DefaultTracer, "service-test", eventHandler, nil)
+	cgh := eventbus.NewDefaultSaramaConsumerGroupHandler(eventbus.NewElasticAPMTracer(apm.DefaultTracer), "service-test", eventHandler, nil)
 	cgh.Setup(cgSess)
 	cgh.ConsumeClaim(cgSess, cgClaim)
 	cgh.Cleanup(cgSess)
@@ -81,7 +114,7 @@ func TestSaramaKafkaConsumerGroupHandler_ErrorProceedMessage_WithEventHandler_Wi
 	cgClaim := &mocks.SaramaConsumerGroupClaim{}
 	cgClaim.On("Messages").Return(geConsumerMessageMock())
 
-	cgh := eventbus.NewDefaultSaramaConsumerGroupHandler(apm.DefaultTracer, "service-test", eventHandler, nil)
+	cgh := eventbus.NewDefaultSaramaConsumerGroupHandler(eventbus.NewElasticAPMTracer(apm.DefaultTracer), "service-test", eventHandler, nil)
 	cgh.Setup(cgSess)
 	cgh.ConsumeClaim(cgSess, cgClaim)
 	cgh.Cleanup(cgSess)
@@ -108,7 +141,7 @@ func TestSaramaKafkaConsumerGroupHandler_ErrorProceedMessage_WithEventHandler_Wi
 	cgClaim := &mocks.SaramaConsumerGroupClaim{}
 	cgClaim.On("Messages").Return(geConsumerMessageMock())
 
-	cgh := eventbus.NewDefaultSaramaConsumerGroupHandler(apm.DefaultTracer, "service-test", eventHandler, dlqHandler)
+	cgh := eventbus.NewDefaultSaramaConsumerGroupHandler(eventbus.NewElasticAPMTracer(apm.DefaultTracer), "service-test", eventHandler, dlqHandler)
 	cgh.Setup(cgSess)
 	cgh.ConsumeClaim(cgSess, cgClaim)
 	cgh.Cleanup(cgSess)
@@ -118,3 +151,252 @@ func TestSaramaKafkaConsumerGroupHandler_ErrorProceedMessage_WithEventHandler_Wi
 	eventHandler.AssertExpectations(t)
 	publisher.AssertExpectations(t)
 }
+
+func TestSaramaKafkaConsumerGroupHandler_PartitionBreaker_HoldAndResume(t *testing.T) {
+	eventHandler := &mocks.EventHandler{}
+	eventHandler.On("Handle", mock.Anything, mock.Anything).Return(fmt.Errorf("error")).Twice()
+	eventHandler.On("Handle", mock.Anything, mock.Anything).Return(nil).Once()
+
+	dlqHandler := &mocks.DLQHandler{}
+
+	pauser := &mocks.Pauser{}
+	pauser.On("Pause", "test-topic", []int32{1}).Once()
+	pauser.On("Resume", "test-topic", []int32{1}).Once()
+
+	cgSess := &mocks.SaramaConsumerGroupSession{}
+	cgSess.On("MarkMessage", mock.AnythingOfType("*sarama.ConsumerMessage"), mock.AnythingOfType("string")).Once()
+	cgSess.On("Context").Return(context.TODO())
+
+	cgClaim := &mocks.SaramaConsumerGroupClaim{}
+	cgClaim.On("Messages").Return(geConsumerMessageMock())
+
+	cgh := eventbus.NewDefaultSaramaConsumerGroupHandler(eventbus.NewElasticAPMTracer(apm.DefaultTracer), "service-test", eventHandler, dlqHandler)
+	cgh.SetPartitionBreaker(&eventbus.PartitionBreakerConfig{
+		Pauser:       pauser,
+		WindowSize:   1,
+		FailureRatio: 1,
+		CoolDown:     time.Millisecond,
+	})
+	cgh.Setup(cgSess)
+	cgh.ConsumeClaim(cgSess, cgClaim)
+	cgh.Cleanup(cgSess)
+
+	cgSess.AssertExpectations(t)
+	cgClaim.AssertExpectations(t)
+	eventHandler.AssertExpectations(t)
+	pauser.AssertExpectations(t)
+	dlqHandler.AssertNotCalled(t, "Send", mock.Anything, mock.Anything)
+}
+
+func TestSaramaKafkaConsumerGroupHandler_PartitionBreaker_BelowThreshold(t *testing.T) {
+	eventHandler := &mocks.EventHandler{}
+	eventHandler.On("Handle", mock.Anything, mock.Anything).Return(fmt.Errorf("error")).Once()
+
+	dlqHandler := &mocks.DLQHandler{}
+	dlqHandler.On("Send", mock.Anything, mock.AnythingOfType("*eventbus.DeadLetterQueueMessage")).Return(nil).Once()
+
+	pauser := &mocks.Pauser{}
+
+	cgSess := &mocks.SaramaConsumerGroupSession{}
+	cgSess.On("MarkMessage", mock.AnythingOfType("*sarama.ConsumerMessage"), mock.AnythingOfType("string")).Once()
+	cgSess.On("Context").Return(context.TODO())
+
+	cgClaim := &mocks.SaramaConsumerGroupClaim{}
+	cgClaim.On("Messages").Return(geConsumerMessageMock())
+
+	cgh := eventbus.NewDefaultSaramaConsumerGroupHandler(eventbus.NewElasticAPMTracer(apm.DefaultTracer), "service-test", eventHandler, dlqHandler)
+	cgh.SetPartitionBreaker(&eventbus.PartitionBreakerConfig{
+		Pauser:       pauser,
+		WindowSize:   10,
+		FailureRatio: 0.5,
+		CoolDown:     time.Millisecond,
+	})
+	cgh.Setup(cgSess)
+	cgh.ConsumeClaim(cgSess, cgClaim)
+	cgh.Cleanup(cgSess)
+
+	cgSess.AssertExpectations(t)
+	eventHandler.AssertExpectations(t)
+	dlqHandler.AssertExpectations(t)
+	pauser.AssertNotCalled(t, "Pause", mock.Anything, mock.Anything)
+}
+
+func TestSaramaKafkaConsumerGroupHandler_PartitionBreaker_GiveUpAfterMaxProbes(t *testing.T) {
+	eventHandler := &mocks.EventHandler{}
+	eventHandler.On("Handle", mock.Anything, mock.Anything).Return(fmt.Errorf("error")).Times(3)
+
+	dlqHandler := &mocks.DLQHandler{}
+	dlqHandler.On("Send", mock.Anything, mock.AnythingOfType("*eventbus.DeadLetterQueueMessage")).Return(nil).Once()
+
+	pauser := &mocks.Pauser{}
+	pauser.On("Pause", "test-topic", []int32{1}).Once()
+	pauser.On("Resume", "test-topic", []int32{1}).Once()
+
+	cgSess := &mocks.SaramaConsumerGroupSession{}
+	cgSess.On("MarkMessage", mock.AnythingOfType("*sarama.ConsumerMessage"), mock.AnythingOfType("string")).Once()
+	cgSess.On("Context").Return(context.TODO())
+
+	cgClaim := &mocks.SaramaConsumerGroupClaim{}
+	cgClaim.On("Messages").Return(geConsumerMessageMock())
+
+	cgh := eventbus.NewDefaultSaramaConsumerGroupHandler(eventbus.NewElasticAPMTracer(apm.DefaultTracer), "service-test", eventHandler, dlqHandler)
+	cgh.SetPartitionBreaker(&eventbus.PartitionBreakerConfig{
+		Pauser:       pauser,
+		WindowSize:   1,
+		FailureRatio: 1,
+		CoolDown:     time.Millisecond,
+		MaxProbes:    2,
+	})
+	cgh.Setup(cgSess)
+	cgh.ConsumeClaim(cgSess, cgClaim)
+	cgh.Cleanup(cgSess)
+
+	cgSess.AssertExpectations(t)
+	eventHandler.AssertExpectations(t)
+	dlqHandler.AssertExpectations(t)
+	pauser.AssertExpectations(t)
+}
+
+func TestPartitionBreakerConfig_Validate(t *testing.T) {
+	testCases := []struct {
+		name    string
+		config  eventbus.PartitionBreakerConfig
+		invalid bool
+	}{
+		{name: "valid", config: eventbus.PartitionBreakerConfig{WindowSize: 10, FailureRatio: 0.5, CoolDown: time.Second}},
+		{name: "zero cool-down", config: eventbus.PartitionBreakerConfig{WindowSize: 10, FailureRatio: 0.5}, invalid: true},
+		{name: "negative cool-down", config: eventbus.PartitionBreakerConfig{WindowSize: 10, FailureRatio: 0.5, CoolDown: -time.Second}, invalid: true},
+		{name: "zero failure ratio", config: eventbus.PartitionBreakerConfig{WindowSize: 10, CoolDown: time.Second}, invalid: true},
+		{name: "zero window size", config: eventbus.PartitionBreakerConfig{FailureRatio: 0.5, CoolDown: time.Second}, invalid: true},
+		{name: "negative max probes", config: eventbus.PartitionBreakerConfig{WindowSize: 10, FailureRatio: 0.5, CoolDown: time.Second, MaxProbes: -1}, invalid: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.config.Validate()
+			assert.Equal(t, tc.invalid, err != nil)
+		})
+	}
+}
+
+func TestSaramaKafkaConsumerGroupHandler_PanicProceedMessage_WithDLQHandler(t *testing.T) {
+	eventHandler := &mocks.EventHandler{}
+	eventHandler.On("Handle", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		panic("boom")
+	})
+
+	dlqHandler := &mocks.DLQHandler{}
+	dlqHandler.On("Send", mock.Anything, mock.MatchedBy(func(dlqMessage *eventbus.DeadLetterQueueMessage) bool {
+		return dlqMessage.CausedBy == "boom" && strings.Contains(dlqMessage.StackTrace, "goroutine")
+	})).Return(nil).Once()
+
+	cgSess := &mocks.SaramaConsumerGroupSession{}
+	cgSess.On("MarkMessage", mock.AnythingOfType("*sarama.ConsumerMessage"), mock.AnythingOfType("string")).Once()
+	cgSess.On("Context").Return(context.TODO())
+
+	cgClaim := &mocks.SaramaConsumerGroupClaim{}
+	cgClaim.On("Messages").Return(geConsumerMessageMock())
+
+	cgh := eventbus.NewDefaultSaramaConsumerGroupHandler(eventbus.NewElasticAPMTracer(apm.DefaultTracer), "service-test", eventHandler, dlqHandler)
+	cgh.Setup(cgSess)
+	cgh.ConsumeClaim(cgSess, cgClaim)
+	cgh.Cleanup(cgSess)
+
+	cgSess.AssertExpectations(t)
+	eventHandler.AssertExpectations(t)
+	dlqHandler.AssertExpectations(t)
+}
+
+func TestSaramaKafkaConsumerGroupHandler_ConcurrentProceedMessage(t *testing.T) {
+	messageChan := make(chan *sarama.ConsumerMessage, 6)
+	for i, key := range []string{"a", "b", "c", "a", "b", "c"} {
+		messageChan <- &sarama.ConsumerMessage{
+			Key:       []byte(key),
+			Value:     []byte("test-message"),
+			Partition: int32(1),
+			Offset:    int64(i),
+			Topic:     "test-topic",
+		}
+	}
+	close(messageChan)
+
+	var mu sync.Mutex
+	handledKeys := make(map[string][]int64)
+	eventHandler := &mocks.EventHandler{}
+	eventHandler.On("Handle", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		message := args.Get(1).(*sarama.ConsumerMessage)
+		if message.Offset == 0 {
+			<-time.After(time.Millisecond * 10)
+		}
+		mu.Lock()
+		handledKeys[string(message.Key)] = append(handledKeys[string(message.Key)], message.Offset)
+		mu.Unlock()
+	}).Return(nil)
+
+	markedOffsets := make([]int64, 0)
+	cgSess := &mocks.SaramaConsumerGroupSession{}
+	cgSess.On("MarkMessage", mock.AnythingOfType("*sarama.ConsumerMessage"), mock.AnythingOfType("string")).Run(func(args mock.Arguments) {
+		markedOffsets = append(markedOffsets, args.Get(0).(*sarama.ConsumerMessage).Offset)
+	})
+	cgSess.On("Context").Return(context.TODO())
+
+	cgClaim := &mocks.SaramaConsumerGroupClaim{}
+	cgClaim.On("Messages").Return((<-chan *sarama.ConsumerMessage)(messageChan))
+
+	cgh := eventbus.NewDefaultSaramaConsumerGroupHandler(eventbus.NewElasticAPMTracer(apm.DefaultTracer), "service-test", eventHandler, nil)
+	cgh.SetConcurrency(3)
+	cgh.Setup(cgSess)
+	cgh.ConsumeClaim(cgSess, cgClaim)
+	cgh.Cleanup(cgSess)
+
+	assert.Equal(t, []int64{0, 1, 2, 3, 4, 5}, markedOffsets)
+	assert.Equal(t, []int64{0, 3}, handledKeys["a"])
+	assert.Equal(t, []int64{1, 4}, handledKeys["b"])
+	assert.Equal(t, []int64{2, 5}, handledKeys["c"])
+	eventHandler.AssertNumberOfCalls(t, "Handle", 6)
+}
+
+func TestSaramaKafkaConsumerGroupHandler_DLQMessageCoordinates(t *testing.T) {
+	eventHandler := &mocks.EventHandler{}
+	eventHandler.On("Handle", mock.Anything, mock.Anything).Return(fmt.Errorf("error"))
+
+	produced := time.Date(2021, 7, 1, 0, 0, 0, 0, time.UTC)
+	messageChan := make(chan *sarama.ConsumerMessage, 1)
+	messageChan <- &sarama.ConsumerMessage{
+		Headers:   []*sarama.RecordHeader{{Key: []byte(eventbus.AttemptHeader), Value: []byte("2")}},
+		Key:       []byte("test-key"),
+		Value:     []byte("test-message"),
+		Partition: int32(3),
+		Offset:    int64(40),
+		Topic:     "test-topic",
+		Timestamp: produced,
+	}
+	close(messageChan)
+
+	var dlqMessage *eventbus.DeadLetterQueueMessage
+	dlqHandler := &mocks.DLQHandler{}
+	dlqHandler.On("Send", mock.Anything, mock.AnythingOfType("*eventbus.DeadLetterQueueMessage")).Run(func(args mock.Arguments) {
+		dlqMessage = args.Get(1).(*eventbus.DeadLetterQueueMessage)
+	}).Return(nil).Once()
+
+	cgSess := &mocks.SaramaConsumerGroupSession{}
+	cgSess.On("MarkMessage", mock.AnythingOfType("*sarama.ConsumerMessage"), mock.AnythingOfType("string"))
+	cgSess.On("Context").Return(context.TODO())
+
+	cgClaim := &mocks.SaramaConsumerGroupClaim{}
+	cgClaim.On("Messages").Return((<-chan *sarama.ConsumerMessage)(messageChan))
+
+	cgh := eventbus.NewDefaultSaramaConsumerGroupHandler(eventbus.NewElasticAPMTracer(apm.DefaultTracer), "service-test", eventHandler, dlqHandler)
+	cgh.SetConsumerGroup("group-test")
+	cgh.ConsumeClaim(cgSess, cgClaim)
+
+	dlqHandler.AssertExpectations(t)
+	assert.Equal(t, "service-test", dlqMessage.Consumer)
+	assert.Equal(t, "group-test", dlqMessage.ConsumerGroup)
+	assert.Equal(t, int32(3), dlqMessage.Partition)
+	assert.Equal(t, int64(40), dlqMessage.Offset)
+	assert.Equal(t, produced.Format(time.RFC3339Nano), dlqMessage.ProducedDate)
+	assert.NotEqual(t, dlqMessage.ProducedDate, dlqMessage.FailedConsumeDate)
+	assert.NotEmpty(t, dlqMessage.InstanceID)
+	assert.Equal(t, 3, dlqMessage.Attempt)
+}
@@ -8,12 +8,13 @@ import (
 	eventbus "github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/eventbus"
 	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/eventbus/mocks"
 	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"go.elastic.co/apm"
 )
 
 func TestSaramaKafkaConsumserGroupAdapter_Success(t *testing.T) {
-	cgHandler := eventbus.NewDefaultSaramaConsumerGroupHandler(apm.DefaultTracer, "service-test", &mocks.EventHandler{}, &mocks.DLQHandler{})
+	cgHandler := eventbus.NewDefaultSaramaConsumerGroupHandler(eventbus.NewElasticAPMTracer(apm.DefaultTracer), "service-test", &mocks.EventHandler{}, &mocks.DLQHandler{})
 	topics := []string{"test-topic"}
 
 	cg := new(mocks.SaramaConsumerGroup)
@@ -35,7 +36,7 @@ func TestSaramaKafkaConsumserGroupAdapter_Success(t *testing.T) {
 }
 
 func TestSaramaKafkaConsumserGroupAdapter_ConsumeError(t *testing.T) {
-	cgHandler := eventbus.NewDefaultSaramaConsumerGroupHandler(apm.DefaultTracer, "service-test", &mocks.EventHandler{}, &mocks.DLQHandler{})
+	cgHandler := eventbus.NewDefaultSaramaConsumerGroupHandler(eventbus.NewElasticAPMTracer(apm.DefaultTracer), "service-test", &mocks.EventHandler{}, &mocks.DLQHandler{})
 	topics := []string{"test-topic"}
 
 	cg := new(mocks.SaramaConsumerGroup)
@@ -57,7 +58,7 @@ func TestSaramaKafkaConsumserGroupAdapter_ConsumeError(t *testing.T) {
 }
 
 func TestSaramaKafkaConsumserGroupAdapter_ClosingError(t *testing.T) {
-	cgHandler := eventbus.NewDefaultSaramaConsumerGroupHandler(apm.DefaultTracer, "service-test", &mocks.EventHandler{}, &mocks.DLQHandler{})
+	cgHandler := eventbus.NewDefaultSaramaConsumerGroupHandler(eventbus.NewElasticAPMTracer(apm.DefaultTracer), "service-test", &mocks.EventHandler{}, &mocks.DLQHandler{})
 	topics := []string{"test-topic"}
 
 	cg := new(mocks.SaramaConsumerGroup)
@@ -76,3 +77,69 @@ func TestSaramaKafkaConsumserGroupAdapter_ClosingError(t *testing.T) {
 
 	cg.AssertExpectations(t)
 }
+
+func TestSaramaKafkaConsumserGroupAdapter_ChangeTopics(t *testing.T) {
+	cgHandler := eventbus.NewDefaultSaramaConsumerGroupHandler(eventbus.NewElasticAPMTracer(apm.DefaultTracer), "service-test", &mocks.EventHandler{}, &mocks.DLQHandler{})
+	topics := []string{"test-topic"}
+
+	cg := new(mocks.SaramaConsumerGroup)
+	cg.On("Consume", mock.Anything, []string{"test-topic"}, mock.AnythingOfType("*eventbus.DefaultSaramaConsumerGroupHandler")).Return(nil)
+	cg.On("Consume", mock.Anything, []string{"test-topic", "other-topic"}, mock.AnythingOfType("*eventbus.DefaultSaramaConsumerGroupHandler")).Return(nil)
+	cg.On("Consume", mock.Anything, []string{"other-topic"}, mock.AnythingOfType("*eventbus.DefaultSaramaConsumerGroupHandler")).Return(nil)
+	cg.On("Close").Return(nil)
+
+	subscriber := eventbus.NewSaramaKafkaConsumserGroupAdapter(logrus.New(), &eventbus.SaramaKafkaConsumserGroupAdapterConfig{
+		ConsumerGroupClient:  cg,
+		ConsumerGroupHandler: cgHandler,
+		Topics:               topics,
+	})
+
+	subscriber.Subscribe()
+	<-time.After(time.Millisecond * 10)
+	subscriber.AddTopics("other-topic", "test-topic")
+	<-time.After(time.Millisecond * 10)
+	subscriber.RemoveTopics("test-topic")
+	<-time.After(time.Millisecond * 10)
+	subscriber.Close()
+
+	assert.Equal(t, []string{"other-topic"}, subscriber.Topics())
+	cg.AssertExpectations(t)
+}
+
+func TestSaramaKafkaConsumserGroupAdapter_WithoutTopics(t *testing.T) {
+	cgHandler := eventbus.NewDefaultSaramaConsumerGroupHandler(eventbus.NewElasticAPMTracer(apm.DefaultTracer), "service-test", &mocks.EventHandler{}, &mocks.DLQHandler{})
+
+	cg := new(mocks.SaramaConsumerGroup)
+	cg.On("Close").Return(nil)
+
+	subscriber := eventbus.NewSaramaKafkaConsumserGroupAdapter(logrus.New(), &eventbus.SaramaKafkaConsumserGroupAdapterConfig{
+		ConsumerGroupClient:  cg,
+		ConsumerGroupHandler: cgHandler,
+	})
+
+	subscriber.Subscribe()
+	<-time.After(time.Millisecond * 10)
+	subscriber.Close()
+
+	cg.AssertNotCalled(t, "Consume", mock.Anything, mock.Anything, mock.Anything)
+	cg.AssertExpectations(t)
+}
+
+func TestSaramaKafkaConsumserGroupAdapter_PauseAndResume(t *testing.T) {
+	cgHandler := eventbus.NewDefaultSaramaConsumerGroupHandler(eventbus.NewElasticAPMTracer(apm.DefaultTracer), "service-test", &mocks.EventHandler{}, &mocks.DLQHandler{})
+
+	cg := new(mocks.SaramaConsumerGroup)
+	cg.On("Pause", map[string][]int32{"test-topic": {0, 1}}).Once()
+	cg.On("Resume", map[string][]int32{"test-topic": {1}}).Once()
+
+	subscriber := eventbus.NewSaramaKafkaConsumserGroupAdapter(logrus.New(), &eventbus.SaramaKafkaConsumserGroupAdapterConfig{
+		ConsumerGroupClient:  cg,
+		ConsumerGroupHandler: cgHandler,
+		Topics:               []string{"test-topic"},
+	})
+
+	subscriber.Pause("test-topic", []int32{0, 1})
+	subscriber.Resume("test-topic", []int32{1})
+
+	cg.AssertExpectations(t)
+}
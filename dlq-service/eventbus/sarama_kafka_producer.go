@@ -2,6 +2,7 @@ package eventbus
 
 import (
 	"context"
+	"fmt"
 
 	"github.com/Shopify/sarama"
 	"github.com/sirupsen/logrus"
@@ -10,6 +11,8 @@ import (
 // SaramaKafkaProducerAdapterConfig is a configuration of sarama kafka adapter.
 type SaramaKafkaProducerAdapterConfig struct {
 	AsyncProducer sarama.AsyncProducer
+	// Tracer injects the trace context of the sender into the headers, the nil tracer records nothing.
+	Tracer Tracer
 }
 
 // SaramaKafkaProducerAdapter is a concrete struct of sarma kafka adapter.
@@ -34,7 +37,7 @@ func (skpa *SaramaKafkaProducerAdapter) run() {
 	}
 }
 
-// Send will send the message to the brokers
+// Send will send the message to the brokers, along with the trace context of ctx.
 func (skpa *SaramaKafkaProducerAdapter) Send(ctx context.Context, topic string, key string, headers MessageHeaders, message []byte) (err error) {
 	defer func() {
 		r := recover()
@@ -42,18 +45,15 @@ func (skpa *SaramaKafkaProducerAdapter) Send(ctx context.Context, topic string,
 			skpa.logger.Errorf("[Sarama] %v", r)
 		}
 	}()
-	bunchOfRecordHeaders := make([]sarama.RecordHeader, 0)
-	if headers != nil {
-		for key, value := range headers {
-			recordHeader := sarama.RecordHeader{
-				Key: []byte(key), Value: []byte(value),
-			}
-			bunchOfRecordHeaders = append(bunchOfRecordHeaders, recordHeader)
-		}
-	}
+
+	tracer := tracerOrNoop(skpa.config.Tracer)
+	span, ctx := tracer.StartSpan(ctx, fmt.Sprintf("Kafka Send: %s", topic), "messaging.kafka.send")
+	defer span.End()
+
+	headers = tracer.Inject(ctx, headers)
 
 	producerMessage := &sarama.ProducerMessage{
-		Headers: bunchOfRecordHeaders,
+		Headers: headers.RecordHeaders(),
 		Key:     sarama.ByteEncoder(key),
 		Topic:   topic,
 		Value:   sarama.ByteEncoder(message),
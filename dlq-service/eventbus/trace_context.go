@@ -0,0 +1,23 @@
+package eventbus
+
+// The headers that carry the trace context between the producers and the consumers.
+// Both tracers write the W3C headers along with the elastic one, so the traces continue across the services that use either.
+const (
+	TraceparentHeader        = "traceparent"
+	TracestateHeader         = "tracestate"
+	ElasticTraceparentHeader = "elastic-apm-traceparent"
+)
+
+func setTraceContextHeaders(headers MessageHeaders, traceparent, tracestate string) MessageHeaders {
+	headers = append(MessageHeaders{}, headers...)
+
+	headers.Set(TraceparentHeader, traceparent)
+	headers.Set(ElasticTraceparentHeader, traceparent)
+	if tracestate != "" {
+		headers.Set(TracestateHeader, tracestate)
+	} else {
+		headers.Del(TracestateHeader)
+	}
+
+	return headers
+}
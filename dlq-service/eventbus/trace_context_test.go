@@ -0,0 +1,126 @@
+package eventbus_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/Shopify/sarama"
+	saramamocks "github.com/Shopify/sarama/mocks"
+	eventbus "github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/eventbus"
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/eventbus/mocks"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.elastic.co/apm"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestSaramaKafkaProducer_InjectTraceContext(t *testing.T) {
+	tx := apm.DefaultTracer.StartTransaction("test", "test")
+	defer tx.End()
+	ctx := apm.ContextWithTransaction(context.TODO(), tx)
+
+	var produced eventbus.MessageHeaders
+	saramaProducer := saramamocks.NewAsyncProducer(t, nil)
+	saramaProducer.ExpectInputWithMessageCheckerFunctionAndSucceed(func(message *sarama.ProducerMessage) error {
+		for _, header := range message.Headers {
+			produced.AddBytes(string(header.Key), header.Value)
+		}
+		return nil
+	})
+
+	publisher := eventbus.NewSaramaKafkaProducerAdapter(logrus.New(), &eventbus.SaramaKafkaProducerAdapterConfig{
+		AsyncProducer: saramaProducer,
+		Tracer:        eventbus.NewElasticAPMTracer(apm.DefaultTracer),
+	})
+
+	headers := eventbus.MessageHeaders{}
+	headers.Add(eventbus.TraceparentHeader, "00-11111111111111111111111111111111-2222222222222222-01")
+	headers.Add("test", "header")
+
+	publisher.Send(ctx, "test-topic", "test-key", headers, []byte("Hola"))
+	publisher.Close()
+
+	traceID := tx.TraceContext().Trace.String()
+	assert.Len(t, produced.Values(eventbus.TraceparentHeader), 1)
+	assert.True(t, strings.HasPrefix(produced.Get(eventbus.TraceparentHeader), "00-"+traceID+"-"))
+	assert.Equal(t, produced.Get(eventbus.TraceparentHeader), produced.Get(eventbus.ElasticTraceparentHeader))
+	assert.Equal(t, "header", produced.Get("test"))
+	assert.Equal(t, "00-11111111111111111111111111111111-2222222222222222-01", headers.Get(eventbus.TraceparentHeader))
+}
+
+func TestSaramaKafkaConsumerGroupHandler_ContinueTraceContext(t *testing.T) {
+	var (
+		traceContext apm.TraceContext
+		parentID     apm.SpanID
+	)
+	eventHandler := &mocks.EventHandler{}
+	eventHandler.On("Handle", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		tx := apm.TransactionFromContext(args.Get(0).(context.Context))
+		traceContext = tx.TraceContext()
+		parentID = tx.ParentID()
+	}).Return(nil)
+
+	messageChan := make(chan *sarama.ConsumerMessage, 1)
+	messageChan <- &sarama.ConsumerMessage{
+		Headers: []*sarama.RecordHeader{
+			{Key: []byte(eventbus.TraceparentHeader), Value: []byte("00-11111111111111111111111111111111-2222222222222222-01")},
+		},
+		Key:   []byte("test-key"),
+		Value: []byte("test-message"),
+		Topic: "test-topic",
+	}
+	close(messageChan)
+
+	cgSess := &mocks.SaramaConsumerGroupSession{}
+	cgSess.On("MarkMessage", mock.AnythingOfType("*sarama.ConsumerMessage"), mock.AnythingOfType("string"))
+	cgSess.On("Context").Return(context.TODO())
+
+	cgClaim := &mocks.SaramaConsumerGroupClaim{}
+	cgClaim.On("Messages").Return((<-chan *sarama.ConsumerMessage)(messageChan))
+
+	cgh := eventbus.NewDefaultSaramaConsumerGroupHandler(eventbus.NewElasticAPMTracer(apm.DefaultTracer), "service-test", eventHandler, nil)
+	cgh.ConsumeClaim(cgSess, cgClaim)
+
+	assert.Equal(t, "11111111111111111111111111111111", traceContext.Trace.String())
+	assert.Equal(t, "2222222222222222", parentID.String())
+}
+
+func TestOpenTelemetryTracer(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tracer := eventbus.NewOpenTelemetryTracer(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test"))
+
+	t.Run("continue the trace of the elastic header", func(t *testing.T) {
+		headers := eventbus.MessageHeaders{}
+		headers.Add(eventbus.ElasticTraceparentHeader, "00-11111111111111111111111111111111-2222222222222222-01")
+
+		span, ctx := tracer.StartTransaction(context.TODO(), "test", "test", headers)
+		span.End()
+
+		spanContext := trace.SpanContextFromContext(ctx)
+		assert.Equal(t, "11111111111111111111111111111111", spanContext.TraceID().String())
+
+		ended := recorder.Ended()
+		assert.Equal(t, "2222222222222222", ended[len(ended)-1].Parent().SpanID().String())
+	})
+
+	t.Run("inject the trace context of the span", func(t *testing.T) {
+		span, ctx := tracer.StartSpan(context.TODO(), "test", "test")
+		defer span.End()
+
+		headers := eventbus.MessageHeaders{}
+		headers.Add(eventbus.TraceparentHeader, "00-11111111111111111111111111111111-2222222222222222-01")
+		injected := tracer.Inject(ctx, headers)
+
+		spanContext := trace.SpanContextFromContext(ctx)
+		traceparent := fmt.Sprintf("00-%s-%s-01", spanContext.TraceID(), spanContext.SpanID())
+		assert.Equal(t, traceparent, injected.Get(eventbus.TraceparentHeader))
+		assert.Equal(t, traceparent, injected.Get(eventbus.ElasticTraceparentHeader))
+		assert.Len(t, injected.Values(eventbus.TraceparentHeader), 1)
+		assert.Equal(t, "00-11111111111111111111111111111111-2222222222222222-01", headers.Get(eventbus.TraceparentHeader))
+	})
+}
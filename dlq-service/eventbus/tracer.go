@@ -0,0 +1,55 @@
+package eventbus
+
+import "context"
+
+// Tracer starts the spans of the eventbus, it is implemented for elastic APM and OpenTelemetry.
+type Tracer interface {
+	// StartTransaction starts the root span of a consumed message, it continues the trace that the headers carry.
+	StartTransaction(ctx context.Context, name, spanType string, headers MessageHeaders) (span Span, spanCtx context.Context)
+	// StartSpan starts a child span of the one within the context.
+	StartSpan(ctx context.Context, name, spanType string) (span Span, spanCtx context.Context)
+	// Inject returns the headers with the trace context of the span within the context.
+	Inject(ctx context.Context, headers MessageHeaders) MessageHeaders
+}
+
+// Span is a span which is started by `Tracer`.
+type Span interface {
+	SetResult(result string)
+	RecordError(err error)
+	End()
+}
+
+type noopTracer struct{}
+
+type noopSpan struct{}
+
+// NewNoopTracer is a constructor of the tracer that records nothing.
+func NewNoopTracer() Tracer {
+	return noopTracer{}
+}
+
+func (noopTracer) StartTransaction(ctx context.Context, name, spanType string, headers MessageHeaders) (Span, context.Context) {
+	return noopSpan{}, ctx
+}
+
+func (noopTracer) StartSpan(ctx context.Context, name, spanType string) (Span, context.Context) {
+	return noopSpan{}, ctx
+}
+
+func (noopTracer) Inject(ctx context.Context, headers MessageHeaders) MessageHeaders {
+	return headers
+}
+
+func (noopSpan) SetResult(result string) {}
+
+func (noopSpan) RecordError(err error) {}
+
+func (noopSpan) End() {}
+
+func tracerOrNoop(tracer Tracer) Tracer {
+	if tracer == nil {
+		return NewNoopTracer()
+	}
+
+	return tracer
+}
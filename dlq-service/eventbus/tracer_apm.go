@@ -0,0 +1,121 @@
+package eventbus
+
+import (
+	"context"
+	"strings"
+
+	"go.elastic.co/apm"
+	"go.elastic.co/apm/module/apmhttp"
+)
+
+type elasticAPMTracer struct {
+	tracer *apm.Tracer
+}
+
+type elasticAPMTransaction struct {
+	ctx context.Context
+	tx  *apm.Transaction
+}
+
+type elasticAPMSpan struct {
+	ctx  context.Context
+	span *apm.Span
+}
+
+// NewElasticAPMTracer is a constructor of the tracer that reports to the elastic APM server.
+func NewElasticAPMTracer(tracer *apm.Tracer) Tracer {
+	return &elasticAPMTracer{tracer: tracer}
+}
+
+func (t *elasticAPMTracer) StartTransaction(ctx context.Context, name, spanType string, headers MessageHeaders) (Span, context.Context) {
+	txOptions := apm.TransactionOptions{}
+	if traceContext, ok := elasticTraceContextOf(headers); ok {
+		txOptions.TraceContext = traceContext
+	}
+
+	tx := t.tracer.StartTransactionOptions(name, spanType, txOptions)
+	ctx = apm.ContextWithTransaction(ctx, tx)
+
+	return &elasticAPMTransaction{ctx: ctx, tx: tx}, ctx
+}
+
+func (t *elasticAPMTracer) StartSpan(ctx context.Context, name, spanType string) (Span, context.Context) {
+	span, ctx := apm.StartSpan(ctx, name, spanType)
+
+	return &elasticAPMSpan{ctx: ctx, span: span}, ctx
+}
+
+// Inject replaces the trace context the headers already have, e.g. the one of a republished message.
+func (t *elasticAPMTracer) Inject(ctx context.Context, headers MessageHeaders) MessageHeaders {
+	var traceContext apm.TraceContext
+	if span := apm.SpanFromContext(ctx); span != nil && !span.Dropped() {
+		traceContext = span.TraceContext()
+	} else if tx := apm.TransactionFromContext(ctx); tx != nil {
+		traceContext = tx.TraceContext()
+	} else {
+		return headers
+	}
+
+	return setTraceContextHeaders(headers, apmhttp.FormatTraceparentHeader(traceContext), traceContext.State.String())
+}
+
+func (s *elasticAPMTransaction) SetResult(result string) {
+	s.tx.Result = result
+}
+
+func (s *elasticAPMTransaction) RecordError(err error) {
+	apm.CaptureError(s.ctx, err).Send()
+}
+
+func (s *elasticAPMTransaction) End() {
+	s.tx.End()
+}
+
+func (s *elasticAPMSpan) SetResult(result string) {}
+
+func (s *elasticAPMSpan) RecordError(err error) {
+	apm.CaptureError(s.ctx, err).Send()
+}
+
+func (s *elasticAPMSpan) End() {
+	s.span.End()
+}
+
+// elasticTraceContextOf returns the trace context of the headers, the W3C header takes precedence over the elastic one.
+func elasticTraceContextOf(headers MessageHeaders) (traceContext apm.TraceContext, ok bool) {
+	var traceparent, elasticTraceparent string
+	var tracestate []string
+
+	for _, header := range headers {
+		switch {
+		case strings.EqualFold(header.Key, TraceparentHeader):
+			traceparent = string(header.Value)
+		case strings.EqualFold(header.Key, ElasticTraceparentHeader):
+			elasticTraceparent = string(header.Value)
+		case strings.EqualFold(header.Key, TracestateHeader):
+			tracestate = append(tracestate, string(header.Value))
+		}
+	}
+
+	if traceparent == "" {
+		traceparent = elasticTraceparent
+	}
+	if traceparent == "" {
+		return
+	}
+
+	traceContext, err := apmhttp.ParseTraceparentHeader(traceparent)
+	if err != nil {
+		return
+	}
+
+	if len(tracestate) > 0 {
+		if state, err := apmhttp.ParseTracestateHeader(tracestate...); err == nil {
+			traceContext.State = state
+		}
+	}
+
+	ok = true
+
+	return
+}
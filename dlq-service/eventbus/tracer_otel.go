@@ -0,0 +1,98 @@
+package eventbus
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type openTelemetryTracer struct {
+	tracer     trace.Tracer
+	propagator propagation.TextMapPropagator
+}
+
+type openTelemetrySpan struct {
+	span trace.Span
+}
+
+// NewOpenTelemetryTracer is a constructor of the tracer that records the spans by OpenTelemetry,
+// the trace context is propagated by the W3C headers.
+func NewOpenTelemetryTracer(tracer trace.Tracer) Tracer {
+	return &openTelemetryTracer{
+		tracer:     tracer,
+		propagator: propagation.TraceContext{},
+	}
+}
+
+func (t *openTelemetryTracer) StartTransaction(ctx context.Context, name, spanType string, headers MessageHeaders) (Span, context.Context) {
+	carrier := headers
+	if !carrier.Has(TraceparentHeader) && carrier.Has(ElasticTraceparentHeader) {
+		carrier = append(MessageHeaders{}, headers...)
+		carrier.Set(TraceparentHeader, carrier.Get(ElasticTraceparentHeader))
+	}
+
+	ctx = t.propagator.Extract(ctx, &headersCarrier{headers: &carrier})
+	ctx, span := t.tracer.Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(attribute.String("span.type", spanType)),
+	)
+
+	return &openTelemetrySpan{span: span}, ctx
+}
+
+func (t *openTelemetryTracer) StartSpan(ctx context.Context, name, spanType string) (Span, context.Context) {
+	ctx, span := t.tracer.Start(ctx, name, trace.WithAttributes(attribute.String("span.type", spanType)))
+
+	return &openTelemetrySpan{span: span}, ctx
+}
+
+// Inject replaces the trace context the headers already have, e.g. the one of a republished message.
+func (t *openTelemetryTracer) Inject(ctx context.Context, headers MessageHeaders) MessageHeaders {
+	spanContext := trace.SpanContextFromContext(ctx)
+	if !spanContext.IsValid() {
+		return headers
+	}
+
+	carrier := MessageHeaders{}
+	t.propagator.Inject(ctx, &headersCarrier{headers: &carrier})
+
+	return setTraceContextHeaders(headers, carrier.Get(TraceparentHeader), carrier.Get(TracestateHeader))
+}
+
+func (s *openTelemetrySpan) SetResult(result string) {
+	s.span.SetAttributes(attribute.String("result", result))
+}
+
+func (s *openTelemetrySpan) RecordError(err error) {
+	s.span.RecordError(err)
+	s.span.SetStatus(codes.Error, err.Error())
+}
+
+func (s *openTelemetrySpan) End() {
+	s.span.End()
+}
+
+// headersCarrier adapts the headers to `propagation.TextMapCarrier`.
+type headersCarrier struct {
+	headers *MessageHeaders
+}
+
+func (c *headersCarrier) Get(key string) string {
+	return c.headers.Get(key)
+}
+
+func (c *headersCarrier) Set(key, value string) {
+	c.headers.Set(key, value)
+}
+
+func (c *headersCarrier) Keys() []string {
+	keys := make([]string, 0, len(*c.headers))
+	for _, header := range *c.headers {
+		keys = append(keys, header.Key)
+	}
+
+	return keys
+}
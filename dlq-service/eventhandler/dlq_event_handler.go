@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"time"
 
 	"github.com/Shopify/sarama"
 	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/eventbus"
@@ -24,6 +25,13 @@ func NewDLQEventHandler(logger *logrus.Logger, usecase usecase.DLQUsecase) event
 	}
 }
 
+func NewDLQBatchEventHandler(logger *logrus.Logger, usecase usecase.DLQUsecase) eventbus.BatchEventHandler {
+	return &dlqEventHandler{
+		logger:  logger,
+		usecase: usecase,
+	}
+}
+
 func (handler *dlqEventHandler) Handle(ctx context.Context, eventMessage interface{}) (err error) {
 	kafkaMessage, ok := eventMessage.(*sarama.ConsumerMessage)
 	if !ok {
@@ -35,10 +43,11 @@ func (handler *dlqEventHandler) Handle(ctx context.Context, eventMessage interfa
 
 	var payload model.MessageParams
 
-	if err = json.Unmarshal(kafkaMessage.Value, &payload); err != nil {
+	if err = handler.decodeKafkaMessage(kafkaMessage, &payload); err != nil {
 		handler.logger.Error(err)
 		return
 	}
+	setCoordinates(&payload, kafkaMessage)
 
 	response := handler.usecase.Add(ctx, payload)
 
@@ -49,3 +58,167 @@ func (handler *dlqEventHandler) Handle(ctx context.Context, eventMessage interfa
 
 	return
 }
+
+func (handler *dlqEventHandler) HandleBatch(ctx context.Context, eventMessages []interface{}) (failures eventbus.BatchFailures) {
+	failures = eventbus.BatchFailures{}
+
+	bunchOfPayload := make([]model.MessageParams, 0, len(eventMessages))
+	indexes := make([]int, 0, len(eventMessages))
+
+	for i, eventMessage := range eventMessages {
+		// The messages that could not be decoded would fail the same way when they are redelivered.
+		kafkaMessage, ok := eventMessage.(*sarama.ConsumerMessage)
+		if !ok {
+			failures[i] = &eventbus.PermanentError{Err: errors.New("not a kafka message")}
+			handler.logger.Error(failures[i])
+			continue
+		}
+
+		var payload model.MessageParams
+
+		if err := handler.decodeKafkaMessage(kafkaMessage, &payload); err != nil {
+			failures[i] = &eventbus.PermanentError{Err: err}
+			handler.logger.Error(err)
+			continue
+		}
+		setCoordinates(&payload, kafkaMessage)
+
+		bunchOfPayload = append(bunchOfPayload, payload)
+		indexes = append(indexes, i)
+	}
+
+	if len(bunchOfPayload) < 1 {
+		return
+	}
+
+	for i, err := range handler.usecase.AddMany(ctx, bunchOfPayload) {
+		failures[indexes[i]] = err
+	}
+
+	return
+}
+
+// setCoordinates stores where the record is on the DLQ topic, so a redelivery of the same record is stored once.
+func setCoordinates(payload *model.MessageParams, kafkaMessage *sarama.ConsumerMessage) {
+	payload.DLQTopic = kafkaMessage.Topic
+	payload.DLQPartition = kafkaMessage.Partition
+	payload.DLQOffset = kafkaMessage.Offset
+	payload.DLQKey = string(kafkaMessage.Key)
+}
+
+// decodeKafkaMessage decodes the records of both `eventbus.DLQHeadersHandlerAdapter` and `eventbus.DLQHandlerAdapter`.
+func (handler *dlqEventHandler) decodeKafkaMessage(kafkaMessage *sarama.ConsumerMessage, payload *model.MessageParams) (err error) {
+	if !eventbus.IsDLQHeadersFormat(kafkaMessage) {
+		err = handler.decodeMessageParams(kafkaMessage.Value, payload)
+		return
+	}
+
+	dlqMessage := eventbus.DeadLetterQueueMessageFromHeaders(kafkaMessage)
+
+	headers := make(model.MessageHeadersParams, 0, len(dlqMessage.Headers))
+	for _, header := range dlqMessage.Headers {
+		headers = append(headers, model.MessageHeaderParams{Key: header.Key, Value: header.Value})
+	}
+
+	failedConsumeDate, producedDate := handler.parseDates(dlqMessage.FailedConsumeDate, dlqMessage.ProducedDate)
+
+	*payload = model.MessageParams{
+		SchemaVersion:     dlqMessage.SchemaVersion,
+		Channel:           dlqMessage.Channel,
+		Publisher:         dlqMessage.Publisher,
+		Consumer:          dlqMessage.Consumer,
+		Key:               dlqMessage.Key,
+		Headers:           headers,
+		Message:           dlqMessage.Message,
+		ContentType:       dlqMessage.ContentType,
+		CausedBy:          dlqMessage.CausedBy,
+		StackTrace:        dlqMessage.StackTrace,
+		FailedConsumeDate: failedConsumeDate,
+		Partition:         dlqMessage.Partition,
+		Offset:            dlqMessage.Offset,
+		ProducedDate:      producedDate,
+		ConsumerGroup:     dlqMessage.ConsumerGroup,
+		InstanceID:        dlqMessage.InstanceID,
+		Attempt:           dlqMessage.Attempt,
+	}
+
+	return
+}
+
+// decodeMessageParams decodes every schema version of the DLQ envelope.
+// Version 1 has no `schemaVersion` and carries the key and the message as plain strings,
+// the later versions carry them as base64 bytes.
+func (handler *dlqEventHandler) decodeMessageParams(value []byte, payload *model.MessageParams) (err error) {
+	type messageParams model.MessageParams
+	var envelope struct {
+		messageParams
+		Key               json.RawMessage `json:"key"`
+		Message           json.RawMessage `json:"message"`
+		FailedConsumeDate string          `json:"failedConsumeDate"`
+		ProducedDate      string          `json:"producedDate"`
+	}
+
+	if err = json.Unmarshal(value, &envelope); err != nil {
+		return
+	}
+
+	*payload = model.MessageParams(envelope.messageParams)
+
+	// The dates are RFC3339 strings in every version, the empty ones are left as zero.
+	payload.FailedConsumeDate, payload.ProducedDate = handler.parseDates(envelope.FailedConsumeDate, envelope.ProducedDate)
+
+	if payload.SchemaVersion < 2 {
+		var key, message string
+		if err = unmarshalOptional(envelope.Key, &key); err != nil {
+			return
+		}
+		if err = unmarshalOptional(envelope.Message, &message); err != nil {
+			return
+		}
+
+		payload.SchemaVersion = 1
+		payload.Key = []byte(key)
+		payload.Message = []byte(message)
+
+		return
+	}
+
+	if err = unmarshalOptional(envelope.Key, &payload.Key); err != nil {
+		return
+	}
+	err = unmarshalOptional(envelope.Message, &payload.Message)
+
+	return
+}
+
+// parseDates falls back like the date migration does, so the record with an unparsable date is still stored:
+// the failed date falls back to the ingest time and the unparsable produced date is left out.
+func (handler *dlqEventHandler) parseDates(failedConsumeDate, producedDate string) (failedAt time.Time, producedAt *time.Time) {
+	if failedConsumeDate != "" {
+		var err error
+		if failedAt, err = time.Parse(time.RFC3339Nano, failedConsumeDate); err != nil {
+			handler.logger.Warnf("failedConsumeDate %q is not parsable, the ingest time is used instead: %s", failedConsumeDate, err.Error())
+			failedAt = time.Now().UTC()
+		}
+	}
+
+	if producedDate != "" {
+		t, err := time.Parse(time.RFC3339Nano, producedDate)
+		if err != nil {
+			handler.logger.Warnf("producedDate %q is not parsable, it is left out: %s", producedDate, err.Error())
+			return
+		}
+		producedAt = &t
+	}
+
+	return
+}
+
+func unmarshalOptional(raw json.RawMessage, v interface{}) (err error) {
+	if len(raw) < 1 {
+		return
+	}
+
+	err = json.Unmarshal(raw, v)
+	return
+}
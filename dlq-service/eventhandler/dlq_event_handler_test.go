@@ -0,0 +1,250 @@
+package eventhandler_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/entity"
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/eventbus"
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/eventbus/mocks"
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/eventhandler"
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/model"
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/repository"
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/usecase"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// addManyDLQUsecase keeps the payloads it is given and fails them by their index.
+type addManyDLQUsecase struct {
+	usecase.DLQUsecase
+	bunchOfPayload []model.MessageParams
+	failures       map[int]error
+}
+
+func (u *addManyDLQUsecase) AddMany(ctx context.Context, bunchOfPayload []model.MessageParams) (failures map[int]error) {
+	u.bunchOfPayload = bunchOfPayload
+	failures = u.failures
+
+	return
+}
+
+func TestDLQBatchEventHandler_HandleBatch(t *testing.T) {
+	dlqUsecase := &addManyDLQUsecase{failures: map[int]error{1: errors.New("object to insert too large")}}
+	handler := eventhandler.NewDLQBatchEventHandler(logrus.New(), dlqUsecase)
+
+	failures := handler.HandleBatch(context.TODO(), []interface{}{
+		&sarama.ConsumerMessage{Value: []byte(`{"channel":"orders","causedBy":"timeout"}`)},
+		&sarama.ConsumerMessage{Value: []byte(`not a json`)},
+		&sarama.ConsumerMessage{Value: []byte(`{"channel":"orders","causedBy":"bad request"}`)},
+		"not a kafka message",
+	})
+
+	// The messages that could not be decoded are not stored, the failure of the stored ones is reported by their index in the batch.
+	if assert.Len(t, dlqUsecase.bunchOfPayload, 2) {
+		assert.Equal(t, "timeout", dlqUsecase.bunchOfPayload[0].CausedBy)
+		assert.Equal(t, "bad request", dlqUsecase.bunchOfPayload[1].CausedBy)
+	}
+	assert.Len(t, failures, 3)
+	assert.Error(t, failures[1])
+	assert.Equal(t, dlqUsecase.failures[1], failures[2])
+	assert.Error(t, failures[3])
+}
+
+func TestDLQBatchEventHandler_HandleBatch_NothingToStore(t *testing.T) {
+	dlqUsecase := &addManyDLQUsecase{}
+	handler := eventhandler.NewDLQBatchEventHandler(logrus.New(), dlqUsecase)
+
+	failures := handler.HandleBatch(context.TODO(), []interface{}{&sarama.ConsumerMessage{Value: []byte(`not a json`)}})
+
+	assert.Len(t, failures, 1)
+	assert.Nil(t, dlqUsecase.bunchOfPayload)
+}
+
+func TestDLQBatchEventHandler_HandleBatch_Dates(t *testing.T) {
+	dlqUsecase := &addManyDLQUsecase{}
+	handler := eventhandler.NewDLQBatchEventHandler(logrus.New(), dlqUsecase)
+
+	newRecord := func(failedConsumeDate, producedDate string) *sarama.ConsumerMessage {
+		value := fmt.Sprintf(`{"channel":"orders","causedBy":"timeout","failedConsumeDate":%q,"producedDate":%q}`, failedConsumeDate, producedDate)
+		return &sarama.ConsumerMessage{Topic: "dead-letter-queue", Value: []byte(value)}
+	}
+
+	failures := handler.HandleBatch(context.TODO(), []interface{}{
+		newRecord("2021-06-30T10:00:00Z", "2021-06-30T09:59:59.5Z"),
+		newRecord("", ""),
+		newRecord("30/06/2021 10:00", ""),
+	})
+
+	// The dates are RFC3339 strings, the missing ones are left as zero and the unparsable ones fall back.
+	assert.Empty(t, failures)
+	if !assert.Len(t, dlqUsecase.bunchOfPayload, 3) {
+		return
+	}
+	assert.Equal(t, time.Date(2021, 6, 30, 10, 0, 0, 0, time.UTC), dlqUsecase.bunchOfPayload[0].FailedConsumeDate.UTC())
+	if assert.NotNil(t, dlqUsecase.bunchOfPayload[0].ProducedDate) {
+		assert.Equal(t, time.Date(2021, 6, 30, 9, 59, 59, 500000000, time.UTC), dlqUsecase.bunchOfPayload[0].ProducedDate.UTC())
+	}
+	assert.True(t, dlqUsecase.bunchOfPayload[1].FailedConsumeDate.IsZero())
+	assert.Nil(t, dlqUsecase.bunchOfPayload[1].ProducedDate)
+	assert.WithinDuration(t, time.Now(), dlqUsecase.bunchOfPayload[2].FailedConsumeDate, time.Minute)
+}
+
+// failingDLQRepository fails every bulk write, like a database that is down.
+type failingDLQRepository struct {
+	repository.DLQRepository
+}
+
+func (r *failingDLQRepository) InsertMany(ctx context.Context, bunchOfMessage []entity.Message) (failures map[int]error, err error) {
+	err = errors.New("server selection timeout")
+	return
+}
+
+func getDLQRecords(values ...string) <-chan *sarama.ConsumerMessage {
+	messageChan := make(chan *sarama.ConsumerMessage, len(values))
+	defer close(messageChan)
+
+	for i, value := range values {
+		messageChan <- &sarama.ConsumerMessage{
+			Key:       []byte(fmt.Sprintf("dlq-key-%d", i)),
+			Value:     []byte(value),
+			Partition: int32(0),
+			Offset:    int64(i),
+			Topic:     "dead-letter-queue",
+		}
+	}
+
+	return messageChan
+}
+
+func newDLQRecord(causedBy string) string {
+	return fmt.Sprintf(`{"channel":"orders","publisher":"order-service","consumer":"payment-service","key":"order-1",`+
+		`"headers":{},"message":"{\"id\":1}","causedBy":%q,"failedConsumeDate":"2021-06-30T10:00:00Z"}`, causedBy)
+}
+
+func newBatchConsumerGroupHandler(dlqRepository repository.DLQRepository) *eventbus.BatchSaramaConsumerGroupHandler {
+	retention, _ := usecase.ParseRetentionPolicy("")
+	dlqUsecase := usecase.NewDLQUsecase(logrus.New(), nil, dlqRepository, nil, retention, nil, nil)
+
+	return eventbus.NewBatchSaramaConsumerGroupHandler(nil, "dlq-service", eventhandler.NewDLQBatchEventHandler(logrus.New(), dlqUsecase), nil,
+		&eventbus.BatchSaramaConsumerGroupHandlerConfig{
+			BatchSize:     10,
+			FlushInterval: time.Hour,
+			MaxRetries:    1,
+			RetryBackoff:  time.Millisecond,
+		})
+}
+
+func TestDLQBatchEventHandler_FailedWrite_DoesNotMarkOffsets(t *testing.T) {
+	cgSess := &mocks.SaramaConsumerGroupSession{}
+	cgSess.On("Context").Return(context.TODO())
+
+	cgClaim := &mocks.SaramaConsumerGroupClaim{}
+	cgClaim.On("Messages").Return(getDLQRecords(newDLQRecord("timeout"), newDLQRecord("bad request")))
+
+	cgh := newBatchConsumerGroupHandler(&failingDLQRepository{DLQRepository: repository.NewMemoryDLQRepository()})
+	err := cgh.ConsumeClaim(cgSess, cgClaim)
+
+	assert.ErrorIs(t, err, eventbus.ErrBatchNotHandled)
+	cgSess.AssertNotCalled(t, "MarkMessage", mock.Anything, mock.Anything)
+}
+
+func TestDLQBatchEventHandler_WrittenBatch_MarksOffsets(t *testing.T) {
+	dlqRepository := repository.NewMemoryDLQRepository()
+
+	cgSess := &mocks.SaramaConsumerGroupSession{}
+	cgSess.On("Context").Return(context.TODO())
+	cgSess.On("MarkMessage", mock.MatchedBy(func(message *sarama.ConsumerMessage) bool { return message.Offset == 2 }), "").Once()
+
+	cgClaim := &mocks.SaramaConsumerGroupClaim{}
+	// The record that could not be decoded is dropped, redelivering it would not help.
+	cgClaim.On("Messages").Return(getDLQRecords(newDLQRecord("timeout"), "not a json", newDLQRecord("bad request")))
+
+	cgh := newBatchConsumerGroupHandler(dlqRepository)
+	err := cgh.ConsumeClaim(cgSess, cgClaim)
+
+	assert.NoError(t, err)
+	cgSess.AssertExpectations(t)
+
+	counted, _ := dlqRepository.CountDocuments(context.TODO(), "")
+	assert.Equal(t, int64(2), counted)
+}
+
+func TestDLQEventHandler_Handle_Dates(t *testing.T) {
+	testCases := []struct {
+		name              string
+		failedConsumeDate string
+		producedDate      string
+		expectedFailedAt  *time.Time
+		expectedProduced  *time.Time
+		failedAtIsIngest  bool
+	}{
+		{
+			name:              "valid dates",
+			failedConsumeDate: "2021-06-30T10:00:00Z",
+			producedDate:      "2021-06-30T09:59:59.5Z",
+			expectedFailedAt:  timeOf("2021-06-30T10:00:00Z"),
+			expectedProduced:  timeOf("2021-06-30T09:59:59.5Z"),
+		},
+		{
+			name:              "unparsable failed date falls back to the ingest time",
+			failedConsumeDate: "30/06/2021 10:00",
+			producedDate:      "2021-06-30T09:59:59Z",
+			expectedProduced:  timeOf("2021-06-30T09:59:59Z"),
+			failedAtIsIngest:  true,
+		},
+		{
+			name:              "unparsable produced date is left out",
+			failedConsumeDate: "2021-06-30T10:00:00Z",
+			producedDate:      "yesterday",
+			expectedFailedAt:  timeOf("2021-06-30T10:00:00Z"),
+		},
+		{
+			name:             "missing dates",
+			expectedFailedAt: &time.Time{},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dlqRepository := repository.NewMemoryDLQRepository()
+			retention, _ := usecase.ParseRetentionPolicy("")
+			dlqUsecase := usecase.NewDLQUsecase(logrus.New(), nil, dlqRepository, nil, retention, nil, nil)
+			handler := eventhandler.NewDLQEventHandler(logrus.New(), dlqUsecase)
+
+			value := fmt.Sprintf(`{"channel":"orders","publisher":"order-service","consumer":"payment-service","key":"order-1",`+
+				`"headers":{},"message":"{}","causedBy":"timeout","failedConsumeDate":%q,"producedDate":%q}`, tc.failedConsumeDate, tc.producedDate)
+
+			err := handler.Handle(context.TODO(), &sarama.ConsumerMessage{Topic: "dead-letter-queue", Value: []byte(value)})
+			assert.NoError(t, err)
+
+			stored, err := dlqRepository.FindMany(context.TODO(), "", 1, 0)
+			assert.NoError(t, err)
+			if !assert.Len(t, stored, 1) {
+				return
+			}
+
+			if tc.failedAtIsIngest {
+				assert.WithinDuration(t, stored[0].IngestedAt, stored[0].FailedConsumeDate, time.Second)
+			} else {
+				assert.True(t, tc.expectedFailedAt.Equal(stored[0].FailedConsumeDate))
+			}
+
+			if tc.expectedProduced == nil {
+				assert.Nil(t, stored[0].ProducedDate)
+			} else if assert.NotNil(t, stored[0].ProducedDate) {
+				assert.True(t, tc.expectedProduced.Equal(*stored[0].ProducedDate))
+			}
+		})
+	}
+}
+
+func timeOf(value string) *time.Time {
+	t, _ := time.Parse(time.RFC3339Nano, value)
+	return &t
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"net/http"
 	"os"
@@ -16,35 +17,57 @@ import (
 	"github.com/Shopify/sarama"
 	"github.com/gorilla/mux"
 	_ "github.com/joho/godotenv/autoload" // for development
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/auth"
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/blobstore"
 	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/controller"
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/encryption"
 	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/eventbus"
 	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/eventhandler"
-	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/mongodb"
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/redaction"
 	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/repository"
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/schemaregistry"
 	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/usecase"
 	"github.com/sirupsen/logrus"
-	"go.elastic.co/apm"
-	"go.elastic.co/apm/module/apmgorilla"
-	"go.elastic.co/apm/module/apmlogrus"
-	"go.elastic.co/apm/module/apmmongo"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-var (
-	tracer *apm.Tracer
-)
-
-func init() {
-	tracer = apm.DefaultTracer
-}
-
 func main() {
+	migrateOnly := flag.Bool("migrate-only", false, "run the migrations of the database and exit")
+	flag.Parse()
+
 	serviceName := os.Getenv("SERVICE_NAME")
 	servicePort, _ := strconv.Atoi(os.Getenv("SERVICE_PORT"))
 	mongodbURL := os.Getenv("MONGODB_URL")
 	mongodbDatabase := os.Getenv("MONGODB_DATABASE")
+	storageBackend := os.Getenv("STORAGE_BACKEND")
+	boltPath := os.Getenv("BOLT_PATH")
+	postgresURL := os.Getenv("POSTGRES_URL")
+	storageCompression := os.Getenv("STORAGE_COMPRESSION")
+	storageCompressionThreshold, _ := strconv.Atoi(os.Getenv("STORAGE_COMPRESSION_THRESHOLD"))
+	blobStoreDir := os.Getenv("BLOB_STORE_DIR")
+	blobOffloadThreshold, _ := strconv.Atoi(os.Getenv("BLOB_OFFLOAD_THRESHOLD"))
+	encryptionKeyFile := os.Getenv("ENCRYPTION_KEY_FILE")
+	encryptionHeaders := strings.FieldsFunc(os.Getenv("ENCRYPTION_HEADERS"), func(r rune) bool { return r == ',' })
+	keyRotationInterval, _ := time.ParseDuration(os.Getenv("KEY_ROTATION_INTERVAL"))
+	redactionRulesFile := os.Getenv("REDACTION_RULES_FILE")
 	kafkaBrokers := strings.Split(os.Getenv("KAFKA_BROKERS"), ",")
+	breakerWindowSize, _ := strconv.Atoi(os.Getenv("CIRCUIT_BREAKER_WINDOW_SIZE"))
+	breakerFailureRatio, _ := strconv.ParseFloat(os.Getenv("CIRCUIT_BREAKER_FAILURE_RATIO"), 64)
+	breakerCoolDown, _ := time.ParseDuration(os.Getenv("CIRCUIT_BREAKER_COOL_DOWN"))
+	breakerMaxProbes, _ := strconv.Atoi(os.Getenv("CIRCUIT_BREAKER_MAX_PROBES"))
+	eventHandlerTimeout, _ := time.ParseDuration(os.Getenv("EVENT_HANDLER_TIMEOUT"))
+	consumerWorkers, _ := strconv.Atoi(os.Getenv("CONSUMER_WORKERS"))
+	dlqBatchSize, _ := strconv.Atoi(os.Getenv("DLQ_BATCH_SIZE"))
+	dlqFlushInterval, _ := time.ParseDuration(os.Getenv("DLQ_FLUSH_INTERVAL"))
+	dlqMaxRetries, _ := strconv.Atoi(os.Getenv("DLQ_MAX_RETRIES"))
+	dlqRetryBackoff, _ := time.ParseDuration(os.Getenv("DLQ_RETRY_BACKOFF"))
+	schemaRegistryURL := os.Getenv("SCHEMA_REGISTRY_URL")
+	schemaRegistryDir := os.Getenv("SCHEMA_REGISTRY_DIR")
+	tracingBackend := os.Getenv("TRACING_BACKEND")
+	retentionGrace, _ := time.ParseDuration(os.Getenv("RETENTION_GRACE"))
+	archiveDir := os.Getenv("ARCHIVE_DIR")
+	archiveInterval, _ := time.ParseDuration(os.Getenv("ARCHIVE_INTERVAL"))
+	otelExporter := os.Getenv("OTEL_EXPORTER")
+	otelExporterFile := os.Getenv("OTEL_EXPORTER_FILE")
 
 	logger := logrus.New()
 	logger.SetFormatter(&logrus.JSONFormatter{
@@ -57,49 +80,240 @@ func main() {
 		},
 	})
 	logger.SetReportCaller(true)
-	logger.AddHook(&apmlogrus.Hook{
-		LogLevels: logrus.AllLevels,
+
+	// The batch handler writes the messages through the usecase directly, so the settings of the event handler could not apply to it.
+	if dlqBatchSize > 1 {
+		if consumerWorkers > 1 || breakerWindowSize > 0 || eventHandlerTimeout > 0 {
+			logger.Fatal("DLQ_BATCH_SIZE could not be combined with CONSUMER_WORKERS, CIRCUIT_BREAKER_WINDOW_SIZE or EVENT_HANDLER_TIMEOUT")
+		}
+		if dlqFlushInterval <= 0 {
+			logger.Fatal("DLQ_FLUSH_INTERVAL must be positive when DLQ_BATCH_SIZE is set")
+		}
+		logger.Info("the DLQ messages are written in batches without the event handler middlewares")
+	}
+
+	tracing, err := newTracing(logger, tracingConfig{
+		ServiceName:  serviceName,
+		Backend:      tracingBackend,
+		Exporter:     otelExporter,
+		ExporterFile: otelExporterFile,
 	})
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	storage, err := newStorage(logger, storageConfig{
+		ServiceName:     serviceName,
+		Backend:         storageBackend,
+		MongoDBURL:      mongodbURL,
+		MongoDBDatabase: mongodbDatabase,
+		CommandMonitor:  tracing.CommandMonitor,
+		BoltPath:        boltPath,
+		PostgresURL:     postgresURL,
+		RetentionGrace:  retentionGrace,
+	})
+	if err != nil {
+		logger.Fatal(err)
+	}
+	if *migrateOnly {
+		storage.Close(context.Background())
+		tracing.Shutdown(context.Background())
+		return
+	}
 
-	mongodbClient, err := mongo.NewClient(
-		options.Client().
-			SetAppName(serviceName).
-			ApplyURI(mongodbURL).
-			SetConnectTimeout(time.Second * 10).
-			SetMonitor(apmmongo.CommandMonitor()),
-	)
+	router := mux.NewRouter()
+	tracing.Instrument(router)
 
+	apiKeys, err := auth.ParseAPIKeys(os.Getenv("API_KEYS"))
 	if err != nil {
 		logger.Fatal(err)
 	}
+	router.Use(controller.AuthMiddleware(logger, apiKeys))
 
-	dbClient := mongodb.NewClientAdapter(mongodbClient)
-	if dbClient.Connect(context.Background()); err != nil {
-		logger.Fatal((err))
+	// The messages are encrypted at rest when the key file is configured, they are compressed before they are encrypted.
+	dlqRepository := storage.DLQRepository
+	var keyProvider encryption.KeyProvider
+	if encryptionKeyFile != "" {
+		if keyProvider, err = encryption.NewFileKeyProvider(encryptionKeyFile); err != nil {
+			logger.Fatal(err)
+		}
+		dlqRepository = repository.NewEncryptedDLQRepository(logger, dlqRepository, &repository.EncryptionConfig{
+			Provider: keyProvider,
+			Headers:  encryptionHeaders,
+		})
 	}
 
-	db := dbClient.Database(mongodbDatabase)
+	// The payloads that are stored compressed are read whatever compression is configured.
+	dlqRepository, err = repository.NewCompressedDLQRepository(logger, dlqRepository, &repository.CompressionConfig{
+		Codec:     storageCompression,
+		Threshold: storageCompressionThreshold,
+	})
+	if err != nil {
+		logger.Fatal(err)
+	}
+	asyncProducer, err := sarama.NewAsyncProducer(kafkaBrokers, sarama.NewConfig())
+	if err != nil {
+		logger.Fatal(err)
+	}
+	publisher := eventbus.NewSaramaKafkaProducerAdapter(logger, &eventbus.SaramaKafkaProducerAdapterConfig{
+		AsyncProducer: asyncProducer,
+		Tracer:        tracing.Tracer,
+	})
 
-	router := mux.NewRouter()
-	apmgorilla.Instrument(router)
+	// The payloads are not decoded when neither the remote nor the local schema registry is configured.
+	var serde schemaregistry.Serde
+	switch {
+	case schemaRegistryURL != "":
+		serde = schemaregistry.NewSerde(schemaregistry.NewHTTPRegistry(schemaRegistryURL, &http.Client{Timeout: time.Second * 5}))
+	case schemaRegistryDir != "":
+		serde = schemaregistry.NewSerde(schemaregistry.NewFileRegistry(schemaRegistryDir))
+	}
+
+	retentionPolicy, err := usecase.ParseRetentionPolicy(os.Getenv("RETENTION_POLICY"))
+	if err != nil {
+		logger.Fatal(err)
+	}
+	if len(retentionPolicy) > 0 && (archiveDir == "" || archiveInterval <= 0) {
+		logger.Warn("RETENTION_POLICY is set without ARCHIVE_DIR and ARCHIVE_INTERVAL, the expired messages are kept since only the archived messages are removed")
+	}
+
+	// The payloads are kept in the database whatever their size is when the blob store is not configured.
+	var payloadOffload *usecase.PayloadOffloadConfig
+	if blobStoreDir != "" && blobOffloadThreshold > 0 {
+		payloadOffload = &usecase.PayloadOffloadConfig{
+			Store:     blobstore.NewFileStore(blobStoreDir),
+			Threshold: blobOffloadThreshold,
+			Provider:  keyProvider,
+		}
+	}
+
+	archiverCtx, stopArchiver := context.WithCancel(context.Background())
+	if archiveDir != "" && archiveInterval > 0 {
+		archiverConfig := &usecase.DLQArchiverConfig{
+			Dir:       archiveDir,
+			Interval:  archiveInterval,
+			BatchSize: 1000,
+			Retention: retentionPolicy,
+		}
+		// The payloads that are offloaded before the blob store is turned off are still archived.
+		if blobStoreDir != "" {
+			archiverConfig.Store = blobstore.NewFileStore(blobStoreDir)
+		}
+		archiver := usecase.NewDLQArchiver(logger, dlqRepository, archiverConfig)
+		go archiver.Run(archiverCtx)
+	}
 
-	dlqRepository := repository.NewDLQRepository(logger, db)
-	dlqUsecase := usecase.NewDLQUsecase(logger, dlqRepository)
+	keyRotatorCtx, stopKeyRotator := context.WithCancel(context.Background())
+	if keyProvider != nil && keyRotationInterval > 0 {
+		keyRotator := usecase.NewKeyRotator(logger, dlqRepository, keyProvider, &usecase.KeyRotatorConfig{
+			Interval:  keyRotationInterval,
+			BatchSize: 1000,
+		})
+		go keyRotator.Run(keyRotatorCtx)
+	}
+
+	// The messages are returned and logged as they are when the redaction rules are not configured.
+	var redactor redaction.Redactor
+	if redactionRulesFile != "" {
+		rules, err := redaction.LoadRules(redactionRulesFile)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		if redactor, err = redaction.NewRedactor(rules); err != nil {
+			logger.Fatal(err)
+		}
+	}
+
+	dlqUsecase := usecase.NewDLQUsecase(logger, publisher, dlqRepository, serde, retentionPolicy, payloadOffload, redactor)
 	controller.InitDLQController(logger, router, dlqUsecase)
 
 	consumerGroupClient, err := sarama.NewConsumerGroup(kafkaBrokers, serviceName, sarama.NewConfig())
 	if err != nil {
 		logger.Fatal(err)
 	}
-	consumerGroupHandler := eventbus.NewDefaultSaramaConsumerGroupHandler(tracer, serviceName, eventhandler.NewDLQEventHandler(logger, dlqUsecase), nil)
+	subscriptionRepository := storage.SubscriptionRepository
+	topics := []string{"dead-letter-queue"}
+	if subscription, err := subscriptionRepository.FindByID(context.Background(), serviceName); err == nil {
+		topics = subscription.Topics
+	}
+
+	middlewares := []eventbus.Middleware{
+		eventbus.LoggingMiddleware(logger),
+		eventbus.TracingMiddleware(tracing.Tracer, "DLQ Event Handler"),
+		eventbus.MetricsMiddleware(tracing.Meter, "dlq-event-handler"),
+	}
+	// The partition breaker only works when a partition is handled one message at a time,
+	// with the workers the breaker guards the event handler instead and pauses the partitions of the held messages.
+	var handlerBreakerConfig *eventbus.CircuitBreakerConfig
+	if breakerWindowSize > 0 && consumerWorkers > 1 {
+		handlerBreakerConfig = &eventbus.CircuitBreakerConfig{
+			Name:         "dlq-event-handler",
+			WindowSize:   breakerWindowSize,
+			FailureRatio: breakerFailureRatio,
+			CoolDown:     breakerCoolDown,
+			Meter:        tracing.Meter,
+		}
+		if err := handlerBreakerConfig.Validate(); err != nil {
+			logger.Fatal(err)
+		}
+		middlewares = append(middlewares, eventbus.CircuitBreakerMiddleware(logger, handlerBreakerConfig))
+	}
+	if eventHandlerTimeout > 0 {
+		middlewares = append(middlewares, eventbus.TimeoutMiddleware(eventHandlerTimeout))
+	}
+	// The recover is the innermost middleware, so the panic is logged, traced, counted and trips the breaker like any other error.
+	middlewares = append(middlewares, eventbus.RecoverMiddleware())
+	dlqEventHandler := eventbus.Chain(eventhandler.NewDLQEventHandler(logger, dlqUsecase), middlewares...)
+
+	var consumerGroupHandler sarama.ConsumerGroupHandler
+	defaultConsumerGroupHandler := eventbus.NewDefaultSaramaConsumerGroupHandler(tracing.Tracer, serviceName, dlqEventHandler, nil)
+	defaultConsumerGroupHandler.SetConsumerGroup(serviceName)
+	if redactor != nil {
+		defaultConsumerGroupHandler.SetRedactor(redactor)
+	}
+	consumerGroupHandler = defaultConsumerGroupHandler
+	if dlqBatchSize > 1 {
+		// The DLQ messages are written in bulk, the offsets are marked once the batch is durably written.
+		batchConsumerGroupHandler := eventbus.NewBatchSaramaConsumerGroupHandler(
+			tracing.Tracer, serviceName, eventhandler.NewDLQBatchEventHandler(logger, dlqUsecase), nil,
+			&eventbus.BatchSaramaConsumerGroupHandlerConfig{
+				BatchSize:     dlqBatchSize,
+				FlushInterval: dlqFlushInterval,
+				MaxRetries:    dlqMaxRetries,
+				RetryBackoff:  dlqRetryBackoff,
+			})
+		batchConsumerGroupHandler.SetConsumerGroup(serviceName)
+		consumerGroupHandler = batchConsumerGroupHandler
+	}
+
 	subscriber := eventbus.NewSaramaKafkaConsumserGroupAdapter(
 		logger, &eventbus.SaramaKafkaConsumserGroupAdapterConfig{
 			ConsumerGroupClient:  consumerGroupClient,
 			ConsumerGroupHandler: consumerGroupHandler,
-			Topics:               []string{"dead-letter-queue"},
+			Topics:               topics,
 		})
+	defaultConsumerGroupHandler.SetConcurrency(consumerWorkers)
+	if handlerBreakerConfig != nil {
+		handlerBreakerConfig.Pauser = subscriber
+	}
+	if breakerWindowSize > 0 && consumerWorkers <= 1 {
+		breakerConfig := &eventbus.PartitionBreakerConfig{
+			Pauser:       subscriber,
+			WindowSize:   breakerWindowSize,
+			FailureRatio: breakerFailureRatio,
+			CoolDown:     breakerCoolDown,
+			MaxProbes:    breakerMaxProbes,
+		}
+		if err := breakerConfig.Validate(); err != nil {
+			logger.Fatal(err)
+		}
+		defaultConsumerGroupHandler.SetPartitionBreaker(breakerConfig)
+	}
 	subscriber.Subscribe()
 
+	subscriptionUsecase := usecase.NewSubscriptionUsecase(logger, serviceName, subscriber, subscriptionRepository)
+	controller.InitSubscriptionController(logger, router, subscriptionUsecase)
+
 	httpServer := &http.Server{
 		Addr:    fmt.Sprintf(":%d", servicePort),
 		Handler: router,
@@ -115,6 +329,10 @@ func main() {
 	<-sigterm
 
 	httpServer.Shutdown(context.Background())
+	stopArchiver()
+	stopKeyRotator()
 	subscriber.Close()
-	dbClient.Disconnect(context.Background())
+	publisher.Close()
+	storage.Close(context.Background())
+	tracing.Shutdown(context.Background())
 }
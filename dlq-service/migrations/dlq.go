@@ -0,0 +1,263 @@
+package migrations
+
+import (
+	"context"
+	"time"
+
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/entity"
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/mongodb"
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/repository"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// DLQMigrations is the migrations of the DLQ service, append the new ones with the next version.
+func DLQMigrations() []Migration {
+	return []Migration{
+		{
+			Version:     1,
+			Description: "create the unique index of the message id",
+			Up: CreateIndex(repository.DLQMessageCollection, mongo.IndexModel{
+				Keys:    bson.D{{Key: "id", Value: 1}},
+				Options: options.Index().SetName("dlq_id").SetUnique(true),
+			}),
+		},
+		{
+			Version:     2,
+			Description: "create the unique index of the DLQ topic coordinates",
+			Up: CreateIndex(repository.DLQMessageCollection, mongo.IndexModel{
+				Keys: bson.D{
+					{Key: "dlqTopic", Value: 1},
+					{Key: "dlqPartition", Value: 1},
+					{Key: "dlqOffset", Value: 1},
+				},
+				Options: options.Index().
+					SetName("dlq_coordinates").
+					SetUnique(true).
+					SetPartialFilterExpression(bson.M{"dlqTopic": bson.M{"$exists": true}}),
+			}),
+		},
+		{
+			Version:     3,
+			Description: "convert the string dates of the messages to dates",
+			Up:          migrateDates,
+		},
+		{
+			Version:     4,
+			Description: "backfill the status of the messages",
+			Up:          backfillStatus,
+		},
+		{
+			Version:     5,
+			Description: "create the unique index of the subscription id",
+			Up: CreateIndex(repository.SubscriptionCollection, mongo.IndexModel{
+				Keys:    bson.D{{Key: "id", Value: 1}},
+				Options: options.Index().SetName("dlq_subscription_id").SetUnique(true),
+			}),
+		},
+		{
+			Version:     6,
+			Description: "backfill the payload sizes of the messages",
+			Up:          backfillMessageSizes,
+		},
+		{
+			Version:     7,
+			Description: "create the index of the key ID of the encrypted messages",
+			Up: CreateIndex(repository.DLQMessageCollection, mongo.IndexModel{
+				Keys: bson.D{{Key: "encryption.keyId", Value: 1}},
+				Options: options.Index().
+					SetName("dlq_encryption_key_id").
+					SetPartialFilterExpression(bson.M{"encryption": bson.M{"$exists": true}}),
+			}),
+		},
+		{
+			Version:     8,
+			Description: "create the index of the message status",
+			Up: CreateIndex(repository.DLQMessageCollection, mongo.IndexModel{
+				Keys:    bson.D{{Key: "status", Value: 1}},
+				Options: options.Index().SetName("dlq_status"),
+			}),
+		},
+		{
+			Version:     9,
+			Description: "create the index of the listing order of the messages by their status",
+			Up: CreateIndex(repository.DLQMessageCollection, mongo.IndexModel{
+				Keys: bson.D{
+					{Key: "status", Value: 1},
+					{Key: "ingestedAt", Value: 1},
+					{Key: "_id", Value: 1},
+				},
+				Options: options.Index().SetName("dlq_status_ingested_at"),
+			}),
+		},
+	}
+}
+
+// backfillStatus sets the messages that are stored before the status as new ones.
+func backfillStatus(ctx context.Context, db mongodb.Database) (err error) {
+	filter := bson.M{
+		"status": bson.M{"$exists": false},
+	}
+	update := bson.M{
+		"$set": bson.M{"status": entity.MessageStatusNew},
+	}
+
+	_, err = db.Collection(repository.DLQMessageCollection).UpdateMany(ctx, filter, update)
+
+	return
+}
+
+// backfillMessageSizes records the sizes of the payloads that are stored before the compression, they are stored as they are.
+func backfillMessageSizes(ctx context.Context, db mongodb.Database) (err error) {
+	collection := db.Collection(repository.DLQMessageCollection)
+
+	filter := bson.M{
+		"storedMessageSize": bson.M{"$exists": false},
+	}
+	options := options.Find().SetProjection(bson.M{"_id": 1, "message": 1})
+
+	cursor, err := collection.Find(ctx, filter, options)
+	if err != nil {
+		return
+	}
+	defer cursor.Close(ctx)
+
+	var models []mongo.WriteModel
+	flush := func() (err error) {
+		if len(models) < 1 {
+			return
+		}
+
+		if _, err = collection.BulkWrite(ctx, models); err != nil {
+			return
+		}
+		models = models[:0]
+
+		return
+	}
+
+	for cursor.Next(ctx) {
+		var document struct {
+			ID      primitive.ObjectID `bson:"_id"`
+			Message []byte             `bson:"message"`
+		}
+		if err = cursor.Decode(&document); err != nil {
+			return
+		}
+
+		size := int64(len(document.Message))
+		models = append(models, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"_id": document.ID}).
+			SetUpdate(bson.M{"$set": bson.M{"messageSize": size, "storedMessageSize": size}}))
+
+		if len(models) >= 500 {
+			if err = flush(); err != nil {
+				return
+			}
+		}
+	}
+
+	err = flush()
+
+	return
+}
+
+// migrateDates converts the RFC3339 strings of the dates that are stored before they are BSON dates,
+// and sets the missing `ingestedAt` and `updatedAt` to the creation time of the document.
+func migrateDates(ctx context.Context, db mongodb.Database) (err error) {
+	collection := db.Collection(repository.DLQMessageCollection)
+
+	filter := bson.M{
+		"$or": bson.A{
+			bson.M{"failedConsumeDate": bson.M{"$type": "string"}},
+			bson.M{"producedDate": bson.M{"$type": "string"}},
+			bson.M{"ingestedAt": bson.M{"$exists": false}},
+		},
+	}
+	options := options.Find().SetProjection(bson.M{"_id": 1, "failedConsumeDate": 1, "producedDate": 1, "ingestedAt": 1})
+
+	cursor, err := collection.Find(ctx, filter, options)
+	if err != nil {
+		return
+	}
+	defer cursor.Close(ctx)
+
+	var models []mongo.WriteModel
+	flush := func() (err error) {
+		if len(models) < 1 {
+			return
+		}
+
+		if _, err = collection.BulkWrite(ctx, models); err != nil {
+			return
+		}
+		models = models[:0]
+
+		return
+	}
+
+	for cursor.Next(ctx) {
+		var document struct {
+			ID                primitive.ObjectID `bson:"_id"`
+			FailedConsumeDate interface{}        `bson:"failedConsumeDate"`
+			ProducedDate      interface{}        `bson:"producedDate"`
+			IngestedAt        interface{}        `bson:"ingestedAt"`
+		}
+		if err = cursor.Decode(&document); err != nil {
+			return
+		}
+
+		models = append(models, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"_id": document.ID}).
+			SetUpdate(dateMigrationUpdate(document.ID.Timestamp().UTC(), document.FailedConsumeDate, document.ProducedDate, document.IngestedAt)))
+
+		if len(models) >= 500 {
+			if err = flush(); err != nil {
+				return
+			}
+		}
+	}
+
+	err = flush()
+
+	return
+}
+
+// dateMigrationUpdate falls back to the creation time of the document for the date that is not parsable.
+func dateMigrationUpdate(createdAt time.Time, failedConsumeDate, producedDate, ingestedAt interface{}) bson.M {
+	set := bson.M{}
+	unset := bson.M{}
+
+	if value, ok := failedConsumeDate.(string); ok {
+		failedAt, err := time.Parse(time.RFC3339Nano, value)
+		if err != nil {
+			failedAt = createdAt
+		}
+		set["failedConsumeDate"] = failedAt
+	}
+
+	if value, ok := producedDate.(string); ok {
+		if producedAt, err := time.Parse(time.RFC3339Nano, value); err == nil {
+			set["producedDate"] = producedAt
+		} else {
+			unset["producedDate"] = ""
+		}
+	}
+
+	if ingestedAt == nil {
+		set["ingestedAt"] = createdAt
+		set["updatedAt"] = createdAt
+	}
+
+	update := bson.M{}
+	if len(set) > 0 {
+		update["$set"] = set
+	}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+
+	return update
+}
@@ -0,0 +1,140 @@
+package migrations_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/migrations"
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/mongodb"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// documentCursor iterates over the documents of a `documentCollection`.
+type documentCursor struct {
+	documents []bson.M
+	next      int
+}
+
+func (c *documentCursor) ID() int64 { return 0 }
+
+func (c *documentCursor) Next(ctx context.Context) bool {
+	c.next++
+	return c.next <= len(c.documents)
+}
+
+func (c *documentCursor) Decode(val interface{}) (err error) {
+	raw, err := bson.Marshal(c.documents[c.next-1])
+	if err != nil {
+		return
+	}
+
+	return bson.Unmarshal(raw, val)
+}
+
+func (c *documentCursor) Close(ctx context.Context) error { return nil }
+
+// documentCollection finds all of its documents and keeps the written models, the other behavior is not used by the tests.
+type documentCollection struct {
+	mongodb.Collection
+	documents []bson.M
+	written   []mongo.WriteModel
+}
+
+func (c *documentCollection) Find(ctx context.Context, filter interface{}, opts ...*options.FindOptions) (cursor mongodb.Cursor, err error) {
+	return &documentCursor{documents: c.documents}, nil
+}
+
+func (c *documentCollection) BulkWrite(ctx context.Context, models []mongo.WriteModel, opts ...*options.BulkWriteOptions) (result *mongo.BulkWriteResult, err error) {
+	c.written = append(c.written, models...)
+	return &mongo.BulkWriteResult{}, nil
+}
+
+type documentDatabase struct {
+	mongodb.Database
+	collection *documentCollection
+}
+
+func (db *documentDatabase) Collection(name string, opts ...*options.CollectionOptions) (col mongodb.Collection) {
+	return db.collection
+}
+
+func migrationOf(t *testing.T, version int) migrations.Migration {
+	for _, migration := range migrations.DLQMigrations() {
+		if migration.Version == version {
+			return migration
+		}
+	}
+
+	t.Fatalf("migration %d is not found", version)
+	return migrations.Migration{}
+}
+
+func TestDLQMigrations_ConvertDates(t *testing.T) {
+	createdAt := time.Date(2021, 6, 30, 10, 0, 0, 0, time.UTC)
+	failedAt := time.Date(2021, 6, 30, 9, 0, 0, 0, time.UTC)
+	producedAt := time.Date(2021, 6, 30, 8, 0, 0, 0, time.UTC)
+	ingestedAt := time.Date(2021, 6, 30, 11, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name     string
+		document bson.M
+		expected bson.M
+	}{
+		{
+			name: "valid dates",
+			document: bson.M{
+				"failedConsumeDate": failedAt.Format(time.RFC3339),
+				"producedDate":      producedAt.Format(time.RFC3339),
+				"ingestedAt":        ingestedAt,
+			},
+			expected: bson.M{
+				"$set": bson.M{"failedConsumeDate": failedAt, "producedDate": producedAt},
+			},
+		},
+		{
+			name: "invalid dates fall back to the creation time and the produced date is removed",
+			document: bson.M{
+				"failedConsumeDate": "30/06/2021",
+				"producedDate":      "yesterday",
+				"ingestedAt":        ingestedAt,
+			},
+			expected: bson.M{
+				"$set":   bson.M{"failedConsumeDate": createdAt},
+				"$unset": bson.M{"producedDate": ""},
+			},
+		},
+		{
+			name: "missing ingested date is backfilled with the creation time",
+			document: bson.M{
+				"failedConsumeDate": failedAt,
+			},
+			expected: bson.M{
+				"$set": bson.M{"ingestedAt": createdAt, "updatedAt": createdAt},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ID := primitive.NewObjectIDFromTimestamp(createdAt)
+			tc.document["_id"] = ID
+
+			db := &documentDatabase{collection: &documentCollection{documents: []bson.M{tc.document}}}
+			err := migrationOf(t, 3).Up(context.TODO(), db)
+
+			assert.NoError(t, err)
+			if !assert.Len(t, db.collection.written, 1) {
+				return
+			}
+
+			updateOneModel := db.collection.written[0].(*mongo.UpdateOneModel)
+			assert.Equal(t, bson.M{"_id": ID}, updateOneModel.Filter)
+			assert.Equal(t, tc.expected, updateOneModel.Update)
+		})
+	}
+}
@@ -0,0 +1,285 @@
+package migrations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/mongodb"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Migration is a versioned change of the database.
+// It must be idempotent, it is run again when the migrator stops before the version is recorded.
+type Migration struct {
+	Version     int
+	Description string
+	Up          func(ctx context.Context, db mongodb.Database) (err error)
+}
+
+// Migrator runs the migrations which are newer than the version of the database.
+type Migrator interface {
+	// Migrate holds the lock of the database while the migrations are run, so only one replica runs them.
+	Migrate(ctx context.Context) (applied []int, err error)
+}
+
+// MigratorConfig is a configuration of the migrator.
+type MigratorConfig struct {
+	// LockTTL is how long the lock is held before another replica may take it over,
+	// it is renewed every third of the TTL while the migrations are run.
+	LockTTL time.Duration
+	// LockPollInterval is how often the lock is tried again while another replica holds it.
+	LockPollInterval time.Duration
+	// Repeatables are run after the versioned migrations on every run while the lock is still held, they must be idempotent.
+	// They are the changes that depend on the configuration, e.g. the options of an index.
+	Repeatables []func(ctx context.Context, db mongodb.Database) (err error)
+}
+
+const (
+	migrationCollection = "dlq-migration"
+	versionDocumentID   = "version"
+	lockDocumentID      = "lock"
+)
+
+type migrator struct {
+	logger     *logrus.Logger
+	db         mongodb.Database
+	config     *MigratorConfig
+	owner      string
+	migrations []Migration
+}
+
+// NewMigrator is a constructor.
+func NewMigrator(logger *logrus.Logger, db mongodb.Database, config *MigratorConfig, migrations []Migration) Migrator {
+	hostname, _ := os.Hostname()
+
+	sorted := append([]Migration{}, migrations...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Version < sorted[j].Version
+	})
+
+	return &migrator{
+		logger:     logger,
+		db:         db,
+		config:     config,
+		owner:      fmt.Sprintf("%s:%d", hostname, os.Getpid()),
+		migrations: sorted,
+	}
+}
+
+func (m *migrator) Migrate(ctx context.Context) (applied []int, err error) {
+	collection := m.db.Collection(migrationCollection)
+
+	// The lock relies on the unique id, a replica that fails to upsert the held lock waits for it.
+	_, err = collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "id", Value: 1}},
+		Options: options.Index().SetName("dlq_migration_id").SetUnique(true),
+	})
+	if err != nil {
+		return
+	}
+
+	if err = m.lock(ctx); err != nil {
+		return
+	}
+	defer m.unlock()
+
+	// The migrations are run with the context of the heartbeat, so they are stopped once the lock is lost.
+	ctx, stop := m.heartbeat(ctx)
+	defer stop()
+
+	version, err := m.version(ctx)
+	if err != nil {
+		return
+	}
+
+	for _, migration := range m.migrations {
+		if migration.Version <= version {
+			continue
+		}
+
+		m.logger.Infof("[Migrator] Migrating to version %d: %s", migration.Version, migration.Description)
+		if err = migration.Up(ctx, m.db); err != nil {
+			err = fmt.Errorf("migration %d (%s): %w", migration.Version, migration.Description, err)
+			return
+		}
+
+		if err = m.setVersion(ctx, migration); err != nil {
+			return
+		}
+
+		applied = append(applied, migration.Version)
+	}
+
+	for _, repeatable := range m.config.Repeatables {
+		if err = repeatable(ctx, m.db); err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+func (m *migrator) lock(ctx context.Context) (err error) {
+	collection := m.db.Collection(migrationCollection)
+
+	for {
+		now := time.Now().UTC()
+		filter := bson.M{
+			"id": lockDocumentID,
+			"$or": bson.A{
+				bson.M{"owner": m.owner},
+				bson.M{"expireAt": bson.M{"$lte": now}},
+			},
+		}
+		update := bson.M{
+			"$set": bson.M{
+				"owner":    m.owner,
+				"lockedAt": now,
+				"expireAt": now.Add(m.config.LockTTL),
+			},
+		}
+
+		_, err = collection.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+		if err == nil || !mongo.IsDuplicateKeyError(err) {
+			return
+		}
+
+		m.logger.Info("[Migrator] Waiting for the migration lock which is held by another replica")
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(m.config.LockPollInterval):
+		}
+	}
+}
+
+// heartbeat renews the lock every third of its TTL until it is stopped, a migration may take longer than the TTL.
+// The returned context is canceled once the lock is lost, so the migration is stopped before another replica runs it too.
+func (m *migrator) heartbeat(ctx context.Context) (heartbeatCtx context.Context, stop func()) {
+	heartbeatCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+
+	go func() {
+		defer close(stopped)
+
+		ticker := time.NewTicker(m.config.LockTTL / 3)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-heartbeatCtx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			if err := m.renew(heartbeatCtx); err != nil {
+				m.logger.Errorf("[Migrator] The migration lock is lost, the migration is stopped | %s", err.Error())
+				cancel()
+				return
+			}
+		}
+	}()
+
+	stop = func() {
+		close(done)
+		<-stopped
+		cancel()
+	}
+
+	return
+}
+
+// renew extends the lock that is held by the migrator, it fails once another replica has taken the lock over.
+func (m *migrator) renew(ctx context.Context) (err error) {
+	filter := bson.M{
+		"id":    lockDocumentID,
+		"owner": m.owner,
+	}
+	update := bson.M{
+		"$set": bson.M{"expireAt": time.Now().UTC().Add(m.config.LockTTL)},
+	}
+
+	result, err := m.db.Collection(migrationCollection).UpdateOne(ctx, filter, update)
+	if err != nil {
+		return
+	}
+	if result.MatchedCount < 1 {
+		err = errors.New("the lock is held by another replica")
+	}
+
+	return
+}
+
+func (m *migrator) unlock() {
+	filter := bson.M{
+		"id":    lockDocumentID,
+		"owner": m.owner,
+	}
+
+	if _, err := m.db.Collection(migrationCollection).DeleteOne(context.Background(), filter); err != nil {
+		m.logger.Error(err)
+	}
+}
+
+func (m *migrator) version(ctx context.Context) (version int, err error) {
+	var document struct {
+		Version int `bson:"version"`
+	}
+
+	err = m.db.Collection(migrationCollection).FindOne(ctx, bson.M{"id": versionDocumentID}).Decode(&document)
+	if err == mongo.ErrNoDocuments {
+		err = nil
+	}
+	version = document.Version
+
+	return
+}
+
+func (m *migrator) setVersion(ctx context.Context, migration Migration) (err error) {
+	filter := bson.M{
+		"id": versionDocumentID,
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"version":     migration.Version,
+			"description": migration.Description,
+			"appliedAt":   time.Now().UTC(),
+		},
+	}
+
+	_, err = m.db.Collection(migrationCollection).UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+
+	return
+}
+
+// CreateIndex returns the migration step that creates the index of the collection, an existing index with the same name is kept.
+func CreateIndex(collection string, model mongo.IndexModel) func(ctx context.Context, db mongodb.Database) (err error) {
+	return func(ctx context.Context, db mongodb.Database) (err error) {
+		_, err = db.Collection(collection).Indexes().CreateOne(ctx, model)
+		return
+	}
+}
+
+// RenameCollection returns the migration step that renames the collection, it does nothing once the collection is renamed.
+func RenameCollection(from, to string) func(ctx context.Context, db mongodb.Database) (err error) {
+	return func(ctx context.Context, db mongodb.Database) (err error) {
+		names, err := db.ListCollectionNames(ctx, bson.M{"name": from})
+		if err != nil || len(names) < 1 {
+			return
+		}
+
+		err = db.RenameCollection(ctx, from, to)
+		return
+	}
+}
@@ -0,0 +1,271 @@
+package migrations_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/migrations"
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/mongodb"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const migrationCollection = "dlq-migration"
+
+// newMongoDB returns an empty database that is dropped once the test is done,
+// the tests of the migrator are skipped unless `MONGODB_TEST_URL` is set.
+func newMongoDB(t *testing.T) mongodb.Database {
+	mongodbURL := os.Getenv("MONGODB_TEST_URL")
+	if mongodbURL == "" {
+		t.Skip("MONGODB_TEST_URL is not set, `make test-integration` runs the test against a mongodb container")
+	}
+
+	ctx := context.TODO()
+	mongodbClient, err := mongo.Connect(ctx, options.Client().ApplyURI(mongodbURL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := fmt.Sprintf("dlq-service-migrations-test-%d", time.Now().UnixNano())
+	t.Cleanup(func() {
+		mongodbClient.Database(name).Drop(ctx)
+		mongodbClient.Disconnect(ctx)
+	})
+
+	return mongodb.NewClientAdapter(mongodbClient).Database(name)
+}
+
+func newMigrator(db mongodb.Database, bunchOfMigration []migrations.Migration, repeatables ...func(ctx context.Context, db mongodb.Database) (err error)) migrations.Migrator {
+	return migrations.NewMigrator(logrus.New(), db, &migrations.MigratorConfig{
+		LockTTL:          time.Minute,
+		LockPollInterval: time.Millisecond * 10,
+		Repeatables:      repeatables,
+	}, bunchOfMigration)
+}
+
+// countedMigration counts how many times it is run in the calls.
+func countedMigration(version int, calls map[int]int) migrations.Migration {
+	return migrations.Migration{
+		Version:     version,
+		Description: fmt.Sprintf("migration %d", version),
+		Up: func(ctx context.Context, db mongodb.Database) (err error) {
+			calls[version]++
+			return
+		},
+	}
+}
+
+func versionOf(t *testing.T, db mongodb.Database) int {
+	var document struct {
+		Version int `bson:"version"`
+	}
+	if err := db.Collection(migrationCollection).FindOne(context.TODO(), bson.M{"id": "version"}).Decode(&document); err != nil {
+		t.Fatal(err)
+	}
+
+	return document.Version
+}
+
+func TestMigrator_Migrate_VersionBookkeeping(t *testing.T) {
+	ctx := context.TODO()
+	db := newMongoDB(t)
+	calls := make(map[int]int)
+
+	// The migrations are run in the order of their version whatever order they are given in.
+	applied, err := newMigrator(db, []migrations.Migration{countedMigration(2, calls), countedMigration(1, calls)}).Migrate(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []int{1, 2}, applied)
+	assert.Equal(t, 2, versionOf(t, db))
+
+	applied, err = newMigrator(db, []migrations.Migration{countedMigration(1, calls), countedMigration(2, calls)}).Migrate(ctx)
+	assert.NoError(t, err)
+	assert.Empty(t, applied)
+
+	applied, err = newMigrator(db, []migrations.Migration{countedMigration(1, calls), countedMigration(2, calls), countedMigration(3, calls)}).Migrate(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []int{3}, applied)
+	assert.Equal(t, 3, versionOf(t, db))
+	assert.Equal(t, map[int]int{1: 1, 2: 1, 3: 1}, calls)
+}
+
+func TestMigrator_Migrate_FailedMigration(t *testing.T) {
+	ctx := context.TODO()
+	db := newMongoDB(t)
+	calls := make(map[int]int)
+
+	failed := migrations.Migration{
+		Version:     2,
+		Description: "failed migration",
+		Up: func(ctx context.Context, db mongodb.Database) (err error) {
+			return errors.New("failed")
+		},
+	}
+
+	applied, err := newMigrator(db, []migrations.Migration{countedMigration(1, calls), failed, countedMigration(3, calls)}).Migrate(ctx)
+	assert.Error(t, err)
+	assert.Equal(t, []int{1}, applied)
+	assert.Equal(t, 1, versionOf(t, db))
+
+	// The failed migration is run again, the applied ones are not.
+	applied, err = newMigrator(db, []migrations.Migration{countedMigration(1, calls), countedMigration(2, calls), countedMigration(3, calls)}).Migrate(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []int{2, 3}, applied)
+	assert.Equal(t, map[int]int{1: 1, 2: 1, 3: 1}, calls)
+}
+
+func TestMigrator_Migrate_Lock(t *testing.T) {
+	ctx := context.TODO()
+	db := newMongoDB(t)
+	calls := make(map[int]int)
+
+	// The first migrate creates the unique index the lock relies on.
+	_, err := newMigrator(db, nil).Migrate(ctx)
+	assert.NoError(t, err)
+
+	held := bson.M{"id": "lock", "owner": "another-replica", "lockedAt": time.Now().UTC(), "expireAt": time.Now().UTC().Add(time.Hour)}
+	_, err = db.Collection(migrationCollection).InsertOne(ctx, held)
+	assert.NoError(t, err)
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, time.Millisecond*100)
+	defer cancel()
+
+	// The lock is held by another replica until the waiting migrator gives up.
+	applied, err := newMigrator(db, []migrations.Migration{countedMigration(1, calls)}).Migrate(timeoutCtx)
+	assert.Error(t, err)
+	assert.Empty(t, applied)
+	assert.Empty(t, calls)
+
+	// The lock of the replica that stopped without releasing it is taken over once it expires.
+	_, err = db.Collection(migrationCollection).UpdateOne(ctx, bson.M{"id": "lock"}, bson.M{"$set": bson.M{"expireAt": time.Now().UTC().Add(-time.Second)}})
+	assert.NoError(t, err)
+
+	applied, err = newMigrator(db, []migrations.Migration{countedMigration(1, calls)}).Migrate(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []int{1}, applied)
+
+	// The lock is released once the migrations are done.
+	counted, err := db.Collection(migrationCollection).CountDocuments(ctx, bson.M{"id": "lock"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), counted)
+}
+
+// lockExpireAt returns when the lock of the migration expires.
+func lockExpireAt(ctx context.Context, db mongodb.Database) (expireAt time.Time, err error) {
+	var document struct {
+		ExpireAt time.Time `bson:"expireAt"`
+	}
+	err = db.Collection(migrationCollection).FindOne(ctx, bson.M{"id": "lock"}).Decode(&document)
+	expireAt = document.ExpireAt
+
+	return
+}
+
+func TestMigrator_Migrate_LockHeartbeat(t *testing.T) {
+	ctx := context.TODO()
+	db := newMongoDB(t)
+
+	// The migration takes longer than the TTL of the lock, the heartbeat keeps the lock from expiring meanwhile.
+	slow := migrations.Migration{
+		Version:     1,
+		Description: "slow migration",
+		Up: func(ctx context.Context, db mongodb.Database) (err error) {
+			for i := 0; i < 6; i++ {
+				time.Sleep(time.Millisecond * 100)
+
+				expireAt, err := lockExpireAt(ctx, db)
+				assert.NoError(t, err)
+				assert.True(t, expireAt.After(time.Now()), "the lock is renewed while the migration is run")
+			}
+			return
+		},
+	}
+
+	migrator := migrations.NewMigrator(logrus.New(), db, &migrations.MigratorConfig{
+		LockTTL:          time.Millisecond * 300,
+		LockPollInterval: time.Millisecond * 10,
+	}, []migrations.Migration{slow})
+
+	applied, err := migrator.Migrate(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []int{1}, applied)
+}
+
+func TestMigrator_Migrate_LockLost(t *testing.T) {
+	ctx := context.TODO()
+	db := newMongoDB(t)
+
+	// Another replica takes the lock over while the migration is run, the migration is stopped by its context.
+	takenOver := migrations.Migration{
+		Version:     1,
+		Description: "taken over migration",
+		Up: func(ctx context.Context, db mongodb.Database) (err error) {
+			_, err = db.Collection(migrationCollection).UpdateOne(ctx, bson.M{"id": "lock"}, bson.M{"$set": bson.M{"owner": "another-replica"}})
+			if err != nil {
+				return
+			}
+
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(time.Second * 5):
+				return
+			}
+		},
+	}
+
+	migrator := migrations.NewMigrator(logrus.New(), db, &migrations.MigratorConfig{
+		LockTTL:          time.Millisecond * 300,
+		LockPollInterval: time.Millisecond * 10,
+	}, []migrations.Migration{takenOver})
+
+	applied, err := migrator.Migrate(ctx)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Empty(t, applied)
+
+	// The lock of the other replica is kept.
+	counted, err := db.Collection(migrationCollection).CountDocuments(ctx, bson.M{"id": "lock", "owner": "another-replica"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), counted)
+}
+
+func TestMigrator_Migrate_Repeatables(t *testing.T) {
+	ctx := context.TODO()
+	db := newMongoDB(t)
+
+	runs := 0
+	repeatable := func(ctx context.Context, db mongodb.Database) (err error) {
+		counted, err := db.Collection(migrationCollection).CountDocuments(ctx, bson.M{"id": "lock"})
+		assert.Equal(t, int64(1), counted, "the repeatable is run under the lock")
+		runs++
+		return
+	}
+
+	for i := 0; i < 2; i++ {
+		_, err := newMigrator(db, nil, repeatable).Migrate(ctx)
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, 2, runs)
+}
+
+func TestDLQMigrations_Idempotent(t *testing.T) {
+	ctx := context.TODO()
+	db := newMongoDB(t)
+
+	applied, err := newMigrator(db, migrations.DLQMigrations()).Migrate(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, applied, len(migrations.DLQMigrations()))
+
+	// Every migration is run again as if the migrator had stopped before the versions were recorded.
+	_, err = db.Collection(migrationCollection).DeleteOne(ctx, bson.M{"id": "version"})
+	assert.NoError(t, err)
+
+	applied, err = newMigrator(db, migrations.DLQMigrations()).Migrate(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, applied, len(migrations.DLQMigrations()))
+}
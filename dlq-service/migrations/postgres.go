@@ -0,0 +1,225 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/repository"
+	"github.com/sirupsen/logrus"
+)
+
+// PostgresMigration is a versioned change of the postgres schema, its statements are run in the transaction
+// that records the version.
+type PostgresMigration struct {
+	Version     int
+	Description string
+	Statements  []string
+}
+
+const (
+	postgresMigrationTable = "dlq_migration"
+	// postgresMigrationLockKey is the key of the advisory lock that is held while the migrations are run.
+	postgresMigrationLockKey = 4_845_517
+)
+
+type postgresMigrator struct {
+	logger     *logrus.Logger
+	db         *sql.DB
+	migrations []PostgresMigration
+}
+
+// NewPostgresMigrator is a constructor, the replicas wait for the advisory lock of the database instead of polling it.
+func NewPostgresMigrator(logger *logrus.Logger, db *sql.DB, migrations []PostgresMigration) Migrator {
+	sorted := append([]PostgresMigration{}, migrations...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Version < sorted[j].Version
+	})
+
+	return &postgresMigrator{
+		logger:     logger,
+		db:         db,
+		migrations: sorted,
+	}
+}
+
+func (m *postgresMigrator) Migrate(ctx context.Context) (applied []int, err error) {
+	// The advisory lock belongs to the session, so the migrations are run on the connection that holds it.
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	if _, err = conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, postgresMigrationLockKey); err != nil {
+		return
+	}
+	defer func() {
+		if _, err := conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, postgresMigrationLockKey); err != nil {
+			m.logger.Error(err)
+		}
+	}()
+
+	_, err = conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS `+postgresMigrationTable+` (
+		version INTEGER PRIMARY KEY,
+		description TEXT NOT NULL,
+		applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`)
+	if err != nil {
+		return
+	}
+
+	var version int
+	if err = conn.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM `+postgresMigrationTable).Scan(&version); err != nil {
+		return
+	}
+
+	for _, migration := range m.migrations {
+		if migration.Version <= version {
+			continue
+		}
+
+		m.logger.Infof("[Migrator] Migrating to version %d: %s", migration.Version, migration.Description)
+		if err = m.apply(ctx, conn, migration); err != nil {
+			err = fmt.Errorf("migration %d (%s): %w", migration.Version, migration.Description, err)
+			return
+		}
+
+		applied = append(applied, migration.Version)
+	}
+
+	return
+}
+
+func (m *postgresMigrator) apply(ctx context.Context, conn *sql.Conn, migration PostgresMigration) (err error) {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+
+	for _, statement := range migration.Statements {
+		if _, err = tx.ExecContext(ctx, statement); err != nil {
+			return
+		}
+	}
+
+	query := `INSERT INTO ` + postgresMigrationTable + ` (version, description) VALUES ($1, $2)`
+	if _, err = tx.ExecContext(ctx, query, migration.Version, migration.Description); err != nil {
+		return
+	}
+
+	err = tx.Commit()
+
+	return
+}
+
+// PostgresMigrations is the migrations of the postgres schema of the DLQ service, append the new ones with the next version.
+func PostgresMigrations() []PostgresMigration {
+	return []PostgresMigration{
+		{
+			Version:     1,
+			Description: "create the message table",
+			Statements: []string{
+				`CREATE TABLE ` + repository.DLQMessageTable + ` (
+					seq BIGSERIAL PRIMARY KEY,
+					id TEXT NOT NULL,
+					channel TEXT NOT NULL,
+					publisher TEXT NOT NULL,
+					consumer TEXT NOT NULL,
+					key BYTEA,
+					headers JSONB NOT NULL DEFAULT '[]',
+					message BYTEA,
+					content_type TEXT NOT NULL,
+					schema_version INTEGER NOT NULL,
+					caused_by TEXT NOT NULL,
+					stack_trace TEXT NOT NULL DEFAULT '',
+					failed_consume_date TIMESTAMPTZ NOT NULL,
+					"partition" INTEGER NOT NULL,
+					"offset" BIGINT NOT NULL,
+					produced_date TIMESTAMPTZ,
+					consumer_group TEXT NOT NULL,
+					instance_id TEXT NOT NULL,
+					attempt INTEGER NOT NULL,
+					dlq_topic TEXT,
+					dlq_partition INTEGER NOT NULL,
+					dlq_offset BIGINT NOT NULL,
+					dlq_key TEXT NOT NULL DEFAULT '',
+					ingested_at TIMESTAMPTZ NOT NULL,
+					updated_at TIMESTAMPTZ NOT NULL,
+					status TEXT NOT NULL,
+					replayed_at TIMESTAMPTZ,
+					expire_at TIMESTAMPTZ,
+					archived_at TIMESTAMPTZ,
+					claimed_until TIMESTAMPTZ
+				)`,
+				`CREATE UNIQUE INDEX dlq_message_id ON ` + repository.DLQMessageTable + ` (id)`,
+			},
+		},
+		{
+			Version:     2,
+			Description: "create the unique index of the DLQ topic coordinates",
+			Statements: []string{
+				`CREATE UNIQUE INDEX dlq_message_coordinates ON ` + repository.DLQMessageTable + ` (dlq_topic, dlq_partition, dlq_offset)
+					WHERE dlq_topic IS NOT NULL`,
+			},
+		},
+		{
+			Version:     3,
+			Description: "create the indexes of the message filters",
+			Statements: []string{
+				`CREATE INDEX dlq_message_channel_status ON ` + repository.DLQMessageTable + ` (channel, status, failed_consume_date)`,
+				`CREATE INDEX dlq_message_status ON ` + repository.DLQMessageTable + ` (status, failed_consume_date)`,
+				`CREATE INDEX dlq_message_consumer_group ON ` + repository.DLQMessageTable + ` (consumer_group, failed_consume_date)`,
+				`CREATE INDEX dlq_message_headers ON ` + repository.DLQMessageTable + ` USING GIN (headers jsonb_path_ops)`,
+			},
+		},
+		{
+			Version:     4,
+			Description: "create the index of the expired messages",
+			Statements: []string{
+				`CREATE INDEX dlq_message_expire_at ON ` + repository.DLQMessageTable + ` (expire_at)`,
+			},
+		},
+		{
+			Version:     5,
+			Description: "create the subscription table",
+			Statements: []string{
+				`CREATE TABLE ` + repository.SubscriptionTable + ` (
+					id TEXT PRIMARY KEY,
+					topics JSONB NOT NULL DEFAULT '[]',
+					updated_at TEXT NOT NULL DEFAULT ''
+				)`,
+			},
+		},
+		{
+			Version:     6,
+			Description: "add the codec and the sizes of the message payload",
+			Statements: []string{
+				`ALTER TABLE ` + repository.DLQMessageTable + `
+					ADD COLUMN message_codec TEXT NOT NULL DEFAULT '',
+					ADD COLUMN message_size BIGINT NOT NULL DEFAULT 0,
+					ADD COLUMN stored_message_size BIGINT NOT NULL DEFAULT 0`,
+				`UPDATE ` + repository.DLQMessageTable + ` SET message_size = COALESCE(octet_length(message), 0),
+					stored_message_size = COALESCE(octet_length(message), 0)`,
+			},
+		},
+		{
+			Version:     7,
+			Description: "add the reference and the checksum of the offloaded message payload",
+			Statements: []string{
+				`ALTER TABLE ` + repository.DLQMessageTable + `
+					ADD COLUMN message_ref TEXT NOT NULL DEFAULT '',
+					ADD COLUMN message_checksum TEXT NOT NULL DEFAULT ''`,
+			},
+		},
+		{
+			Version:     8,
+			Description: "create the index of the archived messages",
+			Statements: []string{
+				`CREATE INDEX dlq_message_archived_at ON ` + repository.DLQMessageTable + ` (archived_at)`,
+			},
+		},
+	}
+}
@@ -1,16 +1,173 @@
 package model
 
-// MessageHeadersParams is a model.
-type MessageHeadersParams map[string]string
+import (
+	"bytes"
+	"encoding/json"
+	"time"
 
-// MessageParams is a model.
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/entity"
+)
+
+// MessageHeaderParams is a model, the value is base64 encoded.
+type MessageHeaderParams struct {
+	Key   string `json:"key"`
+	Value []byte `json:"value"`
+}
+
+// MessageHeadersParams is a model, it keeps the order of the headers and the duplicate keys.
+type MessageHeadersParams []MessageHeaderParams
+
+// UnmarshalJSON decodes both the ordered list (schema version 3) and the object of string values (schema version 1 and 2) in order.
+func (mh *MessageHeadersParams) UnmarshalJSON(data []byte) (err error) {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 || data[0] != '{' {
+		var headers []MessageHeaderParams
+		if err = json.Unmarshal(data, &headers); err != nil {
+			return
+		}
+		*mh = headers
+
+		return
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	if _, err = decoder.Token(); err != nil {
+		return
+	}
+
+	headers := MessageHeadersParams{}
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+
+		var value string
+		if err = decoder.Decode(&value); err != nil {
+			return err
+		}
+
+		headers = append(headers, MessageHeaderParams{Key: token.(string), Value: []byte(value)})
+	}
+	*mh = headers
+
+	return
+}
+
+// MessageParams is a model of the DLQ envelope (schema version 3), the key and the message are base64 encoded.
 type MessageParams struct {
+	SchemaVersion     int                  `json:"schemaVersion"`
 	Channel           string               `json:"channel" validate:"required"`
 	Publisher         string               `json:"publisher" validate:"required"`
 	Consumer          string               `json:"consumer" validate:"required"`
-	Key               string               `json:"key"  validate:"required"`
+	Key               []byte               `json:"key"  validate:"required"`
 	Headers           MessageHeadersParams `json:"headers" validate:"required"`
-	Message           string               `json:"message" validate:"required"`
+	Message           []byte               `json:"message" validate:"required"`
+	ContentType       string               `json:"contentType"`
 	CausedBy          string               `json:"causedBy" validate:"required"`
-	FailedConsumeDate string               `json:"failedConsumeDate" validate:"required"`
+	StackTrace        string               `json:"stackTrace"`
+	FailedConsumeDate time.Time            `json:"failedConsumeDate" validate:"required"`
+	Partition         int32                `json:"partition"`
+	Offset            int64                `json:"offset"`
+	ProducedDate      *time.Time           `json:"producedDate"`
+	ConsumerGroup     string               `json:"consumerGroup"`
+	InstanceID        string               `json:"instanceId"`
+	Attempt           int                  `json:"attempt"`
+
+	// The coordinates of the record on the DLQ topic, they are taken from the kafka message instead of the payload.
+	DLQTopic     string `json:"-"`
+	DLQPartition int32  `json:"-"`
+	DLQOffset    int64  `json:"-"`
+	DLQKey       string `json:"-"`
+}
+
+// Message is a model of the DLQ message of the API, the envelope of the encrypted message is shown without its data key.
+type Message struct {
+	entity.Message
+	Encryption *MessageEncryption `json:"encryption,omitempty"`
+}
+
+// MessageEncryption is a model of the envelope of the encrypted message,
+// the wrapped data key is kept in the storage and the archives only.
+type MessageEncryption struct {
+	KeyID   string   `json:"keyId"`
+	Headers []string `json:"headers,omitempty"`
+}
+
+// NewMessage returns the message of the API.
+func NewMessage(message entity.Message) Message {
+	return Message{Message: message, Encryption: NewMessageEncryption(message.Encryption)}
+}
+
+// NewMessages returns the messages of the API.
+func NewMessages(bunchOfMessage []entity.Message) (messages []Message) {
+	messages = make([]Message, len(bunchOfMessage))
+	for i, message := range bunchOfMessage {
+		messages[i] = NewMessage(message)
+	}
+
+	return
+}
+
+// NewMessageEncryption returns the envelope of the API, nil for the message that is not encrypted.
+func NewMessageEncryption(encryption *entity.MessageEncryption) *MessageEncryption {
+	if encryption == nil {
+		return nil
+	}
+
+	return &MessageEncryption{KeyID: encryption.KeyID, Headers: encryption.Headers}
+}
+
+// MessageDetail is a model of the DLQ message with its payload decoded by the schema registry.
+type MessageDetail struct {
+	entity.Message
+	Encryption     *MessageEncryption `json:"encryption,omitempty"`
+	SchemaID       int                `json:"schemaId,omitempty"`
+	SchemaType     string             `json:"schemaType,omitempty"`
+	DecodedMessage json.RawMessage    `json:"decodedMessage,omitempty"`
+	DecodingError  string             `json:"decodingError,omitempty"`
+}
+
+// RepublishParams is a model, the message is the edited (decoded) payload which replaces the stored one.
+type RepublishParams struct {
+	Message json.RawMessage `json:"message"`
+}
+
+// MessageV1 is a model of the DLQ message of the first version of the list API,
+// the key, the message and the header values are plain strings as they were before the envelope carried bytes.
+// The last value of a duplicate header key is kept.
+type MessageV1 Message
+
+// MarshalJSON encodes the message with the key, the message and the headers of the first version.
+func (m MessageV1) MarshalJSON() ([]byte, error) {
+	type message entity.Message
+
+	headers := make(map[string]string, len(m.Headers))
+	for _, header := range m.Headers {
+		headers[header.Key] = string(header.Value)
+	}
+
+	return json.Marshal(struct {
+		message
+		Encryption *MessageEncryption `json:"encryption,omitempty"`
+		Key        string             `json:"key"`
+		Headers    map[string]string  `json:"headers"`
+		Payload    string             `json:"message"`
+	}{
+		message:    message(m.Message),
+		Encryption: m.Encryption,
+		Key:        string(m.Key),
+		Headers:    headers,
+		Payload:    string(m.Message.Message),
+	})
+}
+
+// NewMessagesV1 returns the messages of the first version of the list API.
+func NewMessagesV1(bunchOfMessage []Message) (bunchOfMessageV1 []MessageV1) {
+	bunchOfMessageV1 = make([]MessageV1, len(bunchOfMessage))
+	for i, message := range bunchOfMessage {
+		bunchOfMessageV1[i] = MessageV1(message)
+	}
+
+	return
 }
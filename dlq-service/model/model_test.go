@@ -0,0 +1,66 @@
+package model_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/entity"
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMessageV1_MarshalJSON(t *testing.T) {
+	message := entity.Message{
+		ID:      "1",
+		Channel: "orders",
+		Key:     []byte("order-1"),
+		Headers: entity.MessageHeaders{
+			{Key: "trace", Value: []byte("first")},
+			{Key: "content-type", Value: []byte("application/json")},
+			{Key: "trace", Value: []byte("second")},
+		},
+		Message:           []byte(`{"id":1}`),
+		CausedBy:          "timeout",
+		FailedConsumeDate: time.Date(2021, 6, 30, 10, 0, 0, 0, time.UTC),
+		Encryption:        &entity.MessageEncryption{KeyID: "2021-11", DataKey: []byte("wrapped")},
+	}
+
+	encoded, err := json.Marshal(model.NewMessagesV1(model.NewMessages([]entity.Message{message})))
+	assert.NoError(t, err)
+
+	var decoded []map[string]interface{}
+	assert.NoError(t, json.Unmarshal(encoded, &decoded))
+	assert.Len(t, decoded, 1)
+	assert.Equal(t, "1", decoded[0]["id"])
+	assert.Equal(t, "orders", decoded[0]["channel"])
+	assert.Equal(t, "order-1", decoded[0]["key"])
+	assert.Equal(t, `{"id":1}`, decoded[0]["message"])
+	assert.Equal(t, map[string]interface{}{"trace": "second", "content-type": "application/json"}, decoded[0]["headers"])
+	assert.Equal(t, "timeout", decoded[0]["causedBy"])
+	assert.Equal(t, "2021-06-30T10:00:00Z", decoded[0]["failedConsumeDate"])
+	assert.Equal(t, map[string]interface{}{"keyId": "2021-11"}, decoded[0]["encryption"])
+}
+
+func TestMessage_MarshalJSON_WithoutDataKey(t *testing.T) {
+	message := entity.Message{
+		ID:         "1",
+		Channel:    "orders",
+		Encryption: &entity.MessageEncryption{KeyID: "2021-11", DataKey: []byte("wrapped"), Headers: []string{"authorization"}},
+	}
+
+	// The wrapped data key is left out of every message of the API, the stored message keeps it.
+	for _, value := range []interface{}{model.NewMessage(message), model.MessageDetail{Message: message, Encryption: model.NewMessageEncryption(message.Encryption)}} {
+		encoded, err := json.Marshal(value)
+		assert.NoError(t, err)
+
+		var decoded map[string]interface{}
+		assert.NoError(t, json.Unmarshal(encoded, &decoded))
+		assert.Equal(t, map[string]interface{}{"keyId": "2021-11", "headers": []interface{}{"authorization"}}, decoded["encryption"])
+	}
+	assert.Equal(t, []byte("wrapped"), message.Encryption.DataKey)
+
+	encoded, err := json.Marshal(model.NewMessage(entity.Message{ID: "2"}))
+	assert.NoError(t, err)
+	assert.NotContains(t, string(encoded), "encryption")
+}
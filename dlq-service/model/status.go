@@ -5,6 +5,9 @@ import "net/http"
 const (
 	StatusInternalServerError = "INTERNAL_SERVER_ERROR"
 	StatusNotFoundError       = "NOT_FOUND_ERROR"
+	StatusBadRequestError     = "BAD_REQUEST_ERROR"
+	StatusConflictError       = "CONFLICT_ERROR"
+	StatusUnauthorizedError   = "UNAUTHORIZED_ERROR"
 	StatusOK                  = "OK"
 	StatusCreated             = "CREATED"
 )
@@ -15,6 +18,12 @@ func GetHTTPStatusCodeByResponseStatus(responseStatus string) (httpSatusCode int
 		return http.StatusOK
 	case StatusNotFoundError:
 		return http.StatusNotFound
+	case StatusBadRequestError:
+		return http.StatusBadRequest
+	case StatusConflictError:
+		return http.StatusConflict
+	case StatusUnauthorizedError:
+		return http.StatusUnauthorized
 	case StatusCreated:
 		return http.StatusCreated
 	case StatusInternalServerError:
@@ -0,0 +1,12 @@
+package model
+
+// SubscriptionParams is a model.
+type SubscriptionParams struct {
+	Topics []string `json:"topics" validate:"required"`
+}
+
+// PartitionParams is a model.
+type PartitionParams struct {
+	Topic      string  `json:"topic" validate:"required"`
+	Partitions []int32 `json:"partitions" validate:"required"`
+}
@@ -17,6 +17,8 @@ type Client interface {
 // Database is a collection of behavior of mongodb database.
 type Database interface {
 	Collection(name string, opts ...*options.CollectionOptions) (col Collection)
+	ListCollectionNames(ctx context.Context, filter interface{}, opts ...*options.ListCollectionsOptions) (names []string, err error)
+	RenameCollection(ctx context.Context, from, to string) (err error)
 }
 
 // Collection is a collection of behavior of mongodb client.
@@ -30,6 +32,16 @@ type Collection interface {
 	DeleteMany(ctx context.Context, filter interface{}, opts ...*options.DeleteOptions) (result *mongo.DeleteResult, err error)
 	UpdateMany(ctx context.Context, filter interface{}, update interface{}, opts ...*options.UpdateOptions) (result *mongo.UpdateResult, err error)
 	UpdateOne(ctx context.Context, filter interface{}, update interface{}, opts ...*options.UpdateOptions) (result *mongo.UpdateResult, err error)
+	BulkWrite(ctx context.Context, models []mongo.WriteModel, opts ...*options.BulkWriteOptions) (result *mongo.BulkWriteResult, err error)
+	Aggregate(ctx context.Context, pipeline interface{}, opts ...*options.AggregateOptions) (cursor Cursor, err error)
+	Indexes() (indexView IndexView)
+}
+
+// IndexView is a collection of behavior of mongodb index view.
+type IndexView interface {
+	CreateOne(ctx context.Context, model mongo.IndexModel, opts ...*options.CreateIndexesOptions) (name string, err error)
+	CreateMany(ctx context.Context, models []mongo.IndexModel, opts ...*options.CreateIndexesOptions) (names []string, err error)
+	DropOne(ctx context.Context, name string, opts ...*options.DropIndexesOptions) (err error)
 }
 
 // SingleResult is a collectioin of function of mongodb single result.
@@ -148,3 +148,29 @@ func (col *CollectionAdapter) UpdateOne(ctx context.Context, filter interface{},
 	result, err = col.col.UpdateOne(ctx, filter, update, opts...)
 	return
 }
+
+// BulkWrite performs a bulk write operation (https://docs.mongodb.com/manual/core/bulk-write-operations/).
+//
+// The models parameter must be a slice of operations to be executed in this bulk write. It cannot be nil or empty.
+// All of the models must be non-nil. See the mongo.WriteModel documentation for a list of valid model types and
+// examples of how they should be used.
+//
+// The opts parameter can be used to specify options for the operation (see the options.BulkWriteOptions documentation.)
+func (col *CollectionAdapter) BulkWrite(ctx context.Context, models []mongo.WriteModel, opts ...*options.BulkWriteOptions) (result *mongo.BulkWriteResult, err error) {
+	result, err = col.col.BulkWrite(ctx, models, opts...)
+	return
+}
+
+// Aggregate executes an aggregate command against the collection and returns a cursor over the resulting documents.
+//
+// For more information about the command, see https://docs.mongodb.com/manual/reference/command/aggregate/.
+func (col *CollectionAdapter) Aggregate(ctx context.Context, pipeline interface{}, opts ...*options.AggregateOptions) (cursor Cursor, err error) {
+	cursor, err = col.col.Aggregate(ctx, pipeline, opts...)
+	return
+}
+
+// Indexes returns an IndexView instance that can be used to perform operations on the indexes for the collection.
+func (col *CollectionAdapter) Indexes() (indexView IndexView) {
+	indexView = &IndexViewAdapter{col.col.Indexes()}
+	return
+}
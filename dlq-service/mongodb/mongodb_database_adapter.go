@@ -1,6 +1,9 @@
 package mongodb
 
 import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
@@ -16,3 +19,25 @@ func (db *DatabaseAdapter) Collection(name string, opts ...*options.CollectionOp
 	col = &CollectionAdapter{mongoCollection}
 	return
 }
+
+// ListCollectionNames executes a listCollections command and returns a slice which contains the names of the collections
+// in the database.
+//
+// For more information about the command, see https://docs.mongodb.com/manual/reference/command/listCollections/.
+func (db *DatabaseAdapter) ListCollectionNames(ctx context.Context, filter interface{}, opts ...*options.ListCollectionsOptions) (names []string, err error) {
+	names, err = db.db.ListCollectionNames(ctx, filter, opts...)
+	return
+}
+
+// RenameCollection executes a renameCollection command on the admin database to rename the collection within the database.
+//
+// For more information about the command, see https://docs.mongodb.com/manual/reference/command/renameCollection/.
+func (db *DatabaseAdapter) RenameCollection(ctx context.Context, from, to string) (err error) {
+	command := bson.D{
+		{Key: "renameCollection", Value: db.db.Name() + "." + from},
+		{Key: "to", Value: db.db.Name() + "." + to},
+	}
+
+	err = db.db.Client().Database("admin").RunCommand(ctx, command).Err()
+	return
+}
@@ -0,0 +1,46 @@
+package mongodb
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// IndexViewAdapter is a concrete struct of mongodb index view adapter.
+type IndexViewAdapter struct {
+	iv mongo.IndexView
+}
+
+// CreateOne executes a createIndexes command to create an index on the collection and returns the name of the new
+// index. See the IndexView.CreateMany documentation for more information and an example.
+func (iv *IndexViewAdapter) CreateOne(ctx context.Context, model mongo.IndexModel, opts ...*options.CreateIndexesOptions) (name string, err error) {
+	name, err = iv.iv.CreateOne(ctx, model, opts...)
+	return
+}
+
+// CreateMany executes a createIndexes command to create multiple indexes on the collection and returns the names of
+// the new indexes.
+//
+// For each IndexModel in the models parameter, the index name can be specified via the Options field. If a name is not
+// given, it will be generated from the Keys document.
+//
+// The opts parameter can be used to specify options for this operation (see the options.CreateIndexesOptions
+// documentation).
+//
+// For more information about the command, see https://docs.mongodb.com/manual/reference/command/createIndexes/.
+func (iv *IndexViewAdapter) CreateMany(ctx context.Context, models []mongo.IndexModel, opts ...*options.CreateIndexesOptions) (names []string, err error) {
+	names, err = iv.iv.CreateMany(ctx, models, opts...)
+	return
+}
+
+// DropOne executes a dropIndexes operation to drop an index on the collection.
+//
+// The name parameter should be the name of the index to drop. If the name is "*", ErrMultipleIndexDrop will be returned
+// without running the command because doing so would drop all indexes.
+//
+// For more information about the command, see https://docs.mongodb.com/manual/reference/command/dropIndexes/.
+func (iv *IndexViewAdapter) DropOne(ctx context.Context, name string, opts ...*options.DropIndexesOptions) (err error) {
+	_, err = iv.iv.DropOne(ctx, name, opts...)
+	return
+}
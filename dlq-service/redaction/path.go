@@ -0,0 +1,172 @@
+package redaction
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// segment is a step of the JSONPath, it matches a member by its name, an element by its index or every child by the wildcard.
+type segment struct {
+	name      string
+	index     int
+	isIndex   bool
+	wildcard  bool
+	recursive bool
+}
+
+func (s segment) matchesMember(name string) bool {
+	return s.wildcard || (!s.isIndex && s.name == name)
+}
+
+func (s segment) matchesElement(index int) bool {
+	return s.wildcard || (s.isIndex && s.index == index)
+}
+
+type path []segment
+
+// parsePath parses the JSONPath of the dot and the bracket notations, e.g. `$.customer.email`, `$['customer']['email']`,
+// `$.payments[*].cardNumber`, `$.payments[0]` and `$..email`.
+func parsePath(expression string) (p path, err error) {
+	if !strings.HasPrefix(expression, "$") {
+		err = fmt.Errorf("redaction: JSONPath %q must start with $", expression)
+		return
+	}
+
+	rest := expression[1:]
+	for rest != "" {
+		var s segment
+		switch {
+		case strings.HasPrefix(rest, ".."):
+			s.recursive = true
+			rest = rest[2:]
+			if strings.HasPrefix(rest, "[") {
+				break
+			}
+			s, rest = parseName(s, rest)
+		case strings.HasPrefix(rest, "."):
+			s, rest = parseName(s, rest[1:])
+		case !strings.HasPrefix(rest, "["):
+			err = fmt.Errorf("redaction: JSONPath %q is malformed at %q", expression, rest)
+			return
+		}
+
+		if s.name == "" && !s.wildcard {
+			if s, rest, err = parseBracket(s, rest); err != nil {
+				err = fmt.Errorf("redaction: JSONPath %q is malformed: %w", expression, err)
+				return
+			}
+		}
+
+		p = append(p, s)
+	}
+
+	if len(p) == 0 {
+		err = fmt.Errorf("redaction: JSONPath %q redacts the whole payload", expression)
+	}
+
+	return
+}
+
+func parseName(s segment, rest string) (segment, string) {
+	end := strings.IndexAny(rest, ".[")
+	if end < 0 {
+		end = len(rest)
+	}
+
+	name := rest[:end]
+	if name == "*" {
+		s.wildcard = true
+	} else {
+		s.name = name
+	}
+
+	return s, rest[end:]
+}
+
+func parseBracket(s segment, rest string) (segment, string, error) {
+	end := strings.Index(rest, "]")
+	if !strings.HasPrefix(rest, "[") || end < 0 {
+		return s, rest, fmt.Errorf("unclosed bracket at %q", rest)
+	}
+
+	selector := rest[1:end]
+	switch {
+	case selector == "*":
+		s.wildcard = true
+	case len(selector) >= 2 && (selector[0] == '\'' || selector[0] == '"') && selector[len(selector)-1] == selector[0]:
+		s.name = selector[1 : len(selector)-1]
+	default:
+		index, err := strconv.Atoi(selector)
+		if err != nil || index < 0 {
+			return s, rest, fmt.Errorf("invalid selector %q", selector)
+		}
+		s.index, s.isIndex = index, true
+	}
+
+	return s, rest[end+1:], nil
+}
+
+// redact replaces the values of the path in the decoded JSON document, it reports whether any of them is replaced.
+func (p path) redact(node interface{}) bool {
+	return redactSegments(node, p)
+}
+
+func redactSegments(node interface{}, segments []segment) (redacted bool) {
+	s, rest := segments[0], segments[1:]
+
+	if s.recursive {
+		// The recursive descent matches the segment on the node and on every descendant of it.
+		current := s
+		current.recursive = false
+		redacted = redactSegments(node, append([]segment{current}, rest...))
+		forEachChild(node, func(child interface{}) {
+			if redactSegments(child, segments) {
+				redacted = true
+			}
+		})
+		return
+	}
+
+	switch n := node.(type) {
+	case map[string]interface{}:
+		for name, child := range n {
+			if !s.matchesMember(name) {
+				continue
+			}
+			if len(rest) == 0 {
+				n[name] = Redacted
+				redacted = true
+			} else if redactSegments(child, rest) {
+				redacted = true
+			}
+		}
+	case []interface{}:
+		for i, child := range n {
+			if !s.matchesElement(i) {
+				continue
+			}
+			if len(rest) == 0 {
+				n[i] = Redacted
+				redacted = true
+			} else if redactSegments(child, rest) {
+				redacted = true
+			}
+		}
+	}
+
+	return
+}
+
+func forEachChild(node interface{}, f func(child interface{})) {
+	switch n := node.(type) {
+	case map[string]interface{}:
+		for _, child := range n {
+			f(child)
+		}
+	case []interface{}:
+		for _, child := range n {
+			f(child)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+// Package redaction hides the personal data of the message payloads and headers before they are shown or logged.
+package redaction
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strings"
+)
+
+// Redacted replaces the redacted values.
+const Redacted = "[REDACTED]"
+
+// Rules are the redaction rules, they are loaded from a JSON file, e.g.
+//
+//	{
+//		"fields": ["$.customer.email", "$.payments[*].cardNumber", "$..password"],
+//		"headers": ["authorization"],
+//		"patterns": ["\\b\\d(?:[ -]?\\d){12,15}\\b", "[[:alnum:]._%+-]+@[[:alnum:].-]+\\.[[:alpha:]]{2,}"]
+//	}
+type Rules struct {
+	// Fields are the JSONPath of the fields of the JSON payloads whose values are redacted,
+	// the dot and the bracket notations, the wildcards and the recursive descent are supported.
+	Fields []string `json:"fields"`
+	// Headers are the keys of the headers whose values are redacted, they are matched case-insensitively.
+	Headers []string `json:"headers"`
+	// Patterns are the regular expressions of the values that are redacted wherever they are in the payloads and the header values.
+	Patterns []string `json:"patterns"`
+}
+
+// LoadRules reads the rules of the JSON file.
+func LoadRules(path string) (rules Rules, err error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return
+	}
+
+	if err = json.Unmarshal(data, &rules); err != nil {
+		err = fmt.Errorf("redaction: rules file %s is malformed: %w", path, err)
+		return
+	}
+
+	return
+}
+
+// Redactor is a collection of behavior of the redaction, the empty values are returned as they are.
+type Redactor interface {
+	// Payload redacts the fields of the JSON payload and then the patterns of any payload.
+	Payload(data []byte) []byte
+	// Header redacts the value of the header of the rules, the values of the other headers are redacted by the patterns.
+	Header(key string, value []byte) []byte
+}
+
+type redactor struct {
+	fields   []path
+	headers  []string
+	patterns []*regexp.Regexp
+}
+
+// NewRedactor is a constructor, the redactor of the empty rules returns the values as they are.
+func NewRedactor(rules Rules) (r Redactor, err error) {
+	redactor := &redactor{
+		headers: rules.Headers,
+	}
+
+	for _, field := range rules.Fields {
+		path, err := parsePath(field)
+		if err != nil {
+			return nil, err
+		}
+		redactor.fields = append(redactor.fields, path)
+	}
+
+	for _, pattern := range rules.Patterns {
+		compiled, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("redaction: pattern %q: %w", pattern, err)
+		}
+		redactor.patterns = append(redactor.patterns, compiled)
+	}
+
+	r = redactor
+
+	return
+}
+
+// Payload redacts the values of the JSON payload so that it stays JSON, the other payloads are redacted by the patterns only.
+// The JSON payload that is redacted is encoded again with its members sorted by their name.
+func (r *redactor) Payload(data []byte) []byte {
+	if len(data) == 0 || (len(r.fields) == 0 && len(r.patterns) == 0) {
+		return data
+	}
+	if !json.Valid(data) {
+		return r.redactPatterns(data)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var document interface{}
+	if err := decoder.Decode(&document); err != nil {
+		return r.redactPatterns(data)
+	}
+
+	var redacted bool
+	for _, field := range r.fields {
+		if field.redact(document) {
+			redacted = true
+		}
+	}
+	document, patternRedacted := r.redactValues(document)
+	if !redacted && !patternRedacted {
+		return data
+	}
+
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(document); err != nil {
+		return r.redactPatterns(data)
+	}
+
+	return bytes.TrimSuffix(buffer.Bytes(), []byte("\n"))
+}
+
+// redactValues redacts the patterns of the strings and the numbers of the JSON document,
+// the number that is matched is replaced by the redacted string.
+func (r *redactor) redactValues(node interface{}) (redactedNode interface{}, redacted bool) {
+	switch n := node.(type) {
+	case map[string]interface{}:
+		for key, child := range n {
+			if value, ok := r.redactValues(child); ok {
+				n[key] = value
+				redacted = true
+			}
+		}
+	case []interface{}:
+		for i, child := range n {
+			if value, ok := r.redactValues(child); ok {
+				n[i] = value
+				redacted = true
+			}
+		}
+	case string:
+		if value := string(r.redactPatterns([]byte(n))); value != n {
+			return value, true
+		}
+	case json.Number:
+		if value := string(r.redactPatterns([]byte(n))); value != string(n) {
+			return value, true
+		}
+	}
+
+	return node, redacted
+}
+
+func (r *redactor) Header(key string, value []byte) []byte {
+	if len(value) == 0 {
+		return value
+	}
+
+	for _, header := range r.headers {
+		if strings.EqualFold(header, key) {
+			return []byte(Redacted)
+		}
+	}
+
+	return r.redactPatterns(value)
+}
+
+func (r *redactor) redactPatterns(data []byte) []byte {
+	for _, pattern := range r.patterns {
+		data = pattern.ReplaceAll(data, []byte(Redacted))
+	}
+
+	return data
+}
@@ -0,0 +1,95 @@
+package redaction_test
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/redaction"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	cardNumberPattern = `\b\d(?:[ -]?\d){12,15}\b`
+	emailPattern      = `[[:alnum:]._%+-]+@[[:alnum:].-]+\.[[:alpha:]]{2,}`
+)
+
+func TestRedactor_Payload_Fields(t *testing.T) {
+	payload := []byte(`{"orderId":"order-1","amount":100.50,"customer":{"name":"Jane","email":"jane@example.com"},` +
+		`"payments":[{"method":"card","card":{"number":"4111"}},{"method":"cash"}],"notes":"<none>"}`)
+
+	for _, tc := range []struct {
+		field    string
+		expected string
+	}{
+		{"$.customer.email", `{"amount":100.50,"customer":{"email":"[REDACTED]","name":"Jane"},"notes":"<none>","orderId":"order-1","payments":[{"card":{"number":"4111"},"method":"card"},{"method":"cash"}]}`},
+		{"$['customer']['name']", `{"amount":100.50,"customer":{"email":"jane@example.com","name":"[REDACTED]"},"notes":"<none>","orderId":"order-1","payments":[{"card":{"number":"4111"},"method":"card"},{"method":"cash"}]}`},
+		{"$.customer", `{"amount":100.50,"customer":"[REDACTED]","notes":"<none>","orderId":"order-1","payments":[{"card":{"number":"4111"},"method":"card"},{"method":"cash"}]}`},
+		{"$.payments[*].method", `{"amount":100.50,"customer":{"email":"jane@example.com","name":"Jane"},"notes":"<none>","orderId":"order-1","payments":[{"card":{"number":"4111"},"method":"[REDACTED]"},{"method":"[REDACTED]"}]}`},
+		{"$.payments[1]", `{"amount":100.50,"customer":{"email":"jane@example.com","name":"Jane"},"notes":"<none>","orderId":"order-1","payments":[{"card":{"number":"4111"},"method":"card"},"[REDACTED]"]}`},
+		{"$..number", `{"amount":100.50,"customer":{"email":"jane@example.com","name":"Jane"},"notes":"<none>","orderId":"order-1","payments":[{"card":{"number":"[REDACTED]"},"method":"card"},{"method":"cash"}]}`},
+		{"$.customer.*", `{"amount":100.50,"customer":{"email":"[REDACTED]","name":"[REDACTED]"},"notes":"<none>","orderId":"order-1","payments":[{"card":{"number":"4111"},"method":"card"},{"method":"cash"}]}`},
+	} {
+		t.Run(tc.field, func(t *testing.T) {
+			redactor, err := redaction.NewRedactor(redaction.Rules{Fields: []string{tc.field}})
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, string(redactor.Payload(payload)))
+		})
+	}
+
+	// The payload that has none of the fields is returned as it is.
+	redactor, err := redaction.NewRedactor(redaction.Rules{Fields: []string{"$.customer.phone", "$.payments[5]"}})
+	assert.NoError(t, err)
+	assert.Equal(t, payload, redactor.Payload(payload))
+}
+
+func TestRedactor_Payload_Patterns(t *testing.T) {
+	redactor, err := redaction.NewRedactor(redaction.Rules{Patterns: []string{cardNumberPattern, emailPattern}})
+	assert.NoError(t, err)
+
+	// The JSON payload stays JSON when a number is matched.
+	assert.Equal(t,
+		`{"card":"[REDACTED]","contact":"mail [REDACTED] now","number":"[REDACTED]","orderId":"order-1"}`,
+		string(redactor.Payload([]byte(`{"orderId":"order-1","card":"4111 1111 1111 1111","number":4111111111111111,"contact":"mail jane@example.com now"}`))))
+
+	assert.Equal(t, "card [REDACTED] of [REDACTED]", string(redactor.Payload([]byte("card 4111-1111-1111-1111 of jane@example.com"))))
+	assert.Equal(t, []byte(`{"orderId":"order-1"}`), redactor.Payload([]byte(`{"orderId":"order-1"}`)))
+	assert.Nil(t, redactor.Payload(nil))
+}
+
+func TestRedactor_Header(t *testing.T) {
+	redactor, err := redaction.NewRedactor(redaction.Rules{Headers: []string{"Authorization"}, Patterns: []string{emailPattern}})
+	assert.NoError(t, err)
+
+	assert.Equal(t, []byte(redaction.Redacted), redactor.Header("authorization", []byte("Bearer token")))
+	assert.Equal(t, []byte("[REDACTED]"), redactor.Header("x-customer", []byte("jane@example.com")))
+	assert.Equal(t, []byte("application/json"), redactor.Header("content-type", []byte("application/json")))
+	assert.Empty(t, redactor.Header("authorization", nil))
+}
+
+func TestNewRedactor_InvalidRules(t *testing.T) {
+	for _, rules := range []redaction.Rules{
+		{Fields: []string{"customer.email"}},
+		{Fields: []string{"$"}},
+		{Fields: []string{"$.payments[abc]"}},
+		{Fields: []string{"$.payments[0"}},
+		{Fields: []string{"$customer"}},
+		{Patterns: []string{"("}},
+	} {
+		_, err := redaction.NewRedactor(rules)
+		assert.Error(t, err, rules)
+	}
+}
+
+func TestLoadRules(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "redaction.json")
+	assert.NoError(t, ioutil.WriteFile(path, []byte(`{"fields":["$.customer.email"],"headers":["authorization"],"patterns":["\\d{16}"]}`), 0600))
+
+	rules, err := redaction.LoadRules(path)
+	assert.NoError(t, err)
+	assert.Equal(t, redaction.Rules{
+		Fields:   []string{"$.customer.email"},
+		Headers:  []string{"authorization"},
+		Patterns: []string{`\d{16}`},
+	}, rules)
+}
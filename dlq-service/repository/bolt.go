@@ -0,0 +1,588 @@
+package repository
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/entity"
+	"github.com/sirupsen/logrus"
+	bolt "go.etcd.io/bbolt"
+)
+
+// The buckets of the bolt backend, the messages are stored by their insertion sequence
+// and are looked up by their ID and their DLQ coordinates through the index buckets.
+var (
+	boltMessageBucket            = []byte(DLQMessageCollection)
+	boltMessageIDBucket          = []byte(DLQMessageCollection + ".id")
+	boltMessageCoordinatesBucket = []byte(DLQMessageCollection + ".coordinates")
+	boltSubscriptionBucket       = []byte(SubscriptionCollection)
+)
+
+type boltDLQRepository struct {
+	logger    *logrus.Logger
+	db        *bolt.DB
+	mu        sync.Mutex
+	retention *retention
+}
+
+// NewBoltDLQRepository returns a DLQRepository that stores the messages in an embedded bolt database,
+// it is meant for the small deployments that run a single instance of the service.
+func NewBoltDLQRepository(logger *logrus.Logger, db *bolt.DB) (repository DLQRepository, err error) {
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{boltMessageBucket, boltMessageIDBucket, boltMessageCoordinatesBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		logger.Error(err)
+		return
+	}
+
+	repository = &boltDLQRepository{
+		logger:    logger,
+		db:        db,
+		retention: &retention{},
+	}
+
+	return
+}
+
+func (r *boltDLQRepository) CountDocuments(ctx context.Context, status string) (counted int64, err error) {
+	if err = r.purge(); err != nil {
+		return
+	}
+
+	err = r.db.View(func(tx *bolt.Tx) error {
+		if status == "" {
+			counted = int64(tx.Bucket(boltMessageBucket).Stats().KeyN)
+			return nil
+		}
+
+		return tx.Bucket(boltMessageBucket).ForEach(func(key, value []byte) error {
+			var message entity.Message
+			if err := json.Unmarshal(value, &message); err != nil {
+				return err
+			}
+			if withStatus(message, status) {
+				counted++
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		r.logger.Error(err)
+		return
+	}
+
+	return
+}
+
+func (r *boltDLQRepository) InsertOne(ctx context.Context, message entity.Message) (err error) {
+	if err = r.purge(); err != nil {
+		return
+	}
+
+	if err = r.db.Update(func(tx *bolt.Tx) error {
+		return boltInsert(tx, message)
+	}); err != nil {
+		r.logger.Error(err)
+		return
+	}
+
+	return
+}
+
+func (r *boltDLQRepository) InsertMany(ctx context.Context, bunchOfMessage []entity.Message) (failures map[int]error, err error) {
+	if err = r.purge(); err != nil {
+		return
+	}
+
+	// The whole batch is written in a single transaction, like the bulk write of mongodb
+	// the redelivered messages are not failures, the duplicate IDs are.
+	failures = make(map[int]error)
+	err = r.db.Update(func(tx *bolt.Tx) error {
+		for i, message := range bunchOfMessage {
+			err := boltInsert(tx, message)
+			if err == ErrDuplicateID {
+				failures[i] = err
+				continue
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		r.logger.Error(err)
+		return
+	}
+
+	return
+}
+
+func boltInsert(tx *bolt.Tx, message entity.Message) (err error) {
+	messages := tx.Bucket(boltMessageBucket)
+	IDs := tx.Bucket(boltMessageIDBucket)
+	coordinates := tx.Bucket(boltMessageCoordinatesBucket)
+
+	if message.DLQTopic != "" && coordinates.Get([]byte(coordinatesKey(message))) != nil {
+		return
+	}
+	if IDs.Get([]byte(message.ID)) != nil {
+		err = ErrDuplicateID
+		return
+	}
+
+	sequence, err := messages.NextSequence()
+	if err != nil {
+		return
+	}
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, sequence)
+
+	value, err := json.Marshal(message)
+	if err != nil {
+		return
+	}
+	if err = messages.Put(key, value); err != nil {
+		return
+	}
+	if err = IDs.Put([]byte(message.ID), key); err != nil {
+		return
+	}
+	if message.DLQTopic != "" {
+		err = coordinates.Put([]byte(coordinatesKey(message)), key)
+	}
+
+	return
+}
+
+func (r *boltDLQRepository) FindMany(ctx context.Context, status string, limit, skip int64) (bunchOfMessage []entity.Message, err error) {
+	if err = r.purge(); err != nil {
+		return
+	}
+
+	err = r.db.View(func(tx *bolt.Tx) error {
+		cursor := tx.Bucket(boltMessageBucket).Cursor()
+		var skipped int64
+		for key, value := cursor.First(); key != nil; key, value = cursor.Next() {
+			if limit > 0 && int64(len(bunchOfMessage)) >= limit {
+				break
+			}
+
+			var message entity.Message
+			if err := json.Unmarshal(value, &message); err != nil {
+				return err
+			}
+			if !withStatus(message, status) {
+				continue
+			}
+			if skipped < skip {
+				skipped++
+				continue
+			}
+			bunchOfMessage = append(bunchOfMessage, message)
+		}
+		return nil
+	})
+	if err != nil {
+		r.logger.Error(err)
+		return
+	}
+
+	if len(bunchOfMessage) < 1 {
+		err = ErrNotFound
+	}
+
+	return
+}
+
+func (r *boltDLQRepository) FindByID(ctx context.Context, ID string) (message entity.Message, err error) {
+	if err = r.purge(); err != nil {
+		return
+	}
+
+	err = r.db.View(func(tx *bolt.Tx) error {
+		key := tx.Bucket(boltMessageIDBucket).Get([]byte(ID))
+		if key == nil {
+			return ErrNotFound
+		}
+		return json.Unmarshal(tx.Bucket(boltMessageBucket).Get(key), &message)
+	})
+	if err != nil {
+		r.logger.Error(err)
+		return
+	}
+
+	return
+}
+
+func (r *boltDLQRepository) DeleteByID(ctx context.Context, ID string) (err error) {
+	if err = r.db.Update(func(tx *bolt.Tx) error {
+		return boltDelete(tx, ID)
+	}); err != nil {
+		r.logger.Error(err)
+		return
+	}
+
+	return
+}
+
+func boltDelete(tx *bolt.Tx, ID string) (err error) {
+	messages := tx.Bucket(boltMessageBucket)
+	IDs := tx.Bucket(boltMessageIDBucket)
+
+	key := IDs.Get([]byte(ID))
+	if key == nil {
+		return
+	}
+
+	var message entity.Message
+	if err = json.Unmarshal(messages.Get(key), &message); err != nil {
+		return
+	}
+	if message.DLQTopic != "" {
+		if err = tx.Bucket(boltMessageCoordinatesBucket).Delete([]byte(coordinatesKey(message))); err != nil {
+			return
+		}
+	}
+	if err = IDs.Delete([]byte(ID)); err != nil {
+		return
+	}
+	err = messages.Delete(key)
+
+	return
+}
+
+func (r *boltDLQRepository) EnsureRetentionIndex(ctx context.Context, grace time.Duration) (err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.retention.enable(grace)
+
+	return
+}
+
+func (r *boltDLQRepository) purge() (err error) {
+	r.mu.Lock()
+	deadline, ok := r.retention.due(time.Now())
+	r.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	err = r.db.Update(func(tx *bolt.Tx) error {
+		var IDs []string
+		err := tx.Bucket(boltMessageBucket).ForEach(func(key, value []byte) error {
+			var message entity.Message
+			if err := json.Unmarshal(value, &message); err != nil {
+				return err
+			}
+			if purgeable(message, deadline) {
+				IDs = append(IDs, message.ID)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, ID := range IDs {
+			if err := boltDelete(tx, ID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		r.logger.Error(err)
+		return
+	}
+
+	return
+}
+
+func (r *boltDLQRepository) MarkReplayed(ctx context.Context, ID string, replayedAt time.Time, expireAt *time.Time) (err error) {
+	err = r.update([]string{ID}, func(message entity.Message) entity.Message {
+		return markReplayed(message, replayedAt, expireAt)
+	})
+
+	return
+}
+
+func (r *boltDLQRepository) ClaimForReplay(ctx context.Context, ID string, claimedUntil time.Time) (message entity.Message, err error) {
+	var isClaimed, isReplayed bool
+	err = r.update([]string{ID}, func(stored entity.Message) entity.Message {
+		message = stored
+		isReplayed = stored.Status == entity.MessageStatusReplayed
+		if isClaimed = claimed(stored, time.Now()); !isClaimed && !isReplayed {
+			message.ClaimedUntil = &claimedUntil
+		}
+		return message
+	})
+	switch {
+	case err != nil:
+	case isReplayed:
+		err = ErrReplayed
+	case isClaimed:
+		err = ErrClaimed
+	}
+
+	return
+}
+
+func (r *boltDLQRepository) ReleaseClaim(ctx context.Context, ID string) (err error) {
+	err = r.update([]string{ID}, func(message entity.Message) entity.Message {
+		message.ClaimedUntil = nil
+		return message
+	})
+	if err == ErrNotFound {
+		err = nil
+	}
+
+	return
+}
+
+func (r *boltDLQRepository) FindExpired(ctx context.Context, before time.Time, limit int64) (bunchOfMessage []entity.Message, err error) {
+	if err = r.purge(); err != nil {
+		return
+	}
+
+	err = r.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltMessageBucket).ForEach(func(key, value []byte) error {
+			var message entity.Message
+			if err := json.Unmarshal(value, &message); err != nil {
+				return err
+			}
+			if archivable(message, before) {
+				bunchOfMessage = append(bunchOfMessage, message)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		r.logger.Error(err)
+		return
+	}
+	bunchOfMessage = sortByExpireAt(bunchOfMessage, limit)
+
+	return
+}
+
+func (r *boltDLQRepository) MarkArchived(ctx context.Context, IDs []string, archivedAt time.Time) (err error) {
+	err = r.update(IDs, func(message entity.Message) entity.Message {
+		message.ArchivedAt = &archivedAt
+		message.UpdatedAt = archivedAt
+		message.ClaimedUntil = nil
+		return message
+	})
+	if err == ErrNotFound {
+		// Like UpdateMany of mongodb, the missing messages are ignored.
+		err = nil
+	}
+
+	return
+}
+
+func (r *boltDLQRepository) ClaimForArchive(ctx context.Context, IDs []string, claimedUntil time.Time) (claimedIDs []string, err error) {
+	now := time.Now()
+	err = r.update(IDs, func(message entity.Message) entity.Message {
+		if archivable(message, now) {
+			message.ClaimedUntil = &claimedUntil
+			claimedIDs = append(claimedIDs, message.ID)
+		}
+		return message
+	})
+	if err == ErrNotFound {
+		err = nil
+	}
+
+	return
+}
+
+func (r *boltDLQRepository) UpdateExpireAt(ctx context.Context, ID, status string, expireAt *time.Time) (err error) {
+	var isUpdated bool
+	err = r.update([]string{ID}, func(message entity.Message) entity.Message {
+		if isUpdated = message.Status == status && message.ArchivedAt == nil; isUpdated {
+			message.ExpireAt = expireAt
+		}
+		return message
+	})
+	if err == nil && !isUpdated {
+		err = ErrNotFound
+	}
+
+	return
+}
+
+func (r *boltDLQRepository) StorageStats(ctx context.Context) (stats entity.StorageStats, err error) {
+	if err = r.purge(); err != nil {
+		return
+	}
+
+	var accumulator storageStatsAccumulator
+	err = r.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltMessageBucket).ForEach(func(key, value []byte) error {
+			var message entity.Message
+			if err := json.Unmarshal(value, &message); err != nil {
+				return err
+			}
+			accumulator.add(message)
+			return nil
+		})
+	})
+	if err != nil {
+		r.logger.Error(err)
+		return
+	}
+	stats = accumulator.stats()
+
+	return
+}
+
+func (r *boltDLQRepository) FindEncryptedWithOtherKey(ctx context.Context, keyID string, limit int64) (bunchOfMessage []entity.Message, err error) {
+	if err = r.purge(); err != nil {
+		return
+	}
+
+	err = r.db.View(func(tx *bolt.Tx) error {
+		cursor := tx.Bucket(boltMessageBucket).Cursor()
+		for key, value := cursor.First(); key != nil; key, value = cursor.Next() {
+			if limit > 0 && int64(len(bunchOfMessage)) >= limit {
+				break
+			}
+
+			var message entity.Message
+			if err := json.Unmarshal(value, &message); err != nil {
+				return err
+			}
+			if encryptedWithOtherKey(message, keyID) {
+				bunchOfMessage = append(bunchOfMessage, message)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		r.logger.Error(err)
+		return
+	}
+
+	return
+}
+
+func (r *boltDLQRepository) UpdateEncryption(ctx context.Context, ID string, encryption entity.MessageEncryption) (err error) {
+	var isEncrypted bool
+	err = r.update([]string{ID}, func(message entity.Message) entity.Message {
+		if isEncrypted = message.Encryption != nil; isEncrypted {
+			message.Encryption = &encryption
+		}
+		return message
+	})
+	if err == nil && !isEncrypted {
+		err = ErrNotFound
+	}
+
+	return
+}
+
+// update applies the change to the stored messages in a single transaction,
+// it returns ErrNotFound when none of them is stored.
+func (r *boltDLQRepository) update(IDs []string, change func(message entity.Message) entity.Message) (err error) {
+	err = r.db.Update(func(tx *bolt.Tx) error {
+		messages := tx.Bucket(boltMessageBucket)
+		var matched int
+		for _, ID := range IDs {
+			key := tx.Bucket(boltMessageIDBucket).Get([]byte(ID))
+			if key == nil {
+				continue
+			}
+			matched++
+
+			var message entity.Message
+			if err := json.Unmarshal(messages.Get(key), &message); err != nil {
+				return err
+			}
+			value, err := json.Marshal(change(message))
+			if err != nil {
+				return err
+			}
+			if err := messages.Put(key, value); err != nil {
+				return err
+			}
+		}
+		if matched < 1 {
+			return ErrNotFound
+		}
+		return nil
+	})
+	if err != nil && err != ErrNotFound {
+		r.logger.Error(err)
+		return
+	}
+
+	return
+}
+
+type boltSubscriptionRepository struct {
+	logger *logrus.Logger
+	db     *bolt.DB
+}
+
+// NewBoltSubscriptionRepository returns a SubscriptionRepository that stores the subscriptions in an embedded bolt database.
+func NewBoltSubscriptionRepository(logger *logrus.Logger, db *bolt.DB) (repository SubscriptionRepository, err error) {
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(boltSubscriptionBucket)
+		return err
+	})
+	if err != nil {
+		logger.Error(err)
+		return
+	}
+
+	repository = &boltSubscriptionRepository{
+		logger: logger,
+		db:     db,
+	}
+
+	return
+}
+
+func (r *boltSubscriptionRepository) FindByID(ctx context.Context, ID string) (subscription entity.Subscription, err error) {
+	err = r.db.View(func(tx *bolt.Tx) error {
+		value := tx.Bucket(boltSubscriptionBucket).Get([]byte(ID))
+		if value == nil {
+			return ErrNotFound
+		}
+		return json.Unmarshal(value, &subscription)
+	})
+	if err != nil {
+		r.logger.Error(err)
+		return
+	}
+
+	return
+}
+
+func (r *boltSubscriptionRepository) Upsert(ctx context.Context, subscription entity.Subscription) (err error) {
+	value, err := json.Marshal(subscription)
+	if err != nil {
+		r.logger.Error(err)
+		return
+	}
+
+	if err = r.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltSubscriptionBucket).Put([]byte(subscription.ID), value)
+	}); err != nil {
+		r.logger.Error(err)
+		return
+	}
+
+	return
+}
@@ -0,0 +1,47 @@
+package repository_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/repository"
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/repository/repositorytest"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	bolt "go.etcd.io/bbolt"
+)
+
+func newBoltDB(t *testing.T) *bolt.DB {
+	db, err := bolt.Open(filepath.Join(t.TempDir(), "dlq-service.db"), 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	return db
+}
+
+func TestBoltDLQRepository(t *testing.T) {
+	repositorytest.TestDLQRepository(t, func(t *testing.T) repository.DLQRepository {
+		r, err := repository.NewBoltDLQRepository(logrus.New(), newBoltDB(t))
+		assert.NoError(t, err)
+
+		return r
+	})
+}
+
+func TestBoltSubscriptionRepository(t *testing.T) {
+	repositorytest.TestSubscriptionRepository(t, func(t *testing.T) repository.SubscriptionRepository {
+		r, err := repository.NewBoltSubscriptionRepository(logrus.New(), newBoltDB(t))
+		assert.NoError(t, err)
+
+		return r
+	})
+}
+
+func TestBoltDLQRepository_Retention(t *testing.T) {
+	r, err := repository.NewBoltDLQRepository(logrus.New(), newBoltDB(t))
+	assert.NoError(t, err)
+
+	testRetention(t, r)
+}
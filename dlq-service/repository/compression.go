@@ -0,0 +1,249 @@
+package repository
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/entity"
+	"github.com/sirupsen/logrus"
+)
+
+// CompressionConfig is a configuration of the compression of the message payloads.
+type CompressionConfig struct {
+	// Codec compresses the payloads, they are stored as they are when it is empty.
+	Codec string
+	// Threshold is the payload size in bytes from which the payloads are compressed.
+	Threshold int
+}
+
+type compressedDLQRepository struct {
+	DLQRepository
+	logger  *logrus.Logger
+	config  *CompressionConfig
+	encoder *zstd.Encoder
+	decoder *zstd.Decoder
+}
+
+// NewCompressedDLQRepository wraps the repository of any backend, it stores the payloads from the threshold compressed
+// with the codec marked on the message, and decompresses them on the reads whatever codec is configured.
+func NewCompressedDLQRepository(logger *logrus.Logger, repository DLQRepository, config *CompressionConfig) (compressed DLQRepository, err error) {
+	switch config.Codec {
+	case "", entity.MessageCodecZstd, entity.MessageCodecGzip:
+	default:
+		err = fmt.Errorf("unknown compression codec %q", config.Codec)
+		return
+	}
+
+	encoder, err := zstd.NewWriter(nil)
+	if err != nil {
+		return
+	}
+	decoder, err := zstd.NewReader(nil)
+	if err != nil {
+		return
+	}
+
+	compressed = &compressedDLQRepository{
+		DLQRepository: repository,
+		logger:        logger,
+		config:        config,
+		encoder:       encoder,
+		decoder:       decoder,
+	}
+
+	return
+}
+
+func (r *compressedDLQRepository) InsertOne(ctx context.Context, message entity.Message) (err error) {
+	if message, err = r.compress(message); err != nil {
+		r.logger.Error(err)
+		return
+	}
+
+	return r.DLQRepository.InsertOne(ctx, message)
+}
+
+func (r *compressedDLQRepository) InsertMany(ctx context.Context, bunchOfMessage []entity.Message) (failures map[int]error, err error) {
+	compressed := make([]entity.Message, len(bunchOfMessage))
+	for i, message := range bunchOfMessage {
+		if compressed[i], err = r.compress(message); err != nil {
+			r.logger.Error(err)
+			return
+		}
+	}
+
+	return r.DLQRepository.InsertMany(ctx, compressed)
+}
+
+func (r *compressedDLQRepository) FindMany(ctx context.Context, status string, limit, skip int64) (bunchOfMessage []entity.Message, err error) {
+	if bunchOfMessage, err = r.DLQRepository.FindMany(ctx, status, limit, skip); err != nil {
+		return
+	}
+
+	err = r.decompressAll(bunchOfMessage)
+
+	return
+}
+
+func (r *compressedDLQRepository) FindByID(ctx context.Context, ID string) (message entity.Message, err error) {
+	if message, err = r.DLQRepository.FindByID(ctx, ID); err != nil {
+		return
+	}
+
+	if message, err = r.decompress(message); err != nil {
+		r.logger.Error(err)
+		return
+	}
+
+	return
+}
+
+func (r *compressedDLQRepository) ClaimForReplay(ctx context.Context, ID string, claimedUntil time.Time) (message entity.Message, err error) {
+	if message, err = r.DLQRepository.ClaimForReplay(ctx, ID, claimedUntil); err != nil {
+		return
+	}
+
+	if message, err = r.decompress(message); err != nil {
+		r.logger.Error(err)
+		return
+	}
+
+	return
+}
+
+func (r *compressedDLQRepository) FindExpired(ctx context.Context, before time.Time, limit int64) (bunchOfMessage []entity.Message, err error) {
+	if bunchOfMessage, err = r.DLQRepository.FindExpired(ctx, before, limit); err != nil {
+		return
+	}
+
+	err = r.decompressAll(bunchOfMessage)
+
+	return
+}
+
+func (r *compressedDLQRepository) decompressAll(bunchOfMessage []entity.Message) (err error) {
+	for i, message := range bunchOfMessage {
+		if bunchOfMessage[i], err = r.decompress(message); err != nil {
+			r.logger.Error(err)
+			return
+		}
+	}
+
+	return
+}
+
+// compress keeps the payload as it is when it is below the threshold or when the compression does not make it smaller.
+// The offloaded payload is neither compressed nor counted, the message keeps only its reference and its original size.
+func (r *compressedDLQRepository) compress(message entity.Message) (compressed entity.Message, err error) {
+	compressed = message
+	if message.MessageRef != "" {
+		return
+	}
+
+	compressed.MessageCodec = ""
+	compressed.MessageSize = int64(len(message.Message))
+	compressed.StoredMessageSize = int64(len(message.Message))
+
+	if r.config.Codec == "" || len(message.Message) < r.config.Threshold {
+		return
+	}
+
+	var payload []byte
+	switch r.config.Codec {
+	case entity.MessageCodecZstd:
+		payload = r.encoder.EncodeAll(message.Message, nil)
+	case entity.MessageCodecGzip:
+		var buffer bytes.Buffer
+		writer := gzip.NewWriter(&buffer)
+		if _, err = writer.Write(message.Message); err != nil {
+			return
+		}
+		if err = writer.Close(); err != nil {
+			return
+		}
+		payload = buffer.Bytes()
+	}
+
+	if len(payload) >= len(message.Message) {
+		return
+	}
+
+	compressed.Message = payload
+	compressed.MessageCodec = r.config.Codec
+	compressed.StoredMessageSize = int64(len(payload))
+
+	return
+}
+
+// decompress returns the payload as it is consumed, the codec and the sizes are kept to show how it is stored.
+// The payload that is read still encrypted is returned as it is.
+func (r *compressedDLQRepository) decompress(message entity.Message) (decompressed entity.Message, err error) {
+	decompressed = message
+	if sealed(message) {
+		return
+	}
+
+	switch message.MessageCodec {
+	case "":
+	case entity.MessageCodecZstd:
+		decompressed.Message, err = r.decoder.DecodeAll(message.Message, nil)
+	case entity.MessageCodecGzip:
+		var reader *gzip.Reader
+		if reader, err = gzip.NewReader(bytes.NewReader(message.Message)); err != nil {
+			break
+		}
+		decompressed.Message, err = ioutil.ReadAll(reader)
+	default:
+		err = fmt.Errorf("unknown compression codec %q", message.MessageCodec)
+	}
+	if err != nil {
+		err = fmt.Errorf("message %s is failed to be decompressed: %w", message.ID, err)
+	}
+
+	return
+}
+
+// newStorageStats derives the savings from the sums of the payload sizes.
+func newStorageStats(messages, compressedMessages, messageSize, storedMessageSize int64) (stats entity.StorageStats) {
+	stats = entity.StorageStats{
+		Messages:           messages,
+		CompressedMessages: compressedMessages,
+		MessageSize:        messageSize,
+		StoredMessageSize:  storedMessageSize,
+		SavedSize:          messageSize - storedMessageSize,
+	}
+	if messageSize > 0 {
+		stats.SavingRatio = float64(stats.SavedSize) / float64(messageSize)
+	}
+
+	return
+}
+
+// storageStatsAccumulator sums the payload sizes for the backends that iterate over the messages,
+// the message that is stored before the sizes are recorded counts by its stored payload.
+type storageStatsAccumulator struct {
+	messages, compressedMessages, messageSize, storedMessageSize int64
+}
+
+func (a *storageStatsAccumulator) add(message entity.Message) {
+	a.messages++
+	if message.MessageCodec != "" {
+		a.compressedMessages++
+	}
+	if message.MessageSize == 0 && message.MessageCodec == "" {
+		a.messageSize += int64(len(message.Message))
+		a.storedMessageSize += int64(len(message.Message))
+		return
+	}
+	a.messageSize += message.MessageSize
+	a.storedMessageSize += message.StoredMessageSize
+}
+
+func (a *storageStatsAccumulator) stats() entity.StorageStats {
+	return newStorageStats(a.messages, a.compressedMessages, a.messageSize, a.storedMessageSize)
+}
@@ -0,0 +1,78 @@
+package repository_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/entity"
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/repository"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompressedDLQRepository(t *testing.T) {
+	ctx := context.TODO()
+	payload := bytes.Repeat([]byte(`{"orderId":"order-1"}`), 100)
+
+	for _, codec := range []string{entity.MessageCodecZstd, entity.MessageCodecGzip} {
+		t.Run(codec, func(t *testing.T) {
+			stored := repository.NewMemoryDLQRepository()
+			r, err := repository.NewCompressedDLQRepository(logrus.New(), stored, &repository.CompressionConfig{
+				Codec:     codec,
+				Threshold: 1024,
+			})
+			assert.NoError(t, err)
+
+			assert.NoError(t, r.InsertOne(ctx, entity.Message{ID: "large", Message: payload}))
+			assert.NoError(t, r.InsertOne(ctx, entity.Message{ID: "small", Message: payload[:100]}))
+
+			raw, err := stored.FindByID(ctx, "large")
+			assert.NoError(t, err)
+			assert.Equal(t, codec, raw.MessageCodec)
+			assert.Equal(t, int64(len(payload)), raw.MessageSize)
+			assert.Less(t, len(raw.Message), len(payload))
+			assert.Equal(t, int64(len(raw.Message)), raw.StoredMessageSize)
+
+			found, err := r.FindByID(ctx, "large")
+			assert.NoError(t, err)
+			assert.Equal(t, payload, found.Message)
+
+			raw, err = stored.FindByID(ctx, "small")
+			assert.NoError(t, err)
+			assert.Empty(t, raw.MessageCodec)
+			assert.Equal(t, payload[:100], raw.Message)
+
+			bunchOfMessage, err := r.FindMany(ctx, "", 10, 0)
+			assert.NoError(t, err)
+			assert.Equal(t, payload, bunchOfMessage[0].Message)
+
+			stats, err := r.StorageStats(ctx)
+			assert.NoError(t, err)
+			assert.Equal(t, int64(1), stats.CompressedMessages)
+			assert.Equal(t, int64(len(payload)+100), stats.MessageSize)
+			assert.Greater(t, stats.SavedSize, int64(0))
+		})
+	}
+}
+
+func TestCompressedDLQRepository_ReadsEveryCodec(t *testing.T) {
+	ctx := context.TODO()
+	stored := repository.NewMemoryDLQRepository()
+	payload := bytes.Repeat([]byte("a"), 2048)
+
+	gzipped, err := repository.NewCompressedDLQRepository(logrus.New(), stored, &repository.CompressionConfig{Codec: entity.MessageCodecGzip})
+	assert.NoError(t, err)
+	assert.NoError(t, gzipped.InsertOne(ctx, entity.Message{ID: "gzipped", Message: payload}))
+
+	// The codec is switched off, the payloads which are stored compressed are still read.
+	uncompressed, err := repository.NewCompressedDLQRepository(logrus.New(), stored, &repository.CompressionConfig{})
+	assert.NoError(t, err)
+
+	found, err := uncompressed.FindByID(ctx, "gzipped")
+	assert.NoError(t, err)
+	assert.Equal(t, payload, found.Message)
+
+	_, err = repository.NewCompressedDLQRepository(logrus.New(), stored, &repository.CompressionConfig{Codec: "lz4"})
+	assert.Error(t, err)
+}
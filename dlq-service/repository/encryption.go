@@ -0,0 +1,227 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/encryption"
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/entity"
+	"github.com/sirupsen/logrus"
+)
+
+// EncryptionConfig is a configuration of the encryption of the messages at rest.
+type EncryptionConfig struct {
+	Provider encryption.KeyProvider
+	// Headers are the keys of the headers whose values are encrypted along with the payload.
+	Headers []string
+}
+
+type encryptedDLQRepository struct {
+	DLQRepository
+	logger *logrus.Logger
+	config *EncryptionConfig
+}
+
+// NewEncryptedDLQRepository wraps the repository of any backend, it encrypts the payload and the configured header values
+// of the new messages by their own data key. The reads return the messages decrypted only when the context allows it
+// by encryption.WithDecryption, the others are returned as they are stored.
+func NewEncryptedDLQRepository(logger *logrus.Logger, repository DLQRepository, config *EncryptionConfig) DLQRepository {
+	return &encryptedDLQRepository{
+		DLQRepository: repository,
+		logger:        logger,
+		config:        config,
+	}
+}
+
+func (r *encryptedDLQRepository) InsertOne(ctx context.Context, message entity.Message) (err error) {
+	if message, err = r.encrypt(ctx, message); err != nil {
+		r.logger.Error(err)
+		return
+	}
+
+	return r.DLQRepository.InsertOne(ctx, message)
+}
+
+func (r *encryptedDLQRepository) InsertMany(ctx context.Context, bunchOfMessage []entity.Message) (failures map[int]error, err error) {
+	encrypted := make([]entity.Message, len(bunchOfMessage))
+	for i, message := range bunchOfMessage {
+		if encrypted[i], err = r.encrypt(ctx, message); err != nil {
+			r.logger.Error(err)
+			return
+		}
+	}
+
+	return r.DLQRepository.InsertMany(ctx, encrypted)
+}
+
+func (r *encryptedDLQRepository) FindMany(ctx context.Context, status string, limit, skip int64) (bunchOfMessage []entity.Message, err error) {
+	if bunchOfMessage, err = r.DLQRepository.FindMany(ctx, status, limit, skip); err != nil {
+		return
+	}
+
+	err = r.decryptAll(ctx, bunchOfMessage)
+
+	return
+}
+
+func (r *encryptedDLQRepository) FindByID(ctx context.Context, ID string) (message entity.Message, err error) {
+	if message, err = r.DLQRepository.FindByID(ctx, ID); err != nil {
+		return
+	}
+
+	if message, err = r.decrypt(ctx, message); err != nil {
+		r.logger.Error(err)
+		return
+	}
+
+	return
+}
+
+func (r *encryptedDLQRepository) ClaimForReplay(ctx context.Context, ID string, claimedUntil time.Time) (message entity.Message, err error) {
+	if message, err = r.DLQRepository.ClaimForReplay(ctx, ID, claimedUntil); err != nil {
+		return
+	}
+
+	if message, err = r.decrypt(ctx, message); err != nil {
+		r.logger.Error(err)
+		return
+	}
+
+	return
+}
+
+func (r *encryptedDLQRepository) FindExpired(ctx context.Context, before time.Time, limit int64) (bunchOfMessage []entity.Message, err error) {
+	if bunchOfMessage, err = r.DLQRepository.FindExpired(ctx, before, limit); err != nil {
+		return
+	}
+
+	err = r.decryptAll(ctx, bunchOfMessage)
+
+	return
+}
+
+func (r *encryptedDLQRepository) decryptAll(ctx context.Context, bunchOfMessage []entity.Message) (err error) {
+	for i, message := range bunchOfMessage {
+		if bunchOfMessage[i], err = r.decrypt(ctx, message); err != nil {
+			r.logger.Error(err)
+			return
+		}
+	}
+
+	return
+}
+
+// encrypt wraps a new data key by the primary key. The offloaded payload is encrypted in the blob store before the message
+// is written, the message comes with the envelope of its data key which encrypts the header values as well.
+func (r *encryptedDLQRepository) encrypt(ctx context.Context, message entity.Message) (encrypted entity.Message, err error) {
+	encrypted = message
+	if message.Encryption != nil && (message.MessageRef == "" || len(message.Encryption.Headers) > 0) {
+		return
+	}
+
+	dataKey, envelope, err := r.dataKey(ctx, message)
+	if err != nil {
+		err = fmt.Errorf("message %s is failed to be encrypted: %w", message.ID, err)
+		return
+	}
+
+	if len(message.Message) > 0 {
+		if encrypted.Message, err = encryption.Seal(dataKey, message.Message); err != nil {
+			return
+		}
+	}
+
+	// The headers are copied so that the values of the caller are left in plain.
+	encrypted.Headers = make(entity.MessageHeaders, len(message.Headers))
+	for i, header := range message.Headers {
+		encrypted.Headers[i] = header
+		if !containsString(r.config.Headers, header.Key) {
+			continue
+		}
+		if encrypted.Headers[i].Value, err = encryption.Seal(dataKey, header.Value); err != nil {
+			return
+		}
+		if !containsString(envelope.Headers, header.Key) {
+			envelope.Headers = append(envelope.Headers, header.Key)
+		}
+	}
+	encrypted.Encryption = envelope
+
+	return
+}
+
+// dataKey returns the data key of the envelope that comes with the offloaded payload, or a new one wrapped by the primary key.
+func (r *encryptedDLQRepository) dataKey(ctx context.Context, message entity.Message) (dataKey []byte, envelope *entity.MessageEncryption, err error) {
+	if message.Encryption != nil {
+		copied := *message.Encryption
+		envelope = &copied
+		dataKey, err = r.config.Provider.UnwrapKey(ctx, envelope.KeyID, envelope.DataKey)
+		return
+	}
+
+	if dataKey, err = encryption.NewDataKey(); err != nil {
+		return
+	}
+	keyID := r.config.Provider.PrimaryKeyID()
+	wrapped, err := r.config.Provider.WrapKey(ctx, keyID, dataKey)
+	if err != nil {
+		return
+	}
+	envelope = &entity.MessageEncryption{KeyID: keyID, DataKey: wrapped}
+
+	return
+}
+
+func (r *encryptedDLQRepository) decrypt(ctx context.Context, message entity.Message) (decrypted entity.Message, err error) {
+	decrypted = message
+	if message.Encryption == nil || !encryption.DecryptionAllowed(ctx) {
+		return
+	}
+
+	dataKey, err := r.config.Provider.UnwrapKey(ctx, message.Encryption.KeyID, message.Encryption.DataKey)
+	if err != nil {
+		err = fmt.Errorf("message %s is failed to be decrypted: %w", message.ID, err)
+		return
+	}
+
+	if len(message.Message) > 0 {
+		if decrypted.Message, err = encryption.Open(dataKey, message.Message); err != nil {
+			err = fmt.Errorf("message %s is failed to be decrypted: %w", message.ID, err)
+			return
+		}
+	}
+
+	decrypted.Headers = make(entity.MessageHeaders, len(message.Headers))
+	for i, header := range message.Headers {
+		decrypted.Headers[i] = header
+		if !containsString(message.Encryption.Headers, header.Key) {
+			continue
+		}
+		if decrypted.Headers[i].Value, err = encryption.Open(dataKey, header.Value); err != nil {
+			err = fmt.Errorf("header %s of message %s is failed to be decrypted: %w", header.Key, message.ID, err)
+			return
+		}
+	}
+
+	envelope := *message.Encryption
+	envelope.Decrypted = true
+	decrypted.Encryption = &envelope
+
+	return
+}
+
+// sealed reports whether the payload and the header values of the message are still encrypted.
+func sealed(message entity.Message) bool {
+	return message.Encryption != nil && !message.Encryption.Decrypted
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
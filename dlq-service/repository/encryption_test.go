@@ -0,0 +1,95 @@
+package repository_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/encryption"
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/entity"
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/repository"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func newKeyProvider(t *testing.T) encryption.KeyProvider {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	key := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, 32))
+	assert.NoError(t, ioutil.WriteFile(path, []byte(fmt.Sprintf(`{"primaryKeyId":"2021-11","keys":{"2021-11":%q}}`, key)), 0600))
+
+	provider, err := encryption.NewFileKeyProvider(path)
+	assert.NoError(t, err)
+
+	return provider
+}
+
+func TestEncryptedDLQRepository(t *testing.T) {
+	ctx := context.TODO()
+	payload := bytes.Repeat([]byte(`{"email":"customer@example.com"}`), 100)
+	headers := entity.MessageHeaders{
+		{Key: "authorization", Value: []byte("Bearer token")},
+		{Key: "content-type", Value: []byte("application/json")},
+	}
+
+	stored := repository.NewMemoryDLQRepository()
+	encrypted := repository.NewEncryptedDLQRepository(logrus.New(), stored, &repository.EncryptionConfig{
+		Provider: newKeyProvider(t),
+		Headers:  []string{"authorization"},
+	})
+	// The payloads are compressed before they are encrypted.
+	r, err := repository.NewCompressedDLQRepository(logrus.New(), encrypted, &repository.CompressionConfig{
+		Codec:     entity.MessageCodecZstd,
+		Threshold: 1024,
+	})
+	assert.NoError(t, err)
+
+	assert.NoError(t, r.InsertOne(ctx, entity.Message{ID: "message-1", Headers: headers, Message: payload}))
+	assert.Equal(t, []byte("Bearer token"), headers[0].Value)
+
+	raw, err := stored.FindByID(ctx, "message-1")
+	assert.NoError(t, err)
+	assert.Equal(t, "2021-11", raw.Encryption.KeyID)
+	assert.Equal(t, []string{"authorization"}, raw.Encryption.Headers)
+	assert.Equal(t, entity.MessageCodecZstd, raw.MessageCodec)
+	assert.NotContains(t, string(raw.Message), "customer@example.com")
+	assert.NotEqual(t, []byte("Bearer token"), raw.Headers[0].Value)
+	assert.Equal(t, []byte("application/json"), raw.Headers[1].Value)
+
+	// The messages are returned as they are stored unless the context allows the decryption.
+	found, err := r.FindByID(ctx, "message-1")
+	assert.NoError(t, err)
+	assert.Equal(t, raw.Message, found.Message)
+	assert.False(t, found.Encryption.Decrypted)
+
+	found, err = r.FindByID(encryption.WithDecryption(ctx), "message-1")
+	assert.NoError(t, err)
+	assert.Equal(t, payload, found.Message)
+	assert.Equal(t, headers, found.Headers)
+	assert.True(t, found.Encryption.Decrypted)
+
+	bunchOfMessage, err := r.FindMany(encryption.WithDecryption(ctx), "", 10, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, payload, bunchOfMessage[0].Message)
+
+	// The stored message is left encrypted by the reads.
+	raw, err = stored.FindByID(ctx, "message-1")
+	assert.NoError(t, err)
+	assert.NotEqual(t, []byte("Bearer token"), raw.Headers[0].Value)
+}
+
+func TestEncryptedDLQRepository_OffloadedPayload(t *testing.T) {
+	ctx := context.TODO()
+	stored := repository.NewMemoryDLQRepository()
+	r := repository.NewEncryptedDLQRepository(logrus.New(), stored, &repository.EncryptionConfig{Provider: newKeyProvider(t)})
+
+	assert.NoError(t, r.InsertOne(ctx, entity.Message{ID: "message-1", MessageRef: "dlq-message/message-1"}))
+
+	found, err := r.FindByID(encryption.WithDecryption(ctx), "message-1")
+	assert.NoError(t, err)
+	assert.Empty(t, found.Message)
+	assert.Equal(t, "dlq-message/message-1", found.MessageRef)
+}
@@ -0,0 +1,429 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/entity"
+)
+
+type memoryDLQRepository struct {
+	mu          sync.Mutex
+	order       []string
+	messages    map[string]entity.Message
+	coordinates map[string]string
+	retention   *retention
+}
+
+// NewMemoryDLQRepository returns a DLQRepository that keeps the messages in memory, it is meant for the tests and the development.
+func NewMemoryDLQRepository() DLQRepository {
+	return &memoryDLQRepository{
+		messages:    make(map[string]entity.Message),
+		coordinates: make(map[string]string),
+		retention:   &retention{},
+	}
+}
+
+func (r *memoryDLQRepository) CountDocuments(ctx context.Context, status string) (counted int64, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.purge()
+
+	for _, ID := range r.order {
+		if withStatus(r.messages[ID], status) {
+			counted++
+		}
+	}
+
+	return
+}
+
+func (r *memoryDLQRepository) InsertOne(ctx context.Context, message entity.Message) (err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.purge()
+
+	err = r.insert(message)
+
+	return
+}
+
+func (r *memoryDLQRepository) InsertMany(ctx context.Context, bunchOfMessage []entity.Message) (failures map[int]error, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.purge()
+
+	failures = make(map[int]error)
+	for i, message := range bunchOfMessage {
+		// Like the bulk write of mongodb, the redelivered messages are not failures, the duplicate IDs are.
+		if err := r.insert(message); err != nil {
+			failures[i] = err
+		}
+	}
+
+	return
+}
+
+func (r *memoryDLQRepository) insert(message entity.Message) (err error) {
+	if message.DLQTopic != "" {
+		if _, ok := r.coordinates[coordinatesKey(message)]; ok {
+			return
+		}
+	}
+	if _, ok := r.messages[message.ID]; ok {
+		err = ErrDuplicateID
+		return
+	}
+
+	r.order = append(r.order, message.ID)
+	r.messages[message.ID] = message
+	if message.DLQTopic != "" {
+		r.coordinates[coordinatesKey(message)] = message.ID
+	}
+
+	return
+}
+
+func (r *memoryDLQRepository) FindMany(ctx context.Context, status string, limit, skip int64) (bunchOfMessage []entity.Message, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.purge()
+
+	var skipped int64
+	for _, ID := range r.order {
+		if limit > 0 && int64(len(bunchOfMessage)) >= limit {
+			break
+		}
+		if !withStatus(r.messages[ID], status) {
+			continue
+		}
+		if skipped < skip {
+			skipped++
+			continue
+		}
+		bunchOfMessage = append(bunchOfMessage, r.messages[ID])
+	}
+
+	if len(bunchOfMessage) < 1 {
+		err = ErrNotFound
+	}
+
+	return
+}
+
+func (r *memoryDLQRepository) FindByID(ctx context.Context, ID string) (message entity.Message, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.purge()
+
+	message, ok := r.messages[ID]
+	if !ok {
+		err = ErrNotFound
+	}
+
+	return
+}
+
+func (r *memoryDLQRepository) DeleteByID(ctx context.Context, ID string) (err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.delete(ID)
+
+	return
+}
+
+func (r *memoryDLQRepository) delete(ID string) {
+	message, ok := r.messages[ID]
+	if !ok {
+		return
+	}
+
+	delete(r.messages, ID)
+	if message.DLQTopic != "" {
+		delete(r.coordinates, coordinatesKey(message))
+	}
+	for i, id := range r.order {
+		if id == ID {
+			r.order = append(r.order[:i], r.order[i+1:]...)
+			break
+		}
+	}
+}
+
+func (r *memoryDLQRepository) EnsureRetentionIndex(ctx context.Context, grace time.Duration) (err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.retention.enable(grace)
+
+	return
+}
+
+func (r *memoryDLQRepository) purge() {
+	deadline, ok := r.retention.due(time.Now())
+	if !ok {
+		return
+	}
+
+	for _, ID := range append([]string(nil), r.order...) {
+		if purgeable(r.messages[ID], deadline) {
+			r.delete(ID)
+		}
+	}
+}
+
+func (r *memoryDLQRepository) MarkReplayed(ctx context.Context, ID string, replayedAt time.Time, expireAt *time.Time) (err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	message, ok := r.messages[ID]
+	if !ok {
+		err = ErrNotFound
+		return
+	}
+
+	r.messages[ID] = markReplayed(message, replayedAt, expireAt)
+
+	return
+}
+
+func (r *memoryDLQRepository) ClaimForReplay(ctx context.Context, ID string, claimedUntil time.Time) (message entity.Message, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	message, ok := r.messages[ID]
+	if !ok {
+		err = ErrNotFound
+		return
+	}
+	if message.Status == entity.MessageStatusReplayed {
+		err = ErrReplayed
+		return
+	}
+	if claimed(message, time.Now()) {
+		err = ErrClaimed
+		return
+	}
+
+	message.ClaimedUntil = &claimedUntil
+	r.messages[ID] = message
+
+	return
+}
+
+func (r *memoryDLQRepository) ReleaseClaim(ctx context.Context, ID string) (err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if message, ok := r.messages[ID]; ok {
+		message.ClaimedUntil = nil
+		r.messages[ID] = message
+	}
+
+	return
+}
+
+func (r *memoryDLQRepository) FindExpired(ctx context.Context, before time.Time, limit int64) (bunchOfMessage []entity.Message, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.purge()
+
+	for _, ID := range r.order {
+		message := r.messages[ID]
+		if archivable(message, before) {
+			bunchOfMessage = append(bunchOfMessage, message)
+		}
+	}
+	bunchOfMessage = sortByExpireAt(bunchOfMessage, limit)
+
+	return
+}
+
+func (r *memoryDLQRepository) MarkArchived(ctx context.Context, IDs []string, archivedAt time.Time) (err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, ID := range IDs {
+		message, ok := r.messages[ID]
+		if !ok {
+			continue
+		}
+		message.ArchivedAt = &archivedAt
+		message.UpdatedAt = archivedAt
+		message.ClaimedUntil = nil
+		r.messages[ID] = message
+	}
+
+	return
+}
+
+func (r *memoryDLQRepository) ClaimForArchive(ctx context.Context, IDs []string, claimedUntil time.Time) (claimedIDs []string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	for _, ID := range IDs {
+		message, ok := r.messages[ID]
+		if !ok || !archivable(message, now) {
+			continue
+		}
+		message.ClaimedUntil = &claimedUntil
+		r.messages[ID] = message
+		claimedIDs = append(claimedIDs, ID)
+	}
+
+	return
+}
+
+func (r *memoryDLQRepository) UpdateExpireAt(ctx context.Context, ID, status string, expireAt *time.Time) (err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	message, ok := r.messages[ID]
+	if !ok || message.Status != status || message.ArchivedAt != nil {
+		err = ErrNotFound
+		return
+	}
+
+	message.ExpireAt = expireAt
+	r.messages[ID] = message
+
+	return
+}
+
+func (r *memoryDLQRepository) StorageStats(ctx context.Context) (stats entity.StorageStats, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.purge()
+
+	var accumulator storageStatsAccumulator
+	for _, ID := range r.order {
+		accumulator.add(r.messages[ID])
+	}
+	stats = accumulator.stats()
+
+	return
+}
+
+func (r *memoryDLQRepository) FindEncryptedWithOtherKey(ctx context.Context, keyID string, limit int64) (bunchOfMessage []entity.Message, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.purge()
+
+	for _, ID := range r.order {
+		if limit > 0 && int64(len(bunchOfMessage)) >= limit {
+			break
+		}
+		if message := r.messages[ID]; encryptedWithOtherKey(message, keyID) {
+			bunchOfMessage = append(bunchOfMessage, message)
+		}
+	}
+
+	return
+}
+
+func (r *memoryDLQRepository) UpdateEncryption(ctx context.Context, ID string, encryption entity.MessageEncryption) (err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	message, ok := r.messages[ID]
+	if !ok || message.Encryption == nil {
+		err = ErrNotFound
+		return
+	}
+
+	message.Encryption = &encryption
+	r.messages[ID] = message
+
+	return
+}
+
+type memorySubscriptionRepository struct {
+	mu            sync.Mutex
+	subscriptions map[string]entity.Subscription
+}
+
+// NewMemorySubscriptionRepository returns a SubscriptionRepository that keeps the subscriptions in memory.
+func NewMemorySubscriptionRepository() SubscriptionRepository {
+	return &memorySubscriptionRepository{
+		subscriptions: make(map[string]entity.Subscription),
+	}
+}
+
+func (r *memorySubscriptionRepository) FindByID(ctx context.Context, ID string) (subscription entity.Subscription, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	subscription, ok := r.subscriptions[ID]
+	if !ok {
+		err = ErrNotFound
+	}
+
+	return
+}
+
+func (r *memorySubscriptionRepository) Upsert(ctx context.Context, subscription entity.Subscription) (err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.subscriptions[subscription.ID] = subscription
+
+	return
+}
+
+func expired(message entity.Message, deadline time.Time) bool {
+	return message.ExpireAt != nil && !message.ExpireAt.After(deadline)
+}
+
+// purgeable is true when the message is archived before the deadline, the messages that are not archived are never removed.
+func purgeable(message entity.Message, deadline time.Time) bool {
+	return message.ArchivedAt != nil && !message.ArchivedAt.After(deadline)
+}
+
+func archivable(message entity.Message, before time.Time) bool {
+	return message.ArchivedAt == nil && expired(message, before) && !claimed(message, before)
+}
+
+// withStatus is true when the message has the status, the empty status matches any.
+func withStatus(message entity.Message, status string) bool {
+	return status == "" || message.Status == status
+}
+
+func claimed(message entity.Message, now time.Time) bool {
+	return message.ClaimedUntil != nil && message.ClaimedUntil.After(now)
+}
+
+func encryptedWithOtherKey(message entity.Message, keyID string) bool {
+	return message.Encryption != nil && message.Encryption.KeyID != keyID
+}
+
+func markReplayed(message entity.Message, replayedAt time.Time, expireAt *time.Time) entity.Message {
+	message.Status = entity.MessageStatusReplayed
+	message.ReplayedAt = &replayedAt
+	message.UpdatedAt = replayedAt
+	message.ExpireAt = expireAt
+	message.ArchivedAt = nil
+	message.ClaimedUntil = nil
+
+	return message
+}
+
+// sortByExpireAt sorts the messages like FindExpired of mongodb and keeps the first limit of them, a zero limit keeps all.
+func sortByExpireAt(bunchOfMessage []entity.Message, limit int64) []entity.Message {
+	sort.SliceStable(bunchOfMessage, func(i, j int) bool {
+		return bunchOfMessage[i].ExpireAt.Before(*bunchOfMessage[j].ExpireAt)
+	})
+	if limit > 0 && int64(len(bunchOfMessage)) > limit {
+		bunchOfMessage = bunchOfMessage[:limit]
+	}
+
+	return bunchOfMessage
+}
+
+func coordinatesKey(message entity.Message) string {
+	return fmt.Sprintf("%s/%d/%d", message.DLQTopic, message.DLQPartition, message.DLQOffset)
+}
@@ -0,0 +1,53 @@
+package repository_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/entity"
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/repository"
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/repository/repositorytest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryDLQRepository(t *testing.T) {
+	repositorytest.TestDLQRepository(t, func(t *testing.T) repository.DLQRepository {
+		return repository.NewMemoryDLQRepository()
+	})
+}
+
+func TestMemorySubscriptionRepository(t *testing.T) {
+	repositorytest.TestSubscriptionRepository(t, func(t *testing.T) repository.SubscriptionRepository {
+		return repository.NewMemorySubscriptionRepository()
+	})
+}
+
+func TestMemoryDLQRepository_Retention(t *testing.T) {
+	testRetention(t, repository.NewMemoryDLQRepository())
+}
+
+// testRetention checks that the messages are removed once the grace is over after their `archivedAt`,
+// the expired messages that are not archived are kept.
+func testRetention(t *testing.T, r repository.DLQRepository) {
+	ctx := context.TODO()
+
+	expired := time.Now().UTC().Add(-time.Hour * 3)
+	archived := time.Now().UTC().Add(-time.Hour * 2)
+	inGrace := time.Now().UTC().Add(-time.Minute)
+	assert.NoError(t, r.InsertOne(ctx, entity.Message{ID: "archived", ExpireAt: &expired}))
+	assert.NoError(t, r.InsertOne(ctx, entity.Message{ID: "in-grace", ExpireAt: &expired}))
+	assert.NoError(t, r.InsertOne(ctx, entity.Message{ID: "not-archived", ExpireAt: &expired}))
+	assert.NoError(t, r.InsertOne(ctx, entity.Message{ID: "kept"}))
+	assert.NoError(t, r.MarkArchived(ctx, []string{"archived"}, archived))
+	assert.NoError(t, r.MarkArchived(ctx, []string{"in-grace"}, inGrace))
+
+	assert.NoError(t, r.EnsureRetentionIndex(ctx, time.Hour))
+
+	_, err := r.FindByID(ctx, "archived")
+	assert.Equal(t, repository.ErrNotFound, err)
+
+	counted, err := r.CountDocuments(ctx, "")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), counted)
+}
@@ -0,0 +1,60 @@
+package repository_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/migrations"
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/mongodb"
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/repository"
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/repository/repositorytest"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// newMongoDB returns a migrated database that is dropped once the test is done,
+// the tests of the mongodb backend are skipped unless `MONGODB_TEST_URL` is set.
+func newMongoDB(t *testing.T) mongodb.Database {
+	mongodbURL := os.Getenv("MONGODB_TEST_URL")
+	if mongodbURL == "" {
+		t.Skip("MONGODB_TEST_URL is not set, `make test-integration` runs the test against a mongodb container")
+	}
+
+	ctx := context.TODO()
+	mongodbClient, err := mongo.Connect(ctx, options.Client().ApplyURI(mongodbURL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := fmt.Sprintf("dlq-service-test-%d", time.Now().UnixNano())
+	t.Cleanup(func() {
+		mongodbClient.Database(name).Drop(ctx)
+		mongodbClient.Disconnect(ctx)
+	})
+
+	db := mongodb.NewClientAdapter(mongodbClient).Database(name)
+	migrator := migrations.NewMigrator(logrus.New(), db, &migrations.MigratorConfig{
+		LockTTL:          time.Minute,
+		LockPollInterval: time.Second,
+	}, migrations.DLQMigrations())
+	if _, err := migrator.Migrate(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	return db
+}
+
+func TestMongoDBDLQRepository(t *testing.T) {
+	repositorytest.TestDLQRepository(t, func(t *testing.T) repository.DLQRepository {
+		return repository.NewDLQRepository(logrus.New(), newMongoDB(t))
+	})
+}
+
+func TestMongoDBSubscriptionRepository(t *testing.T) {
+	repositorytest.TestSubscriptionRepository(t, func(t *testing.T) repository.SubscriptionRepository {
+		return repository.NewSubscriptionRepository(logrus.New(), newMongoDB(t))
+	})
+}
@@ -0,0 +1,568 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/entity"
+	"github.com/sirupsen/logrus"
+)
+
+// The tables of the postgres backend, they are created by the postgres migrations.
+const (
+	DLQMessageTable   = "dlq_message"
+	SubscriptionTable = "dlq_subscription"
+)
+
+const uniqueViolationErrorCode = "23505"
+
+// postgresMessageColumns is the order of the columns that are written and scanned for the messages.
+const postgresMessageColumns = `id, channel, publisher, consumer, key, headers, message, content_type, schema_version,
+	caused_by, stack_trace, failed_consume_date, "partition", "offset", produced_date, consumer_group, instance_id, attempt,
+	dlq_topic, dlq_partition, dlq_offset, dlq_key, ingested_at, updated_at, status, replayed_at, expire_at, archived_at, claimed_until,
+	message_codec, message_size, stored_message_size, message_ref, message_checksum, encryption`
+
+const postgresInsertMessage = `INSERT INTO ` + DLQMessageTable + ` (` + postgresMessageColumns + `)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22, $23, $24, $25, $26, $27, $28, $29, $30, $31, $32, $33, $34, $35)`
+
+// postgresInsertMessageOnce keeps the message that is stored with the same coordinates as it is like the upsert of mongodb,
+// the conflict is limited to the index of the coordinates so that a duplicate ID still fails on the index of the ID.
+const postgresInsertMessageOnce = postgresInsertMessage + `
+	ON CONFLICT (dlq_topic, dlq_partition, dlq_offset) WHERE dlq_topic IS NOT NULL DO NOTHING`
+
+type postgresDLQRepository struct {
+	logger    *logrus.Logger
+	db        *sql.DB
+	mu        sync.Mutex
+	retention *retention
+}
+
+// NewPostgresDLQRepository returns a DLQRepository that stores the messages in postgres,
+// the headers are stored as JSONB and the tables are created by the postgres migrations.
+func NewPostgresDLQRepository(logger *logrus.Logger, db *sql.DB) DLQRepository {
+	return &postgresDLQRepository{
+		logger:    logger,
+		db:        db,
+		retention: &retention{},
+	}
+}
+
+func (r *postgresDLQRepository) CountDocuments(ctx context.Context, status string) (counted int64, err error) {
+	if err = r.purge(ctx); err != nil {
+		return
+	}
+
+	query := `SELECT count(*) FROM ` + DLQMessageTable + ` WHERE ($1 = '' OR status = $1)`
+	if err = r.db.QueryRowContext(ctx, query, status).Scan(&counted); err != nil {
+		r.logger.Error(err)
+		return
+	}
+
+	return
+}
+
+func (r *postgresDLQRepository) InsertOne(ctx context.Context, message entity.Message) (err error) {
+	if err = r.purge(ctx); err != nil {
+		return
+	}
+
+	args, err := postgresMessageArgs(message)
+	if err != nil {
+		r.logger.Error(err)
+		return
+	}
+
+	_, err = r.db.ExecContext(ctx, postgresInsertMessageOnce, args...)
+	if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == uniqueViolationErrorCode {
+		err = ErrDuplicateID
+	}
+	if err != nil {
+		r.logger.Error(err)
+		return
+	}
+
+	return
+}
+
+func (r *postgresDLQRepository) InsertMany(ctx context.Context, bunchOfMessage []entity.Message) (failures map[int]error, err error) {
+	failures = make(map[int]error)
+	if len(bunchOfMessage) < 1 {
+		return
+	}
+	if err = r.purge(ctx); err != nil {
+		return
+	}
+
+	// The whole batch is written in a single transaction, like the bulk write of mongodb
+	// the redelivered messages are not failures, the duplicate IDs are.
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		r.logger.Error(err)
+		return
+	}
+	defer tx.Rollback()
+
+	statement, err := tx.PrepareContext(ctx, postgresInsertMessageOnce)
+	if err != nil {
+		r.logger.Error(err)
+		return
+	}
+	defer statement.Close()
+
+	for i, message := range bunchOfMessage {
+		args, err := postgresMessageArgs(message)
+		if err != nil {
+			r.logger.Error(err)
+			return failures, err
+		}
+
+		// The savepoint keeps the transaction usable after the unique violation of the duplicate ID.
+		if _, err = tx.ExecContext(ctx, `SAVEPOINT dlq_insert`); err != nil {
+			r.logger.Error(err)
+			return failures, err
+		}
+		_, err = statement.ExecContext(ctx, args...)
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == uniqueViolationErrorCode {
+			failures[i] = ErrDuplicateID
+			_, err = tx.ExecContext(ctx, `ROLLBACK TO SAVEPOINT dlq_insert`)
+		}
+		if err != nil {
+			r.logger.Error(err)
+			return failures, err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		r.logger.Error(err)
+		return
+	}
+
+	return
+}
+
+func (r *postgresDLQRepository) FindMany(ctx context.Context, status string, limit, skip int64) (bunchOfMessage []entity.Message, err error) {
+	if err = r.purge(ctx); err != nil {
+		return
+	}
+
+	query := `SELECT ` + postgresMessageColumns + ` FROM ` + DLQMessageTable + `
+		WHERE ($3 = '' OR status = $3) ORDER BY seq LIMIT $1 OFFSET $2`
+	bunchOfMessage, err = r.query(ctx, query, sql.NullInt64{Int64: limit, Valid: limit > 0}, skip, status)
+	if err != nil {
+		return
+	}
+
+	if len(bunchOfMessage) < 1 {
+		err = ErrNotFound
+	}
+
+	return
+}
+
+func (r *postgresDLQRepository) FindByID(ctx context.Context, ID string) (message entity.Message, err error) {
+	if err = r.purge(ctx); err != nil {
+		return
+	}
+
+	query := `SELECT ` + postgresMessageColumns + ` FROM ` + DLQMessageTable + ` WHERE id = $1`
+	if message, err = scanPostgresMessage(r.db.QueryRowContext(ctx, query, ID)); err != nil {
+		r.logger.Error(err)
+		return
+	}
+
+	return
+}
+
+func (r *postgresDLQRepository) DeleteByID(ctx context.Context, ID string) (err error) {
+	if _, err = r.db.ExecContext(ctx, `DELETE FROM `+DLQMessageTable+` WHERE id = $1`, ID); err != nil {
+		r.logger.Error(err)
+		return
+	}
+
+	return
+}
+
+// EnsureRetentionIndex enables the purge of the archived messages, postgres has no TTL index,
+// the index of `archived_at` is created by the postgres migrations.
+func (r *postgresDLQRepository) EnsureRetentionIndex(ctx context.Context, grace time.Duration) (err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.retention.enable(grace)
+
+	return
+}
+
+func (r *postgresDLQRepository) purge(ctx context.Context) (err error) {
+	r.mu.Lock()
+	deadline, ok := r.retention.due(time.Now())
+	r.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	if _, err = r.db.ExecContext(ctx, `DELETE FROM `+DLQMessageTable+` WHERE archived_at <= $1`, deadline.UTC()); err != nil {
+		r.logger.Error(err)
+		return
+	}
+
+	return
+}
+
+// ClaimForReplay skips the message while its row is locked by another claim, so the concurrent claims do not wait for each other.
+func (r *postgresDLQRepository) ClaimForReplay(ctx context.Context, ID string, claimedUntil time.Time) (message entity.Message, err error) {
+	query := `UPDATE ` + DLQMessageTable + ` SET claimed_until = $2
+		WHERE seq = (
+			SELECT seq FROM ` + DLQMessageTable + `
+			WHERE id = $1 AND status <> $4 AND (claimed_until IS NULL OR claimed_until <= $3)
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING ` + postgresMessageColumns
+
+	message, err = scanPostgresMessage(r.db.QueryRowContext(ctx, query, ID, claimedUntil.UTC(), time.Now().UTC(), entity.MessageStatusReplayed))
+	if err != ErrNotFound {
+		if err != nil {
+			r.logger.Error(err)
+		}
+		return
+	}
+
+	var status string
+	err = r.db.QueryRowContext(ctx, `SELECT status FROM `+DLQMessageTable+` WHERE id = $1`, ID).Scan(&status)
+	switch {
+	case err == sql.ErrNoRows:
+		err = ErrNotFound
+	case err != nil:
+		r.logger.Error(err)
+	case status == entity.MessageStatusReplayed:
+		err = ErrReplayed
+	default:
+		err = ErrClaimed
+	}
+
+	return
+}
+
+func (r *postgresDLQRepository) ReleaseClaim(ctx context.Context, ID string) (err error) {
+	if _, err = r.db.ExecContext(ctx, `UPDATE `+DLQMessageTable+` SET claimed_until = NULL WHERE id = $1`, ID); err != nil {
+		r.logger.Error(err)
+		return
+	}
+
+	return
+}
+
+func (r *postgresDLQRepository) MarkReplayed(ctx context.Context, ID string, replayedAt time.Time, expireAt *time.Time) (err error) {
+	query := `UPDATE ` + DLQMessageTable + `
+		SET status = $2, replayed_at = $3, updated_at = $3, expire_at = $4, archived_at = NULL, claimed_until = NULL
+		WHERE id = $1`
+
+	result, err := r.db.ExecContext(ctx, query, ID, entity.MessageStatusReplayed, replayedAt.UTC(), postgresTime(expireAt))
+	if err != nil {
+		r.logger.Error(err)
+		return
+	}
+	if affected, _ := result.RowsAffected(); affected < 1 {
+		err = ErrNotFound
+	}
+
+	return
+}
+
+func (r *postgresDLQRepository) FindExpired(ctx context.Context, before time.Time, limit int64) (bunchOfMessage []entity.Message, err error) {
+	if err = r.purge(ctx); err != nil {
+		return
+	}
+
+	query := `SELECT ` + postgresMessageColumns + ` FROM ` + DLQMessageTable + `
+		WHERE expire_at <= $1 AND archived_at IS NULL AND (claimed_until IS NULL OR claimed_until <= $1)
+		ORDER BY expire_at LIMIT $2`
+	bunchOfMessage, err = r.query(ctx, query, before.UTC(), sql.NullInt64{Int64: limit, Valid: limit > 0})
+
+	return
+}
+
+func (r *postgresDLQRepository) MarkArchived(ctx context.Context, IDs []string, archivedAt time.Time) (err error) {
+	query := `UPDATE ` + DLQMessageTable + ` SET archived_at = $2, updated_at = $2, claimed_until = NULL WHERE id = ANY($1)`
+
+	if _, err = r.db.ExecContext(ctx, query, pq.Array(IDs), archivedAt.UTC()); err != nil {
+		r.logger.Error(err)
+		return
+	}
+
+	return
+}
+
+// ClaimForArchive re-checks the claim of every row once its lock is taken, so a row is claimed by one replica only.
+func (r *postgresDLQRepository) ClaimForArchive(ctx context.Context, IDs []string, claimedUntil time.Time) (claimedIDs []string, err error) {
+	query := `UPDATE ` + DLQMessageTable + ` SET claimed_until = $2
+		WHERE id = ANY($1) AND expire_at <= $3 AND archived_at IS NULL AND (claimed_until IS NULL OR claimed_until <= $3)
+		RETURNING id`
+
+	rows, err := r.db.QueryContext(ctx, query, pq.Array(IDs), claimedUntil.UTC(), time.Now().UTC())
+	if err != nil {
+		r.logger.Error(err)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var ID string
+		if err = rows.Scan(&ID); err != nil {
+			r.logger.Error(err)
+			return
+		}
+		claimedIDs = append(claimedIDs, ID)
+	}
+	if err = rows.Err(); err != nil {
+		r.logger.Error(err)
+		return
+	}
+
+	return
+}
+
+func (r *postgresDLQRepository) UpdateExpireAt(ctx context.Context, ID, status string, expireAt *time.Time) (err error) {
+	query := `UPDATE ` + DLQMessageTable + ` SET expire_at = $3 WHERE id = $1 AND status = $2 AND archived_at IS NULL`
+
+	result, err := r.db.ExecContext(ctx, query, ID, status, postgresTime(expireAt))
+	if err != nil {
+		r.logger.Error(err)
+		return
+	}
+	if affected, _ := result.RowsAffected(); affected < 1 {
+		err = ErrNotFound
+	}
+
+	return
+}
+
+func (r *postgresDLQRepository) StorageStats(ctx context.Context) (stats entity.StorageStats, err error) {
+	if err = r.purge(ctx); err != nil {
+		return
+	}
+
+	query := `SELECT count(*), count(*) FILTER (WHERE message_codec <> ''),
+		COALESCE(SUM(message_size), 0), COALESCE(SUM(stored_message_size), 0) FROM ` + DLQMessageTable
+
+	var messages, compressedMessages, messageSize, storedMessageSize int64
+	if err = r.db.QueryRowContext(ctx, query).Scan(&messages, &compressedMessages, &messageSize, &storedMessageSize); err != nil {
+		r.logger.Error(err)
+		return
+	}
+	stats = newStorageStats(messages, compressedMessages, messageSize, storedMessageSize)
+
+	return
+}
+
+func (r *postgresDLQRepository) FindEncryptedWithOtherKey(ctx context.Context, keyID string, limit int64) (bunchOfMessage []entity.Message, err error) {
+	if err = r.purge(ctx); err != nil {
+		return
+	}
+
+	query := `SELECT ` + postgresMessageColumns + ` FROM ` + DLQMessageTable + `
+		WHERE encryption IS NOT NULL AND encryption->>'keyId' <> $1
+		ORDER BY seq LIMIT $2`
+	bunchOfMessage, err = r.query(ctx, query, keyID, sql.NullInt64{Int64: limit, Valid: limit > 0})
+
+	return
+}
+
+func (r *postgresDLQRepository) UpdateEncryption(ctx context.Context, ID string, encryption entity.MessageEncryption) (err error) {
+	envelope, err := json.Marshal(encryption)
+	if err != nil {
+		r.logger.Error(err)
+		return
+	}
+
+	query := `UPDATE ` + DLQMessageTable + ` SET encryption = $2 WHERE id = $1 AND encryption IS NOT NULL`
+
+	result, err := r.db.ExecContext(ctx, query, ID, string(envelope))
+	if err != nil {
+		r.logger.Error(err)
+		return
+	}
+	if affected, _ := result.RowsAffected(); affected < 1 {
+		err = ErrNotFound
+	}
+
+	return
+}
+
+func (r *postgresDLQRepository) query(ctx context.Context, query string, args ...interface{}) (bunchOfMessage []entity.Message, err error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		r.logger.Error(err)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var message entity.Message
+
+		if message, err = scanPostgresMessage(rows); err != nil {
+			r.logger.Error(err)
+			return
+		}
+
+		bunchOfMessage = append(bunchOfMessage, message)
+	}
+
+	if err = rows.Err(); err != nil {
+		r.logger.Error(err)
+		return
+	}
+
+	return
+}
+
+// postgresMessageArgs returns the values of postgresMessageColumns, the JSONB is sent as text since the bytes are sent as bytea.
+// The message without DLQ coordinates has no `dlq_topic` so that it is left out of the unique index of the coordinates.
+func postgresMessageArgs(message entity.Message) (args []interface{}, err error) {
+	headers, err := json.Marshal(message.Headers)
+	if err != nil {
+		return
+	}
+
+	var encryption sql.NullString
+	if message.Encryption != nil {
+		envelope, err := json.Marshal(message.Encryption)
+		if err != nil {
+			return nil, err
+		}
+		encryption = sql.NullString{String: string(envelope), Valid: true}
+	}
+
+	args = []interface{}{
+		message.ID, message.Channel, message.Publisher, message.Consumer, message.Key, string(headers), message.Message,
+		message.ContentType, message.SchemaVersion, message.CausedBy, message.StackTrace, message.FailedConsumeDate.UTC(),
+		message.Partition, message.Offset, postgresTime(message.ProducedDate), message.ConsumerGroup, message.InstanceID,
+		message.Attempt, sql.NullString{String: message.DLQTopic, Valid: message.DLQTopic != ""}, message.DLQPartition,
+		message.DLQOffset, message.DLQKey, message.IngestedAt.UTC(), message.UpdatedAt.UTC(), message.Status,
+		postgresTime(message.ReplayedAt), postgresTime(message.ExpireAt), postgresTime(message.ArchivedAt),
+		postgresTime(message.ClaimedUntil), message.MessageCodec, message.MessageSize, message.StoredMessageSize,
+		message.MessageRef, message.MessageChecksum, encryption,
+	}
+
+	return
+}
+
+type postgresScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanPostgresMessage(scanner postgresScanner) (message entity.Message, err error) {
+	var (
+		headers, encryption                                          []byte
+		dlqTopic                                                     sql.NullString
+		producedDate, replayedAt, expireAt, archivedAt, claimedUntil sql.NullTime
+	)
+
+	err = scanner.Scan(
+		&message.ID, &message.Channel, &message.Publisher, &message.Consumer, &message.Key, &headers, &message.Message,
+		&message.ContentType, &message.SchemaVersion, &message.CausedBy, &message.StackTrace, &message.FailedConsumeDate,
+		&message.Partition, &message.Offset, &producedDate, &message.ConsumerGroup, &message.InstanceID,
+		&message.Attempt, &dlqTopic, &message.DLQPartition, &message.DLQOffset, &message.DLQKey, &message.IngestedAt,
+		&message.UpdatedAt, &message.Status, &replayedAt, &expireAt, &archivedAt, &claimedUntil,
+		&message.MessageCodec, &message.MessageSize, &message.StoredMessageSize, &message.MessageRef, &message.MessageChecksum,
+		&encryption,
+	)
+	if err == sql.ErrNoRows {
+		err = ErrNotFound
+	}
+	if err != nil {
+		return
+	}
+
+	if err = json.Unmarshal(headers, &message.Headers); err != nil {
+		return
+	}
+	if encryption != nil {
+		if err = json.Unmarshal(encryption, &message.Encryption); err != nil {
+			return
+		}
+	}
+
+	message.DLQTopic = dlqTopic.String
+	message.FailedConsumeDate = message.FailedConsumeDate.UTC()
+	message.IngestedAt = message.IngestedAt.UTC()
+	message.UpdatedAt = message.UpdatedAt.UTC()
+	message.ProducedDate = timeOf(producedDate)
+	message.ReplayedAt = timeOf(replayedAt)
+	message.ExpireAt = timeOf(expireAt)
+	message.ArchivedAt = timeOf(archivedAt)
+	message.ClaimedUntil = timeOf(claimedUntil)
+
+	return
+}
+
+func postgresTime(t *time.Time) sql.NullTime {
+	if t == nil {
+		return sql.NullTime{}
+	}
+
+	return sql.NullTime{Time: t.UTC(), Valid: true}
+}
+
+func timeOf(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	utc := t.Time.UTC()
+
+	return &utc
+}
+
+type postgresSubscriptionRepository struct {
+	logger *logrus.Logger
+	db     *sql.DB
+}
+
+// NewPostgresSubscriptionRepository returns a SubscriptionRepository that stores the subscriptions in postgres.
+func NewPostgresSubscriptionRepository(logger *logrus.Logger, db *sql.DB) SubscriptionRepository {
+	return &postgresSubscriptionRepository{
+		logger: logger,
+		db:     db,
+	}
+}
+
+func (r *postgresSubscriptionRepository) FindByID(ctx context.Context, ID string) (subscription entity.Subscription, err error) {
+	var topics []byte
+
+	err = r.db.QueryRowContext(ctx, `SELECT id, topics, updated_at FROM `+SubscriptionTable+` WHERE id = $1`, ID).
+		Scan(&subscription.ID, &topics, &subscription.UpdatedAt)
+	if err == sql.ErrNoRows {
+		err = ErrNotFound
+	}
+	if err == nil {
+		err = json.Unmarshal(topics, &subscription.Topics)
+	}
+	if err != nil {
+		r.logger.Error(err)
+		return
+	}
+
+	return
+}
+
+func (r *postgresSubscriptionRepository) Upsert(ctx context.Context, subscription entity.Subscription) (err error) {
+	topics, err := json.Marshal(subscription.Topics)
+	if err != nil {
+		r.logger.Error(err)
+		return
+	}
+
+	query := `INSERT INTO ` + SubscriptionTable + ` (id, topics, updated_at) VALUES ($1, $2, $3)
+		ON CONFLICT (id) DO UPDATE SET topics = EXCLUDED.topics, updated_at = EXCLUDED.updated_at`
+
+	if _, err = r.db.ExecContext(ctx, query, subscription.ID, string(topics), subscription.UpdatedAt); err != nil {
+		r.logger.Error(err)
+		return
+	}
+
+	return
+}
@@ -0,0 +1,73 @@
+package repository_test
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	_ "github.com/lib/pq" // postgres driver
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/migrations"
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/repository"
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/repository/repositorytest"
+	"github.com/sirupsen/logrus"
+)
+
+// newPostgresDB returns a migrated schema that is dropped once the test is done, the tests of the postgres backend
+// are skipped unless `POSTGRES_TEST_URL` is set, e.g. to the container of `make test-db-up`.
+func newPostgresDB(t *testing.T) *sql.DB {
+	postgresURL := os.Getenv("POSTGRES_TEST_URL")
+	if postgresURL == "" {
+		t.Skip("POSTGRES_TEST_URL is not set, `make test-integration` runs the test against a postgres container")
+	}
+
+	ctx := context.TODO()
+	admin, err := sql.Open("postgres", postgresURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema := fmt.Sprintf("dlq_service_test_%d", time.Now().UnixNano())
+	if _, err := admin.ExecContext(ctx, `CREATE SCHEMA `+schema); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		admin.ExecContext(ctx, `DROP SCHEMA `+schema+` CASCADE`)
+		admin.Close()
+	})
+
+	// Every connection of the test uses the schema of the test.
+	schemaURL, err := url.Parse(postgresURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := schemaURL.Query()
+	query.Set("search_path", schema)
+	schemaURL.RawQuery = query.Encode()
+
+	db, err := sql.Open("postgres", schemaURL.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if _, err := migrations.NewPostgresMigrator(logrus.New(), db, migrations.PostgresMigrations()).Migrate(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	return db
+}
+
+func TestPostgresDLQRepository(t *testing.T) {
+	repositorytest.TestDLQRepository(t, func(t *testing.T) repository.DLQRepository {
+		return repository.NewPostgresDLQRepository(logrus.New(), newPostgresDB(t))
+	})
+}
+
+func TestPostgresSubscriptionRepository(t *testing.T) {
+	repositorytest.TestSubscriptionRepository(t, func(t *testing.T) repository.SubscriptionRepository {
+		return repository.NewPostgresSubscriptionRepository(logrus.New(), newPostgresDB(t))
+	})
+}
@@ -2,6 +2,8 @@ package repository
 
 import (
 	"context"
+	"errors"
+	"time"
 
 	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/entity"
 	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/mongodb"
@@ -9,33 +11,95 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/writeconcern"
 )
 
+// DLQRepository stores the DLQ messages.
+//
+// The messages that come from the DLQ topic are stored once per DLQ topic, partition and offset,
+// inserting the same record again keeps the stored document as it is.
 type DLQRepository interface {
 	InsertOne(ctx context.Context, message entity.Message) (err error)
-	FindMany(ctx context.Context, limit, skip int64) (bunchOfMessage []entity.Message, err error)
+	// InsertMany returns the error of the messages that are failed to be written by their index,
+	// or an error when the whole batch is not durably written.
+	InsertMany(ctx context.Context, bunchOfMessage []entity.Message) (failures map[int]error, err error)
+	// FindMany returns the messages with the status, the empty status matches any.
+	FindMany(ctx context.Context, status string, limit, skip int64) (bunchOfMessage []entity.Message, err error)
 	FindByID(ctx context.Context, ID string) (message entity.Message, err error)
 	DeleteByID(ctx context.Context, ID string) (err error)
-	CountDocuments(ctx context.Context) (counted int64, err error)
+	// CountDocuments counts the messages with the status, the empty status matches any.
+	CountDocuments(ctx context.Context, status string) (counted int64, err error)
+	// EnsureRetentionIndex makes mongodb remove the messages once the grace is over after their `archivedAt`,
+	// the expired messages that are not archived are kept.
+	EnsureRetentionIndex(ctx context.Context, grace time.Duration) (err error)
+	// ClaimForReplay claims the message until the time so that the replicas do not replay it concurrently,
+	// it returns ErrClaimed while the claim of another replay is not over and ErrReplayed once the message is replayed.
+	ClaimForReplay(ctx context.Context, ID string, claimedUntil time.Time) (message entity.Message, err error)
+	ReleaseClaim(ctx context.Context, ID string) (err error)
+	// MarkReplayed releases the claim of the message as well, the replayed message is archived again once it expires.
+	MarkReplayed(ctx context.Context, ID string, replayedAt time.Time, expireAt *time.Time) (err error)
+	// FindExpired returns the messages that are expired before the time and are neither archived nor claimed yet.
+	FindExpired(ctx context.Context, before time.Time, limit int64) (bunchOfMessage []entity.Message, err error)
+	// ClaimForArchive claims the expired messages that are neither archived nor claimed until the time so that the replicas
+	// do not archive them concurrently, it returns the IDs of the messages that are claimed.
+	ClaimForArchive(ctx context.Context, IDs []string, claimedUntil time.Time) (claimedIDs []string, err error)
+	// MarkArchived releases the claim of the messages as well.
+	MarkArchived(ctx context.Context, IDs []string, archivedAt time.Time) (err error)
+	// UpdateExpireAt replaces the expiry of the message while it has the status and is not archived,
+	// so that the expiry of a concurrent replay is kept, it returns ErrNotFound otherwise.
+	UpdateExpireAt(ctx context.Context, ID, status string, expireAt *time.Time) (err error)
+	// StorageStats sums the payload sizes of the stored messages before and after their compression.
+	StorageStats(ctx context.Context) (stats entity.StorageStats, err error)
+	// FindEncryptedWithOtherKey returns the encrypted messages whose data key is wrapped by a key other than the key ID.
+	FindEncryptedWithOtherKey(ctx context.Context, keyID string, limit int64) (bunchOfMessage []entity.Message, err error)
+	// UpdateEncryption replaces the envelope of the encrypted message, the data key that is wrapped again by another key
+	// still opens its encrypted payload and header values.
+	UpdateEncryption(ctx context.Context, ID string, encryption entity.MessageEncryption) (err error)
 }
 
+// ErrNotFound is returned by every backend when the requested message or subscription does not exist,
+// the mongodb backend translates the error of the driver to it so that the callers do not depend on the backend.
+var ErrNotFound = errors.New("repository: not found")
+
+// ErrDuplicateID is returned by InsertOne, and reported by InsertMany as the failure of its index,
+// when a message without DLQ coordinates is inserted with an ID that is already stored.
+var ErrDuplicateID = errors.New("repository: duplicate message id")
+
+// ErrClaimed is returned by ClaimForReplay when the message is being replayed.
+var ErrClaimed = errors.New("repository: message is being replayed")
+
+// ErrReplayed is returned by ClaimForReplay when the message is already replayed.
+var ErrReplayed = errors.New("repository: message is already replayed")
+
+const (
+	duplicateKeyErrorCode          = 11000
+	indexOptionsConflictErrorCode  = 85
+	indexKeySpecsConflictErrorCode = 86
+	retentionIndexName             = "dlq_retention"
+)
+
 type dlqRepository struct {
 	logger     *logrus.Logger
 	collection string
 	db         mongodb.Database
 }
 
+// The collections of the repositories, their indexes are created by the migrations.
+const (
+	DLQMessageCollection   = "dlq-message"
+	SubscriptionCollection = "dlq-subscription"
+)
+
 func NewDLQRepository(logger *logrus.Logger, db mongodb.Database) DLQRepository {
-	collection := "dlq-message"
 	return &dlqRepository{
 		logger:     logger,
-		collection: collection,
+		collection: DLQMessageCollection,
 		db:         db,
 	}
 }
 
-func (r *dlqRepository) CountDocuments(ctx context.Context) (counted int64, err error) {
-	filter := bson.M{}
+func (r *dlqRepository) CountDocuments(ctx context.Context, status string) (counted int64, err error) {
+	filter := statusFilter(status)
 	options := options.Count()
 
 	counted, err = r.db.Collection(r.collection).CountDocuments(ctx, filter, options)
@@ -44,19 +108,85 @@ func (r *dlqRepository) CountDocuments(ctx context.Context) (counted int64, err
 }
 
 func (r *dlqRepository) InsertOne(ctx context.Context, message entity.Message) (err error) {
-	options := options.InsertOne()
-	if _, err = r.db.Collection(r.collection).InsertOne(ctx, message, options); err != nil {
+	if message.DLQTopic == "" {
+		options := options.InsertOne()
+		if _, err = r.db.Collection(r.collection).InsertOne(ctx, message, options); err != nil {
+			if mongo.IsDuplicateKeyError(err) {
+				err = ErrDuplicateID
+			}
+			r.logger.Error(err)
+			return
+		}
+
+		return
+	}
+
+	options := options.Update().SetUpsert(true)
+	_, err = r.db.Collection(r.collection).UpdateOne(ctx, coordinatesFilter(message), bson.M{"$setOnInsert": message}, options)
+	if err != nil && !mongo.IsDuplicateKeyError(err) {
+		r.logger.Error(err)
+		return
+	}
+	err = nil
+
+	return
+}
+
+func (r *dlqRepository) InsertMany(ctx context.Context, bunchOfMessage []entity.Message) (failures map[int]error, err error) {
+	failures = make(map[int]error)
+	if len(bunchOfMessage) < 1 {
+		return
+	}
+
+	models := make([]mongo.WriteModel, len(bunchOfMessage))
+	for i, message := range bunchOfMessage {
+		if message.DLQTopic == "" {
+			models[i] = mongo.NewInsertOneModel().SetDocument(message)
+			continue
+		}
+
+		models[i] = mongo.NewUpdateOneModel().
+			SetFilter(coordinatesFilter(message)).
+			SetUpdate(bson.M{"$setOnInsert": message}).
+			SetUpsert(true)
+	}
+
+	collectionOptions := options.Collection().SetWriteConcern(writeconcern.New(writeconcern.WMajority(), writeconcern.J(true)))
+	options := options.BulkWrite().SetOrdered(false)
+
+	_, err = r.db.Collection(r.collection, collectionOptions).BulkWrite(ctx, models, options)
+	if err == nil {
+		return
+	}
+
+	bulkWriteException, ok := err.(mongo.BulkWriteException)
+	if !ok || bulkWriteException.WriteConcernError != nil {
 		r.logger.Error(err)
 		return
 	}
 
+	for _, writeError := range bulkWriteException.WriteErrors {
+		if writeError.Code == duplicateKeyErrorCode {
+			// A concurrent upsert of the same record has already stored it,
+			// the message without coordinates is not stored again like InsertOne does.
+			if bunchOfMessage[writeError.Index].DLQTopic == "" {
+				failures[writeError.Index] = ErrDuplicateID
+			}
+			continue
+		}
+		failures[writeError.Index] = writeError
+	}
+	err = nil
+
 	return
 }
 
-func (r *dlqRepository) FindMany(ctx context.Context, limit, skip int64) (bunchOfMessage []entity.Message, err error) {
+func (r *dlqRepository) FindMany(ctx context.Context, status string, limit, skip int64) (bunchOfMessage []entity.Message, err error) {
 
-	filter := bson.M{}
-	options := options.Find().SetLimit(limit).SetSkip(skip)
+	filter := statusFilter(status)
+	// The messages are listed in the order they are ingested like the other backends do, `_id` breaks the ties.
+	sort := bson.D{{Key: "ingestedAt", Value: 1}, {Key: "_id", Value: 1}}
+	options := options.Find().SetSort(sort).SetLimit(limit).SetSkip(skip)
 
 	cursor, err := r.db.Collection(r.collection).Find(ctx, filter, options)
 	if err != nil {
@@ -76,7 +206,7 @@ func (r *dlqRepository) FindMany(ctx context.Context, limit, skip int64) (bunchO
 	}
 
 	if len(bunchOfMessage) < 1 {
-		err = mongo.ErrNoDocuments
+		err = ErrNotFound
 	}
 
 	return
@@ -92,6 +222,10 @@ func (r *dlqRepository) FindByID(ctx context.Context, ID string) (message entity
 	result := r.db.Collection(r.collection).FindOne(ctx, filter, options)
 
 	if err = result.Decode(&message); err != nil {
+		if err == mongo.ErrNoDocuments {
+			err = ErrNotFound
+			return
+		}
 		r.logger.Error(err)
 		return
 	}
@@ -110,3 +244,322 @@ func (r *dlqRepository) DeleteByID(ctx context.Context, ID string) (err error) {
 
 	return
 }
+
+func (r *dlqRepository) EnsureRetentionIndex(ctx context.Context, grace time.Duration) (err error) {
+	model := mongo.IndexModel{
+		Keys: bson.D{
+			{Key: "archivedAt", Value: 1},
+		},
+		Options: options.Index().
+			SetName(retentionIndexName).
+			SetExpireAfterSeconds(int32(grace / time.Second)),
+	}
+
+	indexes := r.db.Collection(r.collection).Indexes()
+
+	_, err = indexes.CreateOne(ctx, model)
+	if commandErr, ok := err.(mongo.CommandError); ok && (commandErr.Code == indexOptionsConflictErrorCode || commandErr.Code == indexKeySpecsConflictErrorCode) {
+		// The grace or the key of the index is changed, the index is created again with the new ones.
+		if err = indexes.DropOne(ctx, retentionIndexName); err != nil {
+			r.logger.Error(err)
+			return
+		}
+		_, err = indexes.CreateOne(ctx, model)
+	}
+	if err != nil {
+		r.logger.Error(err)
+		return
+	}
+
+	return
+}
+
+func (r *dlqRepository) MarkReplayed(ctx context.Context, ID string, replayedAt time.Time, expireAt *time.Time) (err error) {
+	filter := bson.M{
+		"id": ID,
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"status":     entity.MessageStatusReplayed,
+			"replayedAt": replayedAt,
+			"updatedAt":  replayedAt,
+		},
+		"$unset": bson.M{
+			"claimedUntil": "",
+			"archivedAt":   "",
+		},
+	}
+	if expireAt != nil {
+		update["$set"].(bson.M)["expireAt"] = expireAt
+	} else {
+		update["$unset"].(bson.M)["expireAt"] = ""
+	}
+	options := options.Update()
+
+	result, err := r.db.Collection(r.collection).UpdateOne(ctx, filter, update, options)
+	if err != nil {
+		r.logger.Error(err)
+		return
+	}
+	if result.MatchedCount < 1 {
+		err = ErrNotFound
+	}
+
+	return
+}
+
+func (r *dlqRepository) ClaimForReplay(ctx context.Context, ID string, claimedUntil time.Time) (message entity.Message, err error) {
+	filter := bson.M{
+		"id":     ID,
+		"status": bson.M{"$ne": entity.MessageStatusReplayed},
+		"$or": bson.A{
+			bson.M{"claimedUntil": nil},
+			bson.M{"claimedUntil": bson.M{"$lte": time.Now().UTC()}},
+		},
+	}
+	update := bson.M{
+		"$set": bson.M{"claimedUntil": claimedUntil},
+	}
+	options := options.Update()
+
+	result, err := r.db.Collection(r.collection).UpdateOne(ctx, filter, update, options)
+	if err != nil {
+		r.logger.Error(err)
+		return
+	}
+
+	message, err = r.FindByID(ctx, ID)
+	if err == nil && result.MatchedCount < 1 {
+		err = ErrClaimed
+		if message.Status == entity.MessageStatusReplayed {
+			err = ErrReplayed
+		}
+	}
+
+	return
+}
+
+func (r *dlqRepository) ReleaseClaim(ctx context.Context, ID string) (err error) {
+	filter := bson.M{
+		"id": ID,
+	}
+	update := bson.M{
+		"$unset": bson.M{"claimedUntil": ""},
+	}
+	options := options.Update()
+
+	if _, err = r.db.Collection(r.collection).UpdateOne(ctx, filter, update, options); err != nil {
+		r.logger.Error(err)
+		return
+	}
+
+	return
+}
+
+func (r *dlqRepository) FindExpired(ctx context.Context, before time.Time, limit int64) (bunchOfMessage []entity.Message, err error) {
+	filter := bson.M{
+		"expireAt":   bson.M{"$lte": before},
+		"archivedAt": bson.M{"$exists": false},
+		"$or": bson.A{
+			bson.M{"claimedUntil": nil},
+			bson.M{"claimedUntil": bson.M{"$lte": before}},
+		},
+	}
+	options := options.Find().SetSort(bson.D{{Key: "expireAt", Value: 1}}).SetLimit(limit)
+
+	cursor, err := r.db.Collection(r.collection).Find(ctx, filter, options)
+	if err != nil {
+		r.logger.Error(err)
+		return
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var message entity.Message
+
+		if err = cursor.Decode(&message); err != nil {
+			r.logger.Error(err)
+			return
+		}
+
+		bunchOfMessage = append(bunchOfMessage, message)
+	}
+
+	return
+}
+
+// ClaimForArchive claims the messages one by one, the update of a single document is atomic
+// so that a message is claimed by one replica only.
+func (r *dlqRepository) ClaimForArchive(ctx context.Context, IDs []string, claimedUntil time.Time) (claimedIDs []string, err error) {
+	now := time.Now().UTC()
+	update := bson.M{
+		"$set": bson.M{"claimedUntil": claimedUntil},
+	}
+	options := options.Update()
+
+	for _, ID := range IDs {
+		filter := bson.M{
+			"id":         ID,
+			"expireAt":   bson.M{"$lte": now},
+			"archivedAt": bson.M{"$exists": false},
+			"$or": bson.A{
+				bson.M{"claimedUntil": nil},
+				bson.M{"claimedUntil": bson.M{"$lte": now}},
+			},
+		}
+
+		result, err := r.db.Collection(r.collection).UpdateOne(ctx, filter, update, options)
+		if err != nil {
+			r.logger.Error(err)
+			return claimedIDs, err
+		}
+		if result.MatchedCount > 0 {
+			claimedIDs = append(claimedIDs, ID)
+		}
+	}
+
+	return
+}
+
+func (r *dlqRepository) MarkArchived(ctx context.Context, IDs []string, archivedAt time.Time) (err error) {
+	filter := bson.M{
+		"id": bson.M{"$in": IDs},
+	}
+	update := bson.M{
+		"$set":   bson.M{"archivedAt": archivedAt, "updatedAt": archivedAt},
+		"$unset": bson.M{"claimedUntil": ""},
+	}
+	options := options.Update()
+
+	if _, err = r.db.Collection(r.collection).UpdateMany(ctx, filter, update, options); err != nil {
+		r.logger.Error(err)
+		return
+	}
+
+	return
+}
+
+func (r *dlqRepository) UpdateExpireAt(ctx context.Context, ID, status string, expireAt *time.Time) (err error) {
+	filter := bson.M{
+		"id":         ID,
+		"status":     status,
+		"archivedAt": bson.M{"$exists": false},
+	}
+	update := bson.M{
+		"$set": bson.M{"expireAt": expireAt},
+	}
+	if expireAt == nil {
+		update = bson.M{
+			"$unset": bson.M{"expireAt": ""},
+		}
+	}
+	options := options.Update()
+
+	result, err := r.db.Collection(r.collection).UpdateOne(ctx, filter, update, options)
+	if err != nil {
+		r.logger.Error(err)
+		return
+	}
+	if result.MatchedCount < 1 {
+		err = ErrNotFound
+	}
+
+	return
+}
+
+func (r *dlqRepository) StorageStats(ctx context.Context) (stats entity.StorageStats, err error) {
+	pipeline := bson.A{
+		bson.M{"$group": bson.M{
+			"_id":                nil,
+			"messages":           bson.M{"$sum": 1},
+			"compressedMessages": bson.M{"$sum": bson.M{"$cond": bson.A{bson.M{"$ifNull": bson.A{"$messageCodec", false}}, 1, 0}}},
+			"messageSize":        bson.M{"$sum": "$messageSize"},
+			"storedMessageSize":  bson.M{"$sum": "$storedMessageSize"},
+		}},
+	}
+	options := options.Aggregate()
+
+	cursor, err := r.db.Collection(r.collection).Aggregate(ctx, pipeline, options)
+	if err != nil {
+		r.logger.Error(err)
+		return
+	}
+	defer cursor.Close(ctx)
+
+	if cursor.Next(ctx) {
+		if err = cursor.Decode(&stats); err != nil {
+			r.logger.Error(err)
+			return
+		}
+	}
+	stats = newStorageStats(stats.Messages, stats.CompressedMessages, stats.MessageSize, stats.StoredMessageSize)
+
+	return
+}
+
+func (r *dlqRepository) FindEncryptedWithOtherKey(ctx context.Context, keyID string, limit int64) (bunchOfMessage []entity.Message, err error) {
+	filter := bson.M{
+		"encryption":       bson.M{"$exists": true},
+		"encryption.keyId": bson.M{"$ne": keyID},
+	}
+	options := options.Find().SetLimit(limit)
+
+	cursor, err := r.db.Collection(r.collection).Find(ctx, filter, options)
+	if err != nil {
+		r.logger.Error(err)
+		return
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var message entity.Message
+
+		if err = cursor.Decode(&message); err != nil {
+			r.logger.Error(err)
+			return
+		}
+
+		bunchOfMessage = append(bunchOfMessage, message)
+	}
+
+	return
+}
+
+func (r *dlqRepository) UpdateEncryption(ctx context.Context, ID string, encryption entity.MessageEncryption) (err error) {
+	filter := bson.M{
+		"id":         ID,
+		"encryption": bson.M{"$exists": true},
+	}
+	update := bson.M{
+		"$set": bson.M{"encryption": encryption},
+	}
+	options := options.Update()
+
+	result, err := r.db.Collection(r.collection).UpdateOne(ctx, filter, update, options)
+	if err != nil {
+		r.logger.Error(err)
+		return
+	}
+	if result.MatchedCount < 1 {
+		err = ErrNotFound
+	}
+
+	return
+}
+
+func coordinatesFilter(message entity.Message) bson.M {
+	return bson.M{
+		"dlqTopic":     message.DLQTopic,
+		"dlqPartition": message.DLQPartition,
+		"dlqOffset":    message.DLQOffset,
+	}
+}
+
+// statusFilter matches the messages with the status, the empty status matches any.
+func statusFilter(status string) bson.M {
+	if status == "" {
+		return bson.M{}
+	}
+
+	return bson.M{"status": status}
+}
@@ -0,0 +1,249 @@
+package repository_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/entity"
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/mongodb"
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/repository"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// upsertCollection stores the upserted documents by their coordinates, like the unique index of the collection does.
+// The other behavior of the collection is not used by the tests.
+type upsertCollection struct {
+	mongodb.Collection
+	documents    map[string]entity.Message
+	updateErr    error
+	bulkWriteErr error
+}
+
+func (c *upsertCollection) upsert(filter, update interface{}, upsert *bool) (err error) {
+	if upsert == nil || !*upsert {
+		return errors.New("the write is not an upsert")
+	}
+
+	coordinates := filter.(bson.M)
+	key := fmt.Sprintf("%v/%v/%v", coordinates["dlqTopic"], coordinates["dlqPartition"], coordinates["dlqOffset"])
+	if _, ok := c.documents[key]; !ok {
+		c.documents[key] = update.(bson.M)["$setOnInsert"].(entity.Message)
+	}
+
+	return
+}
+
+func (c *upsertCollection) UpdateOne(ctx context.Context, filter interface{}, update interface{}, opts ...*options.UpdateOptions) (result *mongo.UpdateResult, err error) {
+	if c.updateErr != nil {
+		err = c.updateErr
+		return
+	}
+
+	err = c.upsert(filter, update, options.MergeUpdateOptions(opts...).Upsert)
+	result = &mongo.UpdateResult{}
+
+	return
+}
+
+func (c *upsertCollection) BulkWrite(ctx context.Context, models []mongo.WriteModel, opts ...*options.BulkWriteOptions) (result *mongo.BulkWriteResult, err error) {
+	if c.bulkWriteErr != nil {
+		err = c.bulkWriteErr
+		return
+	}
+
+	for _, model := range models {
+		updateOneModel := model.(*mongo.UpdateOneModel)
+		if err = c.upsert(updateOneModel.Filter, updateOneModel.Update, updateOneModel.Upsert); err != nil {
+			return
+		}
+	}
+	result = &mongo.BulkWriteResult{}
+
+	return
+}
+
+type upsertDatabase struct {
+	mongodb.Database
+	collection *upsertCollection
+}
+
+func (db *upsertDatabase) Collection(name string, opts ...*options.CollectionOptions) (col mongodb.Collection) {
+	return db.collection
+}
+
+func newUpsertDatabase() *upsertDatabase {
+	return &upsertDatabase{collection: &upsertCollection{documents: make(map[string]entity.Message)}}
+}
+
+func newRedeliveredMessage(ID string) entity.Message {
+	return entity.Message{ID: ID, Channel: "orders", DLQTopic: "dead-letter-queue", DLQPartition: 2, DLQOffset: 40}
+}
+
+func TestMongoDBDLQRepository_InsertOne_Redelivery(t *testing.T) {
+	db := newUpsertDatabase()
+	r := repository.NewDLQRepository(logrus.New(), db)
+
+	assert.NoError(t, r.InsertOne(context.TODO(), newRedeliveredMessage("first")))
+	assert.NoError(t, r.InsertOne(context.TODO(), newRedeliveredMessage("redelivered")))
+
+	assert.Len(t, db.collection.documents, 1)
+	assert.Equal(t, "first", db.collection.documents["dead-letter-queue/2/40"].ID)
+}
+
+func TestMongoDBDLQRepository_InsertOne_ConcurrentUpsert(t *testing.T) {
+	db := newUpsertDatabase()
+	r := repository.NewDLQRepository(logrus.New(), db)
+
+	// The concurrent upserts of the same record both miss the filter, the one that loses fails on the unique index.
+	db.collection.updateErr = mongo.WriteException{WriteErrors: mongo.WriteErrors{{Code: 11000, Message: "E11000 duplicate key error"}}}
+	assert.NoError(t, r.InsertOne(context.TODO(), newRedeliveredMessage("redelivered")))
+
+	db.collection.updateErr = mongo.WriteException{WriteErrors: mongo.WriteErrors{{Code: 10334, Message: "object to insert too large"}}}
+	assert.Error(t, r.InsertOne(context.TODO(), newRedeliveredMessage("redelivered")))
+}
+
+func TestMongoDBDLQRepository_InsertMany_Redelivery(t *testing.T) {
+	db := newUpsertDatabase()
+	r := repository.NewDLQRepository(logrus.New(), db)
+
+	failures, err := r.InsertMany(context.TODO(), []entity.Message{newRedeliveredMessage("first"), newRedeliveredMessage("redelivered")})
+
+	assert.NoError(t, err)
+	assert.Empty(t, failures)
+	assert.Len(t, db.collection.documents, 1)
+	assert.Equal(t, "first", db.collection.documents["dead-letter-queue/2/40"].ID)
+}
+
+func TestMongoDBDLQRepository_InsertMany_BulkWriteException(t *testing.T) {
+	testCases := []struct {
+		name             string
+		exception        mongo.BulkWriteException
+		expectedFailures []int
+		expectedErr      bool
+	}{
+		{
+			name: "duplicate key errors are not failures",
+			exception: mongo.BulkWriteException{WriteErrors: []mongo.BulkWriteError{
+				{WriteError: mongo.WriteError{Index: 0, Code: 11000, Message: "E11000 duplicate key error"}},
+				{WriteError: mongo.WriteError{Index: 2, Code: 11000, Message: "E11000 duplicate key error"}},
+			}},
+			expectedFailures: []int{},
+		},
+		{
+			name: "other write errors are failures",
+			exception: mongo.BulkWriteException{WriteErrors: []mongo.BulkWriteError{
+				{WriteError: mongo.WriteError{Index: 0, Code: 11000, Message: "E11000 duplicate key error"}},
+				{WriteError: mongo.WriteError{Index: 1, Code: 10334, Message: "object to insert too large"}},
+			}},
+			expectedFailures: []int{1},
+		},
+		{
+			name: "write concern error fails the batch",
+			exception: mongo.BulkWriteException{
+				WriteConcernError: &mongo.WriteConcernError{Code: 64, Message: "waiting for replication timed out"},
+			},
+			expectedFailures: []int{},
+			expectedErr:      true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			db := newUpsertDatabase()
+			db.collection.bulkWriteErr = tc.exception
+			r := repository.NewDLQRepository(logrus.New(), db)
+
+			failures, err := r.InsertMany(context.TODO(), []entity.Message{
+				newRedeliveredMessage("first"), newRedeliveredMessage("second"), newRedeliveredMessage("third"),
+			})
+
+			assert.Equal(t, tc.expectedErr, err != nil)
+			failed := make([]int, 0)
+			for i := range failures {
+				failed = append(failed, i)
+			}
+			assert.ElementsMatch(t, tc.expectedFailures, failed)
+		})
+	}
+}
+
+// emptyCollection finds no document and keeps the options of the find, the other behavior is not used by the tests.
+type emptyCollection struct {
+	mongodb.Collection
+	findOptions *options.FindOptions
+}
+
+type emptySingleResult struct{}
+
+func (r emptySingleResult) Decode(v interface{}) error { return mongo.ErrNoDocuments }
+
+func (r emptySingleResult) Err() error { return mongo.ErrNoDocuments }
+
+type emptyCursor struct {
+	mongodb.Cursor
+}
+
+func (c emptyCursor) Next(ctx context.Context) bool { return false }
+
+func (c emptyCursor) Close(ctx context.Context) error { return nil }
+
+func (c *emptyCollection) FindOne(ctx context.Context, filter interface{}, opts ...*options.FindOneOptions) (result mongodb.SingleResult) {
+	return emptySingleResult{}
+}
+
+func (c *emptyCollection) Find(ctx context.Context, filter interface{}, opts ...*options.FindOptions) (cursor mongodb.Cursor, err error) {
+	c.findOptions = options.MergeFindOptions(opts...)
+	return emptyCursor{}, nil
+}
+
+type emptyDatabase struct {
+	mongodb.Database
+	collection *emptyCollection
+}
+
+func (db *emptyDatabase) Collection(name string, opts ...*options.CollectionOptions) (col mongodb.Collection) {
+	return db.collection
+}
+
+func TestMongoDBDLQRepository_FindByID_NotFound(t *testing.T) {
+	db := &emptyDatabase{collection: &emptyCollection{}}
+
+	// The error of the driver is not leaked to the callers, they compare against the error of the repository.
+	_, err := repository.NewDLQRepository(logrus.New(), db).FindByID(context.TODO(), "unknown")
+	assert.Equal(t, repository.ErrNotFound, err)
+
+	_, err = repository.NewSubscriptionRepository(logrus.New(), db).FindByID(context.TODO(), "unknown")
+	assert.Equal(t, repository.ErrNotFound, err)
+}
+
+func TestMongoDBDLQRepository_FindMany_IngestOrder(t *testing.T) {
+	db := &emptyDatabase{collection: &emptyCollection{}}
+
+	_, err := repository.NewDLQRepository(logrus.New(), db).FindMany(context.TODO(), "NEW", 10, 20)
+	assert.Equal(t, repository.ErrNotFound, err)
+
+	if assert.NotNil(t, db.collection.findOptions) {
+		assert.Equal(t, bson.D{{Key: "ingestedAt", Value: 1}, {Key: "_id", Value: 1}}, db.collection.findOptions.Sort)
+	}
+}
+
+func TestMongoDBDLQRepository_InsertMany_DuplicateID(t *testing.T) {
+	db := newUpsertDatabase()
+	db.collection.bulkWriteErr = mongo.BulkWriteException{WriteErrors: []mongo.BulkWriteError{
+		{WriteError: mongo.WriteError{Index: 0, Code: 11000, Message: "E11000 duplicate key error"}},
+		{WriteError: mongo.WriteError{Index: 1, Code: 11000, Message: "E11000 duplicate key error"}},
+	}}
+	r := repository.NewDLQRepository(logrus.New(), db)
+
+	// The redelivered record is already stored, the message without coordinates is not stored twice.
+	failures, err := r.InsertMany(context.TODO(), []entity.Message{newRedeliveredMessage("first"), {ID: "second", Channel: "orders"}})
+
+	assert.NoError(t, err)
+	assert.Equal(t, map[int]error{1: repository.ErrDuplicateID}, failures)
+}
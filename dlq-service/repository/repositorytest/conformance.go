@@ -0,0 +1,490 @@
+// Package repositorytest is the conformance suite that every storage backend of the repositories must pass.
+package repositorytest
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/entity"
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestDLQRepository runs the conformance suite against the DLQRepository, every subtest gets an empty repository.
+func TestDLQRepository(t *testing.T, newRepository func(t *testing.T) repository.DLQRepository) {
+	ctx := context.TODO()
+
+	t.Run("insert one and find by id", func(t *testing.T) {
+		r := newRepository(t)
+		message := newMessage(1)
+
+		assert.NoError(t, r.InsertOne(ctx, message))
+
+		found, err := r.FindByID(ctx, message.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, message, found)
+	})
+
+	t.Run("find by unknown id", func(t *testing.T) {
+		r := newRepository(t)
+
+		_, err := r.FindByID(ctx, "unknown")
+		assert.Equal(t, repository.ErrNotFound, err)
+	})
+
+	t.Run("insert the same coordinates keeps the stored message", func(t *testing.T) {
+		r := newRepository(t)
+		message := newMessage(1)
+		redelivered := newMessage(2)
+		redelivered.DLQOffset = message.DLQOffset
+
+		assert.NoError(t, r.InsertOne(ctx, message))
+		assert.NoError(t, r.InsertOne(ctx, redelivered))
+
+		counted, err := r.CountDocuments(ctx, "")
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), counted)
+
+		_, err = r.FindByID(ctx, redelivered.ID)
+		assert.Equal(t, repository.ErrNotFound, err)
+	})
+
+	t.Run("insert a duplicated id without coordinates", func(t *testing.T) {
+		r := newRepository(t)
+		message := newMessage(1)
+		message.DLQTopic = ""
+
+		assert.NoError(t, r.InsertOne(ctx, message))
+		assert.Equal(t, repository.ErrDuplicateID, r.InsertOne(ctx, message))
+	})
+
+	t.Run("insert many skips the redelivered messages and fails the duplicate ids", func(t *testing.T) {
+		r := newRepository(t)
+		duplicated := newMessage(3)
+		duplicated.DLQTopic = ""
+		assert.NoError(t, r.InsertOne(ctx, duplicated))
+
+		redelivered := newMessage(4)
+		redelivered.DLQOffset = 1
+
+		failures, err := r.InsertMany(ctx, []entity.Message{newMessage(1), newMessage(2), duplicated, redelivered, newMessage(5)})
+		assert.NoError(t, err)
+		assert.Equal(t, map[int]error{2: repository.ErrDuplicateID}, failures)
+
+		// The messages after the duplicate id are still stored.
+		counted, err := r.CountDocuments(ctx, "")
+		assert.NoError(t, err)
+		assert.Equal(t, int64(4), counted)
+	})
+
+	t.Run("insert many without messages", func(t *testing.T) {
+		r := newRepository(t)
+
+		failures, err := r.InsertMany(ctx, nil)
+		assert.NoError(t, err)
+		assert.Empty(t, failures)
+	})
+
+	t.Run("find many in insertion order", func(t *testing.T) {
+		r := newRepository(t)
+		for i := 1; i <= 5; i++ {
+			assert.NoError(t, r.InsertOne(ctx, newMessage(i)))
+		}
+
+		bunchOfMessage, err := r.FindMany(ctx, "", 2, 1)
+		assert.NoError(t, err)
+		assert.Equal(t, []entity.Message{newMessage(2), newMessage(3)}, bunchOfMessage)
+
+		bunchOfMessage, err = r.FindMany(ctx, "", 10, 3)
+		assert.NoError(t, err)
+		assert.Equal(t, []entity.Message{newMessage(4), newMessage(5)}, bunchOfMessage)
+
+		_, err = r.FindMany(ctx, "", 10, 5)
+		assert.Equal(t, repository.ErrNotFound, err)
+	})
+
+	t.Run("find and count by status", func(t *testing.T) {
+		r := newRepository(t)
+		for i := 1; i <= 5; i++ {
+			assert.NoError(t, r.InsertOne(ctx, newMessage(i)))
+		}
+		for _, ID := range []string{newMessage(1).ID, newMessage(3).ID} {
+			assert.NoError(t, r.MarkReplayed(ctx, ID, now(), nil))
+		}
+
+		bunchOfMessage, err := r.FindMany(ctx, entity.MessageStatusNew, 2, 1)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{newMessage(4).ID, newMessage(5).ID}, idsOf(bunchOfMessage))
+
+		bunchOfMessage, err = r.FindMany(ctx, entity.MessageStatusReplayed, 10, 0)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{newMessage(1).ID, newMessage(3).ID}, idsOf(bunchOfMessage))
+
+		counted, err := r.CountDocuments(ctx, entity.MessageStatusNew)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(3), counted)
+
+		counted, err = r.CountDocuments(ctx, entity.MessageStatusReplayed)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(2), counted)
+	})
+
+	t.Run("delete by id", func(t *testing.T) {
+		r := newRepository(t)
+		message := newMessage(1)
+		assert.NoError(t, r.InsertOne(ctx, message))
+
+		assert.NoError(t, r.DeleteByID(ctx, message.ID))
+		assert.NoError(t, r.DeleteByID(ctx, message.ID))
+
+		_, err := r.FindByID(ctx, message.ID)
+		assert.Equal(t, repository.ErrNotFound, err)
+
+		// The coordinates of the deleted message can be stored again.
+		assert.NoError(t, r.InsertOne(ctx, message))
+		_, err = r.FindByID(ctx, message.ID)
+		assert.NoError(t, err)
+	})
+
+	t.Run("mark replayed", func(t *testing.T) {
+		r := newRepository(t)
+		message := newMessage(1)
+		assert.NoError(t, r.InsertOne(ctx, message))
+
+		replayedAt := now().Add(time.Minute)
+		expireAt := replayedAt.Add(time.Hour)
+		assert.NoError(t, r.MarkReplayed(ctx, message.ID, replayedAt, &expireAt))
+
+		found, err := r.FindByID(ctx, message.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, entity.MessageStatusReplayed, found.Status)
+		assert.Equal(t, &replayedAt, found.ReplayedAt)
+		assert.Equal(t, replayedAt, found.UpdatedAt)
+		assert.Equal(t, &expireAt, found.ExpireAt)
+
+		// A replayed message that is kept forever has no `expireAt`.
+		assert.NoError(t, r.MarkReplayed(ctx, message.ID, replayedAt, nil))
+		found, err = r.FindByID(ctx, message.ID)
+		assert.NoError(t, err)
+		assert.Nil(t, found.ExpireAt)
+
+		assert.Equal(t, repository.ErrNotFound, r.MarkReplayed(ctx, "unknown", replayedAt, nil))
+	})
+
+	t.Run("claim for replay", func(t *testing.T) {
+		r := newRepository(t)
+		message := newMessage(1)
+		assert.NoError(t, r.InsertOne(ctx, message))
+
+		claimedUntil := time.Now().UTC().Add(time.Minute).Truncate(time.Millisecond)
+		claimed, err := r.ClaimForReplay(ctx, message.ID, claimedUntil)
+		assert.NoError(t, err)
+		assert.Equal(t, message.ID, claimed.ID)
+		assert.Equal(t, &claimedUntil, claimed.ClaimedUntil)
+
+		_, err = r.ClaimForReplay(ctx, message.ID, claimedUntil)
+		assert.Equal(t, repository.ErrClaimed, err)
+
+		assert.NoError(t, r.ReleaseClaim(ctx, message.ID))
+		_, err = r.ClaimForReplay(ctx, message.ID, claimedUntil)
+		assert.NoError(t, err)
+
+		// The replay releases the claim, the replayed message is not claimed again.
+		assert.NoError(t, r.MarkReplayed(ctx, message.ID, now(), nil))
+		found, err := r.FindByID(ctx, message.ID)
+		assert.NoError(t, err)
+		assert.Nil(t, found.ClaimedUntil)
+		_, err = r.ClaimForReplay(ctx, message.ID, claimedUntil)
+		assert.Equal(t, repository.ErrReplayed, err)
+
+		// The claim that is over is taken over.
+		assert.NoError(t, r.InsertOne(ctx, newMessage(2)))
+		_, err = r.ClaimForReplay(ctx, newMessage(2).ID, time.Now().UTC().Add(-time.Second))
+		assert.NoError(t, err)
+		_, err = r.ClaimForReplay(ctx, newMessage(2).ID, claimedUntil)
+		assert.NoError(t, err)
+
+		_, err = r.ClaimForReplay(ctx, "unknown", claimedUntil)
+		assert.Equal(t, repository.ErrNotFound, err)
+		assert.NoError(t, r.ReleaseClaim(ctx, "unknown"))
+	})
+
+	t.Run("find expired and mark archived", func(t *testing.T) {
+		r := newRepository(t)
+		base := now()
+		for i, expireIn := range []time.Duration{time.Hour, -time.Hour, -time.Minute, -2 * time.Hour, 0} {
+			message := newMessage(i + 1)
+			if expireIn != 0 {
+				expireAt := base.Add(expireIn)
+				message.ExpireAt = &expireAt
+			}
+			assert.NoError(t, r.InsertOne(ctx, message))
+		}
+
+		bunchOfMessage, err := r.FindExpired(ctx, base, 2)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{newMessage(4).ID, newMessage(2).ID}, idsOf(bunchOfMessage))
+
+		archivedAt := base.Add(time.Second)
+		assert.NoError(t, r.MarkArchived(ctx, []string{newMessage(4).ID, newMessage(2).ID, "unknown"}, archivedAt))
+
+		found, err := r.FindByID(ctx, newMessage(4).ID)
+		assert.NoError(t, err)
+		assert.Equal(t, &archivedAt, found.ArchivedAt)
+		assert.Equal(t, archivedAt, found.UpdatedAt)
+
+		bunchOfMessage, err = r.FindExpired(ctx, base, 10)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{newMessage(3).ID}, idsOf(bunchOfMessage))
+
+		// The archived message that is replayed is archived again once it expires.
+		assert.NoError(t, r.MarkReplayed(ctx, newMessage(4).ID, base, &base))
+		found, err = r.FindByID(ctx, newMessage(4).ID)
+		assert.NoError(t, err)
+		assert.Nil(t, found.ArchivedAt)
+
+		bunchOfMessage, err = r.FindExpired(ctx, base, 10)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{newMessage(3).ID, newMessage(4).ID}, idsOf(bunchOfMessage))
+	})
+
+	t.Run("claim for archive", func(t *testing.T) {
+		r := newRepository(t)
+		base := now()
+		for i, expireIn := range []time.Duration{-time.Hour, -time.Minute, 0} {
+			message := newMessage(i + 1)
+			if expireIn != 0 {
+				expireAt := base.Add(expireIn)
+				message.ExpireAt = &expireAt
+			}
+			assert.NoError(t, r.InsertOne(ctx, message))
+		}
+
+		// The message that does not expire is not claimed, the claimed messages are not claimed by another replica.
+		claimedUntil := time.Now().UTC().Add(time.Minute).Truncate(time.Millisecond)
+		claimedIDs, err := r.ClaimForArchive(ctx, []string{newMessage(1).ID, newMessage(3).ID, "unknown"}, claimedUntil)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{newMessage(1).ID}, claimedIDs)
+
+		claimedIDs, err = r.ClaimForArchive(ctx, []string{newMessage(1).ID, newMessage(2).ID}, claimedUntil)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{newMessage(2).ID}, claimedIDs)
+
+		bunchOfMessage, err := r.FindExpired(ctx, time.Now().UTC(), 10)
+		assert.NoError(t, err)
+		assert.Empty(t, bunchOfMessage)
+
+		// The archive releases the claim, the archived message is not claimed again.
+		assert.NoError(t, r.MarkArchived(ctx, []string{newMessage(1).ID}, base))
+		found, err := r.FindByID(ctx, newMessage(1).ID)
+		assert.NoError(t, err)
+		assert.Nil(t, found.ClaimedUntil)
+
+		claimedIDs, err = r.ClaimForArchive(ctx, []string{newMessage(1).ID}, claimedUntil)
+		assert.NoError(t, err)
+		assert.Empty(t, claimedIDs)
+
+		// The claim of a replica that stops is taken over once it is over.
+		assert.NoError(t, r.ReleaseClaim(ctx, newMessage(2).ID))
+		claimedIDs, err = r.ClaimForArchive(ctx, []string{newMessage(2).ID}, time.Now().UTC().Add(-time.Second))
+		assert.NoError(t, err)
+		assert.Equal(t, []string{newMessage(2).ID}, claimedIDs)
+
+		bunchOfMessage, err = r.FindExpired(ctx, time.Now().UTC(), 10)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{newMessage(2).ID}, idsOf(bunchOfMessage))
+	})
+
+	t.Run("update expire at", func(t *testing.T) {
+		r := newRepository(t)
+		for i := 1; i <= 3; i++ {
+			assert.NoError(t, r.InsertOne(ctx, newMessage(i)))
+		}
+		assert.NoError(t, r.MarkReplayed(ctx, newMessage(2).ID, now(), nil))
+		assert.NoError(t, r.MarkArchived(ctx, []string{newMessage(3).ID}, now()))
+
+		expireAt := now().Add(time.Hour)
+		assert.NoError(t, r.UpdateExpireAt(ctx, newMessage(1).ID, entity.MessageStatusNew, &expireAt))
+		found, err := r.FindByID(ctx, newMessage(1).ID)
+		assert.NoError(t, err)
+		assert.Equal(t, &expireAt, found.ExpireAt)
+
+		// The message that is kept forever has no `expireAt`.
+		assert.NoError(t, r.UpdateExpireAt(ctx, newMessage(1).ID, entity.MessageStatusNew, nil))
+		found, err = r.FindByID(ctx, newMessage(1).ID)
+		assert.NoError(t, err)
+		assert.Nil(t, found.ExpireAt)
+
+		// The message that is replayed or archived meanwhile keeps its expiry.
+		assert.Equal(t, repository.ErrNotFound, r.UpdateExpireAt(ctx, newMessage(2).ID, entity.MessageStatusNew, &expireAt))
+		assert.Equal(t, repository.ErrNotFound, r.UpdateExpireAt(ctx, newMessage(3).ID, entity.MessageStatusNew, &expireAt))
+		assert.Equal(t, repository.ErrNotFound, r.UpdateExpireAt(ctx, "unknown", entity.MessageStatusNew, &expireAt))
+		found, err = r.FindByID(ctx, newMessage(2).ID)
+		assert.NoError(t, err)
+		assert.Nil(t, found.ExpireAt)
+	})
+
+	t.Run("offloaded payload", func(t *testing.T) {
+		r := newRepository(t)
+		message := newMessage(1)
+		message.Message = nil
+		message.MessageRef = "dlq-message/" + message.ID
+		message.MessageChecksum = "sha256:3f2b"
+		message.MessageSize = 20 << 20
+		message.StoredMessageSize = 0
+
+		assert.NoError(t, r.InsertOne(ctx, message))
+
+		found, err := r.FindByID(ctx, message.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, message.MessageRef, found.MessageRef)
+		assert.Equal(t, message.MessageChecksum, found.MessageChecksum)
+		assert.Equal(t, message.MessageSize, found.MessageSize)
+		assert.Empty(t, found.Message)
+	})
+
+	t.Run("find encrypted with other key and update encryption", func(t *testing.T) {
+		r := newRepository(t)
+		for i, keyID := range []string{"2021-10", "2021-11", "", "2021-10", "2021-09"} {
+			message := newMessage(i + 1)
+			if keyID != "" {
+				message.Encryption = &entity.MessageEncryption{KeyID: keyID, DataKey: []byte("wrapped-" + keyID), Headers: []string{"authorization"}}
+			}
+			assert.NoError(t, r.InsertOne(ctx, message))
+		}
+
+		found, err := r.FindByID(ctx, newMessage(1).ID)
+		assert.NoError(t, err)
+		assert.Equal(t, &entity.MessageEncryption{KeyID: "2021-10", DataKey: []byte("wrapped-2021-10"), Headers: []string{"authorization"}}, found.Encryption)
+
+		bunchOfMessage, err := r.FindEncryptedWithOtherKey(ctx, "2021-11", 2)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{newMessage(1).ID, newMessage(4).ID}, idsOf(bunchOfMessage))
+
+		rotated := entity.MessageEncryption{KeyID: "2021-11", DataKey: []byte("rewrapped"), Headers: []string{"authorization"}}
+		for _, ID := range []string{newMessage(1).ID, newMessage(4).ID, newMessage(5).ID} {
+			assert.NoError(t, r.UpdateEncryption(ctx, ID, rotated))
+		}
+
+		found, err = r.FindByID(ctx, newMessage(4).ID)
+		assert.NoError(t, err)
+		assert.Equal(t, &rotated, found.Encryption)
+
+		bunchOfMessage, err = r.FindEncryptedWithOtherKey(ctx, "2021-11", 10)
+		assert.NoError(t, err)
+		assert.Empty(t, bunchOfMessage)
+
+		// The plain messages are not encrypted by the update of their envelope.
+		assert.Equal(t, repository.ErrNotFound, r.UpdateEncryption(ctx, newMessage(3).ID, rotated))
+		assert.Equal(t, repository.ErrNotFound, r.UpdateEncryption(ctx, "unknown", rotated))
+	})
+
+	t.Run("storage stats", func(t *testing.T) {
+		r := newRepository(t)
+
+		stats, err := r.StorageStats(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, entity.StorageStats{}, stats)
+
+		compressed := newMessage(2)
+		compressed.MessageCodec = entity.MessageCodecGzip
+		compressed.MessageSize = 400
+		compressed.StoredMessageSize = 100
+		assert.NoError(t, r.InsertOne(ctx, newMessage(1)))
+		assert.NoError(t, r.InsertOne(ctx, compressed))
+
+		stats, err = r.StorageStats(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, entity.StorageStats{
+			Messages:           2,
+			CompressedMessages: 1,
+			MessageSize:        421,
+			StoredMessageSize:  121,
+			SavedSize:          300,
+			SavingRatio:        300.0 / 421.0,
+		}, stats)
+	})
+
+	t.Run("ensure retention index", func(t *testing.T) {
+		r := newRepository(t)
+
+		assert.NoError(t, r.EnsureRetentionIndex(ctx, time.Hour))
+		assert.NoError(t, r.EnsureRetentionIndex(ctx, time.Hour*2))
+	})
+}
+
+// TestSubscriptionRepository runs the conformance suite against the SubscriptionRepository, every subtest gets an empty repository.
+func TestSubscriptionRepository(t *testing.T, newRepository func(t *testing.T) repository.SubscriptionRepository) {
+	ctx := context.TODO()
+
+	t.Run("upsert and find by id", func(t *testing.T) {
+		r := newRepository(t)
+		subscription := entity.Subscription{ID: "dlq-service", Topics: []string{"dead-letter-queue"}, UpdatedAt: "2021-01-01T00:00:00Z"}
+
+		assert.NoError(t, r.Upsert(ctx, subscription))
+		found, err := r.FindByID(ctx, subscription.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, subscription, found)
+
+		subscription.Topics = append(subscription.Topics, "another-dead-letter-queue")
+		assert.NoError(t, r.Upsert(ctx, subscription))
+		found, err = r.FindByID(ctx, subscription.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, subscription, found)
+	})
+
+	t.Run("find by unknown id", func(t *testing.T) {
+		r := newRepository(t)
+
+		_, err := r.FindByID(ctx, "unknown")
+		assert.Equal(t, repository.ErrNotFound, err)
+	})
+}
+
+// now is truncated to the precision of the mongodb dates.
+func now() time.Time {
+	return time.Date(2021, 10, 1, 12, 0, 0, 0, time.UTC)
+}
+
+// newMessage returns the same message for the same sequence, the sequence is its DLQ offset.
+func newMessage(sequence int) entity.Message {
+	producedDate := now().Add(-time.Minute)
+
+	return entity.Message{
+		ID:                fmt.Sprintf("message-%d", sequence),
+		Channel:           "order-created",
+		Publisher:         "order-service",
+		Consumer:          "payment-service",
+		Key:               []byte("order-1"),
+		Headers:           entity.MessageHeaders{{Key: "content-type", Value: []byte("application/json")}},
+		Message:           []byte(`{"orderId":"order-1"}`),
+		MessageSize:       21,
+		StoredMessageSize: 21,
+		ContentType:       "application/json",
+		SchemaVersion:     3,
+		CausedBy:          "payment is declined",
+		FailedConsumeDate: now(),
+		Partition:         1,
+		Offset:            int64(sequence) * 10,
+		ProducedDate:      &producedDate,
+		ConsumerGroup:     "payment-service",
+		InstanceID:        "payment-service-1",
+		Attempt:           1,
+		DLQTopic:          "dead-letter-queue",
+		DLQPartition:      0,
+		DLQOffset:         int64(sequence),
+		IngestedAt:        now(),
+		UpdatedAt:         now(),
+		Status:            entity.MessageStatusNew,
+	}
+}
+
+func idsOf(bunchOfMessage []entity.Message) (IDs []string) {
+	for _, message := range bunchOfMessage {
+		IDs = append(IDs, message.ID)
+	}
+
+	return
+}
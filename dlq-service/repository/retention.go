@@ -0,0 +1,31 @@
+package repository
+
+import "time"
+
+// retentionPurgeInterval is how often the backends other than mongodb remove the archived messages,
+// it is the period of the mongodb TTL monitor.
+const retentionPurgeInterval = time.Minute
+
+// retention removes the messages once the grace is over after their `archivedAt` like the mongodb TTL index does,
+// the archived messages are removed at most once per retentionPurgeInterval.
+type retention struct {
+	enabled  bool
+	grace    time.Duration
+	purgedAt time.Time
+}
+
+func (r *retention) enable(grace time.Duration) {
+	r.enabled = true
+	r.grace = grace
+	r.purgedAt = time.Time{}
+}
+
+// due returns the deadline of `archivedAt` when a purge is due.
+func (r *retention) due(now time.Time) (deadline time.Time, ok bool) {
+	if !r.enabled || now.Sub(r.purgedAt) < retentionPurgeInterval {
+		return
+	}
+	r.purgedAt = now
+
+	return now.Add(-r.grace), true
+}
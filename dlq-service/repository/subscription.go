@@ -0,0 +1,70 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/entity"
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/mongodb"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type SubscriptionRepository interface {
+	FindByID(ctx context.Context, ID string) (subscription entity.Subscription, err error)
+	Upsert(ctx context.Context, subscription entity.Subscription) (err error)
+}
+
+type subscriptionRepository struct {
+	logger     *logrus.Logger
+	collection string
+	db         mongodb.Database
+}
+
+func NewSubscriptionRepository(logger *logrus.Logger, db mongodb.Database) SubscriptionRepository {
+	return &subscriptionRepository{
+		logger:     logger,
+		collection: SubscriptionCollection,
+		db:         db,
+	}
+}
+
+func (r *subscriptionRepository) FindByID(ctx context.Context, ID string) (subscription entity.Subscription, err error) {
+
+	filter := bson.M{
+		"id": ID,
+	}
+	options := options.FindOne()
+
+	result := r.db.Collection(r.collection).FindOne(ctx, filter, options)
+
+	if err = result.Decode(&subscription); err != nil {
+		if err == mongo.ErrNoDocuments {
+			err = ErrNotFound
+			return
+		}
+		r.logger.Error(err)
+		return
+	}
+
+	return
+}
+
+func (r *subscriptionRepository) Upsert(ctx context.Context, subscription entity.Subscription) (err error) {
+
+	filter := bson.M{
+		"id": subscription.ID,
+	}
+	update := bson.M{
+		"$set": subscription,
+	}
+	options := options.Update().SetUpsert(true)
+
+	if _, err = r.db.Collection(r.collection).UpdateOne(ctx, filter, update, options); err != nil {
+		r.logger.Error(err)
+		return
+	}
+
+	return
+}
@@ -0,0 +1,41 @@
+package schemaregistry
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+type fileRegistry struct {
+	dir string
+}
+
+// NewFileRegistry is a constructor of the local registry which reads the schema of ID from `<dir>/<ID>.json`.
+// The file has the same shape as the response of `GET /schemas/ids/{id}` of the confluent schema registry.
+func NewFileRegistry(dir string) Registry {
+	return &fileRegistry{
+		dir: dir,
+	}
+}
+
+func (r *fileRegistry) GetSchemaByID(ctx context.Context, ID int) (schema Schema, err error) {
+	content, err := ioutil.ReadFile(filepath.Join(r.dir, strconv.Itoa(ID)+".json"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = ErrSchemaNotFound
+		}
+		return
+	}
+
+	if err = json.Unmarshal(content, &schema); err != nil {
+		return
+	}
+
+	schema.ID = ID
+	schema = normalizeSchema(schema)
+
+	return
+}
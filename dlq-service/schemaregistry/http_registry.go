@@ -0,0 +1,73 @@
+package schemaregistry
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+type httpRegistry struct {
+	baseURL    string
+	httpClient *http.Client
+	mu         sync.RWMutex
+	schemas    map[int]Schema
+}
+
+// NewHTTPRegistry is a constructor of the confluent schema registry client, the schemas are immutable so they are cached by their ID.
+func NewHTTPRegistry(baseURL string, httpClient *http.Client) Registry {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	return &httpRegistry{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		httpClient: httpClient,
+		schemas:    make(map[int]Schema),
+	}
+}
+
+func (r *httpRegistry) GetSchemaByID(ctx context.Context, ID int) (schema Schema, err error) {
+	r.mu.RLock()
+	schema, ok := r.schemas[ID]
+	r.mu.RUnlock()
+	if ok {
+		return
+	}
+
+	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/schemas/ids/%d", r.baseURL, ID), nil)
+	if err != nil {
+		return
+	}
+	req.Header.Set("Accept", "application/vnd.schemaregistry.v1+json")
+
+	res, err := r.httpClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusNotFound {
+		err = ErrSchemaNotFound
+		return
+	}
+	if res.StatusCode != http.StatusOK {
+		err = fmt.Errorf("schemaregistry: unexpected status %d for schema %d", res.StatusCode, ID)
+		return
+	}
+
+	if err = json.NewDecoder(res.Body).Decode(&schema); err != nil {
+		return
+	}
+
+	schema.ID = ID
+	schema = normalizeSchema(schema)
+
+	r.mu.Lock()
+	r.schemas[ID] = schema
+	r.mu.Unlock()
+
+	return
+}
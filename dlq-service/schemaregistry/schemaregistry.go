@@ -0,0 +1,74 @@
+package schemaregistry
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+)
+
+const (
+	// MagicByte is the first byte of the payloads that are serialized in the confluent wire format.
+	MagicByte byte = 0
+
+	// SchemaTypeAvro is the type of the avro schemas, the registry omits the type for them.
+	SchemaTypeAvro = "AVRO"
+	// SchemaTypeProtobuf is the type of the protobuf schemas.
+	SchemaTypeProtobuf = "PROTOBUF"
+
+	wireFormatHeaderSize = 5
+)
+
+var (
+	// ErrNotWireFormat is returned when the payload is not serialized in the confluent wire format.
+	ErrNotWireFormat = errors.New("schemaregistry: payload is not in the confluent wire format")
+	// ErrSchemaNotFound is returned when the registry does not have the schema.
+	ErrSchemaNotFound = errors.New("schemaregistry: schema is not found")
+	// ErrUnsupportedSchemaType is returned when the schema is neither avro nor protobuf.
+	ErrUnsupportedSchemaType = errors.New("schemaregistry: schema type is not supported")
+)
+
+// Schema is a schema which is registered in the registry.
+type Schema struct {
+	ID         int    `json:"id"`
+	SchemaType string `json:"schemaType"`
+	Schema     string `json:"schema"`
+}
+
+// Registry is a client of the schema registry.
+type Registry interface {
+	GetSchemaByID(ctx context.Context, ID int) (schema Schema, err error)
+}
+
+// IsWireFormat reports whether the payload starts with the magic byte and a schema ID.
+func IsWireFormat(payload []byte) bool {
+	return len(payload) >= wireFormatHeaderSize && payload[0] == MagicByte
+}
+
+// SchemaIDOf returns the schema ID of the payload and the rest of the payload after the ID.
+func SchemaIDOf(payload []byte) (ID int, body []byte, err error) {
+	if !IsWireFormat(payload) {
+		err = ErrNotWireFormat
+		return
+	}
+
+	ID = int(binary.BigEndian.Uint32(payload[1:wireFormatHeaderSize]))
+	body = payload[wireFormatHeaderSize:]
+
+	return
+}
+
+func wireFormatHeader(ID int) (header []byte) {
+	header = make([]byte, wireFormatHeaderSize)
+	header[0] = MagicByte
+	binary.BigEndian.PutUint32(header[1:], uint32(ID))
+
+	return
+}
+
+func normalizeSchema(schema Schema) Schema {
+	if schema.SchemaType == "" {
+		schema.SchemaType = SchemaTypeAvro
+	}
+
+	return schema
+}
@@ -0,0 +1,256 @@
+package schemaregistry
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/desc/protoparse"
+	"github.com/jhump/protoreflect/dynamic"
+	"github.com/linkedin/goavro/v2"
+)
+
+// Decoded is a payload which is decoded into JSON by its schema.
+type Decoded struct {
+	SchemaID   int             `json:"schemaId"`
+	SchemaType string          `json:"schemaType"`
+	Message    json.RawMessage `json:"message"`
+}
+
+// Serde decodes the payloads which are serialized in the confluent wire format and encodes them back.
+type Serde interface {
+	// Decode renders the payload as JSON, avro payloads are rendered in the avro JSON encoding.
+	Decode(ctx context.Context, payload []byte) (decoded Decoded, err error)
+	// Encode serializes the JSON message with the same schema (and protobuf message type) of the original payload.
+	Encode(ctx context.Context, original []byte, message json.RawMessage) (payload []byte, err error)
+}
+
+type codec interface {
+	decode(body []byte) (message json.RawMessage, err error)
+	encode(original []byte, message json.RawMessage) (body []byte, err error)
+}
+
+type serde struct {
+	registry Registry
+	mu       sync.Mutex
+	codecs   map[int]codec
+}
+
+// NewSerde is a constructor.
+func NewSerde(registry Registry) Serde {
+	return &serde{
+		registry: registry,
+		codecs:   make(map[int]codec),
+	}
+}
+
+func (s *serde) Decode(ctx context.Context, payload []byte) (decoded Decoded, err error) {
+	ID, body, err := SchemaIDOf(payload)
+	if err != nil {
+		return
+	}
+
+	c, schemaType, err := s.codecOf(ctx, ID)
+	if err != nil {
+		return
+	}
+
+	message, err := c.decode(body)
+	if err != nil {
+		return
+	}
+
+	decoded = Decoded{
+		SchemaID:   ID,
+		SchemaType: schemaType,
+		Message:    message,
+	}
+
+	return
+}
+
+func (s *serde) Encode(ctx context.Context, original []byte, message json.RawMessage) (payload []byte, err error) {
+	ID, body, err := SchemaIDOf(original)
+	if err != nil {
+		return
+	}
+
+	c, _, err := s.codecOf(ctx, ID)
+	if err != nil {
+		return
+	}
+
+	encoded, err := c.encode(body, message)
+	if err != nil {
+		return
+	}
+
+	payload = append(wireFormatHeader(ID), encoded...)
+
+	return
+}
+
+func (s *serde) codecOf(ctx context.Context, ID int) (c codec, schemaType string, err error) {
+	schema, err := s.registry.GetSchemaByID(ctx, ID)
+	if err != nil {
+		return
+	}
+	schemaType = schema.SchemaType
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if c = s.codecs[ID]; c != nil {
+		return
+	}
+
+	switch schemaType {
+	case SchemaTypeAvro:
+		c, err = newAvroCodec(schema)
+	case SchemaTypeProtobuf:
+		c, err = newProtobufCodec(schema)
+	default:
+		err = ErrUnsupportedSchemaType
+	}
+	if err != nil {
+		return
+	}
+
+	s.codecs[ID] = c
+
+	return
+}
+
+type avroCodec struct {
+	codec *goavro.Codec
+}
+
+func newAvroCodec(schema Schema) (c codec, err error) {
+	avro, err := goavro.NewCodec(schema.Schema)
+	if err != nil {
+		return
+	}
+
+	c = &avroCodec{codec: avro}
+
+	return
+}
+
+func (c *avroCodec) decode(body []byte) (message json.RawMessage, err error) {
+	native, _, err := c.codec.NativeFromBinary(body)
+	if err != nil {
+		return
+	}
+
+	return c.codec.TextualFromNative(nil, native)
+}
+
+func (c *avroCodec) encode(original []byte, message json.RawMessage) (body []byte, err error) {
+	native, _, err := c.codec.NativeFromTextual(message)
+	if err != nil {
+		return
+	}
+
+	return c.codec.BinaryFromNative(nil, native)
+}
+
+// protobufCodec resolves the message type by the message indexes which follow the schema ID,
+// the imports of the schema are resolved only for the well-known types.
+type protobufCodec struct {
+	file *desc.FileDescriptor
+}
+
+func newProtobufCodec(schema Schema) (c codec, err error) {
+	filename := fmt.Sprintf("%d.proto", schema.ID)
+	parser := protoparse.Parser{
+		Accessor: protoparse.FileContentsFromMap(map[string]string{filename: schema.Schema}),
+	}
+
+	files, err := parser.ParseFiles(filename)
+	if err != nil {
+		return
+	}
+
+	c = &protobufCodec{file: files[0]}
+
+	return
+}
+
+func (c *protobufCodec) decode(body []byte) (message json.RawMessage, err error) {
+	descriptor, body, err := c.messageOf(body)
+	if err != nil {
+		return
+	}
+
+	msg := dynamic.NewMessage(descriptor)
+	if err = msg.Unmarshal(body); err != nil {
+		return
+	}
+
+	return msg.MarshalJSON()
+}
+
+func (c *protobufCodec) encode(original []byte, message json.RawMessage) (body []byte, err error) {
+	descriptor, rest, err := c.messageOf(original)
+	if err != nil {
+		return
+	}
+
+	msg := dynamic.NewMessage(descriptor)
+	if err = msg.UnmarshalJSON(message); err != nil {
+		return
+	}
+
+	encoded, err := msg.Marshal()
+	if err != nil {
+		return
+	}
+
+	indexes := original[:len(original)-len(rest)]
+	body = append(append([]byte{}, indexes...), encoded...)
+
+	return
+}
+
+// messageOf reads the zigzag varint encoded message indexes, a single zero stands for the first message of the file.
+func (c *protobufCodec) messageOf(body []byte) (descriptor *desc.MessageDescriptor, rest []byte, err error) {
+	reader := bytes.NewReader(body)
+
+	count, err := binary.ReadVarint(reader)
+	if err != nil {
+		return
+	}
+	if count < 0 {
+		err = fmt.Errorf("schemaregistry: message index count %d is negative", count)
+		return
+	}
+
+	indexes := []int64{0}
+	if count > 0 {
+		indexes = make([]int64, count)
+		for i := range indexes {
+			if indexes[i], err = binary.ReadVarint(reader); err != nil {
+				return
+			}
+		}
+	}
+
+	messageTypes := c.file.GetMessageTypes()
+	for _, index := range indexes {
+		if index < 0 || int(index) >= len(messageTypes) {
+			err = fmt.Errorf("schemaregistry: message index %d is out of range", index)
+			return
+		}
+
+		descriptor = messageTypes[index]
+		messageTypes = descriptor.GetNestedMessageTypes()
+	}
+
+	rest = body[len(body)-reader.Len():]
+
+	return
+}
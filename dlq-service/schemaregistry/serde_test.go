@@ -0,0 +1,101 @@
+package schemaregistry_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/schemaregistry"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSerde_Avro(t *testing.T) {
+	serde := schemaregistry.NewSerde(schemaregistry.NewFileRegistry("testdata"))
+
+	payload := []byte{0x00, 0x00, 0x00, 0x00, 0x01, 0x06, 'b', 'o', 'b', 0x3c}
+
+	decoded, err := serde.Decode(context.TODO(), payload)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, decoded.SchemaID)
+	assert.Equal(t, schemaregistry.SchemaTypeAvro, decoded.SchemaType)
+	assert.JSONEq(t, `{"name":"bob","age":30}`, string(decoded.Message))
+
+	encoded, err := serde.Encode(context.TODO(), payload, json.RawMessage(`{"name":"bob","age":31}`))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x00, 0x00, 0x00, 0x00, 0x01, 0x06, 'b', 'o', 'b', 0x3e}, encoded)
+}
+
+func TestSerde_Protobuf(t *testing.T) {
+	serde := schemaregistry.NewSerde(schemaregistry.NewFileRegistry("testdata"))
+
+	t.Run("first message", func(t *testing.T) {
+		payload := []byte{0x00, 0x00, 0x00, 0x00, 0x02, 0x00, 0x0a, 0x03, 'o', '-', '1', 0x10, 0x2a}
+
+		decoded, err := serde.Decode(context.TODO(), payload)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, decoded.SchemaID)
+		assert.Equal(t, schemaregistry.SchemaTypeProtobuf, decoded.SchemaType)
+		assert.JSONEq(t, `{"id":"o-1","amount":42}`, string(decoded.Message))
+
+		encoded, err := serde.Encode(context.TODO(), payload, json.RawMessage(`{"id":"o-1","amount":43}`))
+		assert.NoError(t, err)
+		assert.Equal(t, []byte{0x00, 0x00, 0x00, 0x00, 0x02, 0x00, 0x0a, 0x03, 'o', '-', '1', 0x10, 0x2b}, encoded)
+	})
+
+	t.Run("nested message", func(t *testing.T) {
+		payload := []byte{0x00, 0x00, 0x00, 0x00, 0x02, 0x04, 0x00, 0x00, 0x0a, 0x01, 'a'}
+
+		decoded, err := serde.Decode(context.TODO(), payload)
+		assert.NoError(t, err)
+		assert.JSONEq(t, `{"sku":"a"}`, string(decoded.Message))
+
+		encoded, err := serde.Encode(context.TODO(), payload, json.RawMessage(`{"sku":"b"}`))
+		assert.NoError(t, err)
+		assert.Equal(t, []byte{0x00, 0x00, 0x00, 0x00, 0x02, 0x04, 0x00, 0x00, 0x0a, 0x01, 'b'}, encoded)
+	})
+}
+
+func TestSerde_Errors(t *testing.T) {
+	serde := schemaregistry.NewSerde(schemaregistry.NewFileRegistry("testdata"))
+
+	_, err := serde.Decode(context.TODO(), []byte(`{"plain":"json"}`))
+	assert.Equal(t, schemaregistry.ErrNotWireFormat, err)
+
+	_, err = serde.Decode(context.TODO(), []byte{0x00, 0x00, 0x00, 0x00, 0x63, 0x00})
+	assert.Equal(t, schemaregistry.ErrSchemaNotFound, err)
+}
+
+func TestSerde_Protobuf_MalformedMessageIndexes(t *testing.T) {
+	serde := schemaregistry.NewSerde(schemaregistry.NewFileRegistry("testdata"))
+
+	testCases := []struct {
+		name           string
+		messageIndexes []byte
+	}{
+		{
+			name:           "negative count",
+			messageIndexes: []byte{0x01},
+		},
+		{
+			name:           "out of range index",
+			messageIndexes: []byte{0x02, 0x0a},
+		},
+		{
+			name:           "negative index",
+			messageIndexes: []byte{0x02, 0x01},
+		},
+		{
+			name:           "truncated index",
+			messageIndexes: []byte{0x04, 0x00, 0x80},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			payload := append([]byte{0x00, 0x00, 0x00, 0x00, 0x02}, tc.messageIndexes...)
+
+			_, err := serde.Decode(context.TODO(), payload)
+			assert.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	_ "github.com/lib/pq" // postgres driver
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/migrations"
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/mongodb"
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/repository"
+	"github.com/sirupsen/logrus"
+	bolt "go.etcd.io/bbolt"
+	"go.mongodb.org/mongo-driver/event"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// The storage backends of `STORAGE_BACKEND`.
+const (
+	storageBackendMongoDB  = "mongodb"
+	storageBackendMemory   = "memory"
+	storageBackendBolt     = "bolt"
+	storageBackendPostgres = "postgres"
+)
+
+// storageConfig is the configuration of the storage backend.
+type storageConfig struct {
+	ServiceName     string
+	Backend         string
+	MongoDBURL      string
+	MongoDBDatabase string
+	CommandMonitor  *event.CommandMonitor
+	BoltPath        string
+	PostgresURL     string
+	// RetentionGrace is how long the archived messages are kept before they are removed.
+	RetentionGrace time.Duration
+}
+
+// storage is the repositories of the configured backend, the mongodb and the postgres backends are migrated once they are connected.
+// The retention of the messages is set up along with the migrations.
+type storage struct {
+	DLQRepository          repository.DLQRepository
+	SubscriptionRepository repository.SubscriptionRepository
+	Close                  func(ctx context.Context) error
+}
+
+func newStorage(logger *logrus.Logger, config storageConfig) (s storage, err error) {
+	switch config.Backend {
+	case "", storageBackendMongoDB:
+		s, err = newMongoDBStorage(logger, config)
+	case storageBackendMemory:
+		s = storage{
+			DLQRepository:          repository.NewMemoryDLQRepository(),
+			SubscriptionRepository: repository.NewMemorySubscriptionRepository(),
+			Close:                  func(ctx context.Context) error { return nil },
+		}
+		err = s.DLQRepository.EnsureRetentionIndex(context.Background(), config.RetentionGrace)
+	case storageBackendBolt:
+		s, err = newBoltStorage(logger, config)
+	case storageBackendPostgres:
+		s, err = newPostgresStorage(logger, config)
+	default:
+		err = fmt.Errorf("unknown storage backend %q", config.Backend)
+	}
+
+	return
+}
+
+func newMongoDBStorage(logger *logrus.Logger, config storageConfig) (s storage, err error) {
+	mongodbClient, err := mongo.NewClient(
+		options.Client().
+			SetAppName(config.ServiceName).
+			ApplyURI(config.MongoDBURL).
+			SetConnectTimeout(time.Second * 10).
+			SetMonitor(config.CommandMonitor),
+	)
+	if err != nil {
+		return
+	}
+
+	dbClient := mongodb.NewClientAdapter(mongodbClient)
+	if err = dbClient.Connect(context.Background()); err != nil {
+		return
+	}
+
+	db := dbClient.Database(config.MongoDBDatabase)
+
+	dlqRepository := repository.NewDLQRepository(logger, db)
+
+	// The retention index is dropped and created again when its options are changed, so it is done under the migration lock.
+	migrator := migrations.NewMigrator(logger, db, &migrations.MigratorConfig{
+		LockTTL:          time.Minute * 5,
+		LockPollInterval: time.Second,
+		Repeatables: []func(ctx context.Context, db mongodb.Database) (err error){
+			func(ctx context.Context, db mongodb.Database) (err error) {
+				return dlqRepository.EnsureRetentionIndex(ctx, config.RetentionGrace)
+			},
+		},
+	}, migrations.DLQMigrations())
+	applied, err := migrator.Migrate(context.Background())
+	if err != nil {
+		dbClient.Disconnect(context.Background())
+		return
+	}
+	logger.Infof("migrations are applied: %v", applied)
+
+	s = storage{
+		DLQRepository:          dlqRepository,
+		SubscriptionRepository: repository.NewSubscriptionRepository(logger, db),
+		Close:                  dbClient.Disconnect,
+	}
+
+	return
+}
+
+func newBoltStorage(logger *logrus.Logger, config storageConfig) (s storage, err error) {
+	db, err := bolt.Open(config.BoltPath, 0600, &bolt.Options{Timeout: time.Second * 10})
+	if err != nil {
+		return
+	}
+
+	dlqRepository, err := repository.NewBoltDLQRepository(logger, db)
+	if err != nil {
+		db.Close()
+		return
+	}
+	if err = dlqRepository.EnsureRetentionIndex(context.Background(), config.RetentionGrace); err != nil {
+		db.Close()
+		return
+	}
+	subscriptionRepository, err := repository.NewBoltSubscriptionRepository(logger, db)
+	if err != nil {
+		db.Close()
+		return
+	}
+
+	s = storage{
+		DLQRepository:          dlqRepository,
+		SubscriptionRepository: subscriptionRepository,
+		Close: func(ctx context.Context) error {
+			return db.Close()
+		},
+	}
+
+	return
+}
+
+func newPostgresStorage(logger *logrus.Logger, config storageConfig) (s storage, err error) {
+	db, err := sql.Open("postgres", config.PostgresURL)
+	if err != nil {
+		return
+	}
+	if err = db.PingContext(context.Background()); err != nil {
+		db.Close()
+		return
+	}
+
+	migrator := migrations.NewPostgresMigrator(logger, db, migrations.PostgresMigrations())
+	applied, err := migrator.Migrate(context.Background())
+	if err != nil {
+		db.Close()
+		return
+	}
+	logger.Infof("migrations are applied: %v", applied)
+
+	dlqRepository := repository.NewPostgresDLQRepository(logger, db)
+	if err = dlqRepository.EnsureRetentionIndex(context.Background(), config.RetentionGrace); err != nil {
+		db.Close()
+		return
+	}
+
+	s = storage{
+		DLQRepository:          dlqRepository,
+		SubscriptionRepository: repository.NewPostgresSubscriptionRepository(logger, db),
+		Close: func(ctx context.Context) error {
+			return db.Close()
+		},
+	}
+
+	return
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/gorilla/mux"
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/eventbus"
+	"github.com/sirupsen/logrus"
+	"go.elastic.co/apm"
+	"go.elastic.co/apm/module/apmgorilla"
+	"go.elastic.co/apm/module/apmlogrus"
+	"go.elastic.co/apm/module/apmmongo"
+	"go.mongodb.org/mongo-driver/event"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gorilla/mux/otelmux"
+	"go.opentelemetry.io/contrib/instrumentation/go.mongodb.org/mongo-driver/mongo/otelmongo"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdoutmetric"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/global"
+	"go.opentelemetry.io/otel/propagation"
+	exportmetric "go.opentelemetry.io/otel/sdk/export/metric"
+	controller "go.opentelemetry.io/otel/sdk/metric/controller/basic"
+	processor "go.opentelemetry.io/otel/sdk/metric/processor/basic"
+	"go.opentelemetry.io/otel/sdk/metric/selector/simple"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+)
+
+// The tracing backends of `TRACING_BACKEND`.
+const (
+	tracingBackendAPM           = "apm"
+	tracingBackendOpenTelemetry = "otel"
+	tracingBackendNone          = "none"
+)
+
+// tracingConfig is the configuration of the tracing backend.
+// The OTLP exporter reads its endpoint and options from the standard `OTEL_EXPORTER_OTLP_*` variables.
+type tracingConfig struct {
+	ServiceName  string
+	Backend      string
+	Exporter     string
+	ExporterFile string
+}
+
+// tracing instruments the consumer, the producer, mongodb and the HTTP router with the same backend.
+// The metrics of the event handlers and the breakers are exported by the opentelemetry backend only,
+// the meter of the other backends records nothing.
+type tracing struct {
+	Tracer         eventbus.Tracer
+	Meter          metric.Meter
+	CommandMonitor *event.CommandMonitor
+	Instrument     func(router *mux.Router)
+	Shutdown       func(ctx context.Context) error
+}
+
+func newTracing(logger *logrus.Logger, config tracingConfig) (t tracing, err error) {
+	switch config.Backend {
+	case "", tracingBackendAPM:
+		logger.AddHook(&apmlogrus.Hook{
+			LogLevels: logrus.AllLevels,
+		})
+
+		t = tracing{
+			Tracer:         eventbus.NewElasticAPMTracer(apm.DefaultTracer),
+			CommandMonitor: apmmongo.CommandMonitor(),
+			Instrument: func(router *mux.Router) {
+				apmgorilla.Instrument(router)
+			},
+			Shutdown: func(ctx context.Context) error {
+				apm.DefaultTracer.Flush(ctx.Done())
+				return nil
+			},
+		}
+	case tracingBackendOpenTelemetry:
+		t, err = newOpenTelemetryTracing(config)
+	case tracingBackendNone:
+		t = tracing{
+			Tracer:     eventbus.NewNoopTracer(),
+			Instrument: func(router *mux.Router) {},
+			Shutdown:   func(ctx context.Context) error { return nil },
+		}
+	default:
+		err = fmt.Errorf("unknown tracing backend %q", config.Backend)
+	}
+
+	return
+}
+
+func newOpenTelemetryTracing(config tracingConfig) (t tracing, err error) {
+	exporter, metricExporter, shutdownMetricExporter, err := newOpenTelemetryExporters(config)
+	if err != nil {
+		return
+	}
+
+	serviceResource := resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceNameKey.String(config.ServiceName))
+	tracerProvider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(serviceResource),
+	)
+	propagator := propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+
+	// The meter provider collects the metrics and pushes them to the exporter every collect period.
+	meterProvider := controller.New(
+		processor.NewFactory(simple.NewWithInexpensiveDistribution(), metricExporter),
+		controller.WithExporter(metricExporter),
+		controller.WithResource(serviceResource),
+	)
+	if err = meterProvider.Start(context.Background()); err != nil {
+		return
+	}
+
+	otel.SetTracerProvider(tracerProvider)
+	otel.SetTextMapPropagator(propagator)
+	global.SetMeterProvider(meterProvider)
+
+	t = tracing{
+		Tracer:         eventbus.NewOpenTelemetryTracer(tracerProvider.Tracer(config.ServiceName)),
+		Meter:          meterProvider.Meter(config.ServiceName),
+		CommandMonitor: otelmongo.NewMonitor(otelmongo.WithTracerProvider(tracerProvider)),
+		Instrument: func(router *mux.Router) {
+			router.Use(otelmux.Middleware(config.ServiceName, otelmux.WithTracerProvider(tracerProvider), otelmux.WithPropagators(propagator)))
+		},
+		Shutdown: func(ctx context.Context) (err error) {
+			// The last collection is exported before the exporter is shut down.
+			if err = meterProvider.Stop(ctx); err != nil {
+				return
+			}
+			if err = shutdownMetricExporter(ctx); err != nil {
+				return
+			}
+
+			return tracerProvider.Shutdown(ctx)
+		},
+	}
+
+	return
+}
+
+// newOpenTelemetryExporters returns the span and the metric exporters of `OTEL_EXPORTER`,
+// the file exporter writes both to the same file.
+func newOpenTelemetryExporters(config tracingConfig) (exporter sdktrace.SpanExporter, metricExporter exportmetric.Exporter,
+	shutdownMetricExporter func(ctx context.Context) error, err error) {
+	shutdownMetricExporter = func(ctx context.Context) error { return nil }
+
+	var writer io.Writer
+	switch config.Exporter {
+	case "", "otlp":
+		if exporter, err = otlptracegrpc.New(context.Background()); err != nil {
+			return
+		}
+		var otlpMetricExporter *otlpmetric.Exporter
+		if otlpMetricExporter, err = otlpmetricgrpc.New(context.Background()); err != nil {
+			return
+		}
+		metricExporter, shutdownMetricExporter = otlpMetricExporter, otlpMetricExporter.Shutdown
+
+		return
+	case "stdout":
+		writer = os.Stdout
+	case "file":
+		if writer, err = os.OpenFile(config.ExporterFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644); err != nil {
+			return
+		}
+	default:
+		err = fmt.Errorf("unknown opentelemetry exporter %q", config.Exporter)
+		return
+	}
+
+	if exporter, err = stdouttrace.New(stdouttrace.WithWriter(writer)); err != nil {
+		return
+	}
+	metricExporter, err = stdoutmetric.New(stdoutmetric.WithWriter(writer))
+
+	return
+}
@@ -0,0 +1,268 @@
+package usecase
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/blobstore"
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/entity"
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/repository"
+	"github.com/sirupsen/logrus"
+)
+
+// DLQArchiverConfig is a configuration of the archiver.
+type DLQArchiverConfig struct {
+	// Dir is the local directory of the gzip compressed NDJSON archives.
+	Dir string
+	// Interval is how often the expired messages are archived, the storage removes them once the grace is over after their archive.
+	// A batch is claimed for an interval, the batch of a replica that stops is archived by another once its claim is over.
+	Interval  time.Duration
+	BatchSize int64
+	// Store is the blob store of the offloaded payloads, nil when the payloads are not offloaded.
+	Store blobstore.Store
+	// Retention is the current retention policy, the expiry of the stored messages is reconciled with it when the archiver is run.
+	Retention RetentionPolicy
+}
+
+// DLQArchiver exports the expired messages, the storage only removes the messages that are archived.
+// The offloaded payloads are written into the archive and removed from the blob store.
+type DLQArchiver interface {
+	// Run reconciles the expiry of the stored messages once, then archives the expired messages every interval until the context is done.
+	Run(ctx context.Context)
+	Archive(ctx context.Context) (archived int, err error)
+	// ReconcileExpiry sets the expiry of the messages that are not archived by the current retention policy,
+	// the messages that are stored before the policy is changed would expire by the policy they are stored with otherwise.
+	ReconcileExpiry(ctx context.Context) (updated int, err error)
+}
+
+type dlqArchiver struct {
+	logger     *logrus.Logger
+	repository repository.DLQRepository
+	config     *DLQArchiverConfig
+}
+
+// NewDLQArchiver is a constructor.
+func NewDLQArchiver(logger *logrus.Logger, repository repository.DLQRepository, config *DLQArchiverConfig) DLQArchiver {
+	return &dlqArchiver{
+		logger:     logger,
+		repository: repository,
+		config:     config,
+	}
+}
+
+func (a *dlqArchiver) Run(ctx context.Context) {
+	updated, err := a.ReconcileExpiry(ctx)
+	if err != nil {
+		a.logger.Errorf("[DLQArchiver] Expiry of the messages is failed to be reconciled | %s", err.Error())
+	} else if updated > 0 {
+		a.logger.Infof("[DLQArchiver] Expiry of %d messages is reconciled with the retention policy", updated)
+	}
+
+	ticker := time.NewTicker(a.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		archived, err := a.Archive(ctx)
+		if err != nil {
+			a.logger.Errorf("[DLQArchiver] Messages are failed to be archived | %s", err.Error())
+		} else if archived > 0 {
+			a.logger.Infof("[DLQArchiver] %d messages are archived", archived)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Archive writes every batch of the expired messages to its own file, the messages are marked as archived once the file is closed.
+// The batch is claimed first so that the replicas do not archive the same messages.
+func (a *dlqArchiver) Archive(ctx context.Context) (archived int, err error) {
+	now := time.Now().UTC()
+
+	for {
+		expired, err := a.repository.FindExpired(ctx, now, a.config.BatchSize)
+		if err != nil || len(expired) < 1 {
+			return archived, err
+		}
+		if expired, err = a.claim(ctx, expired); err != nil {
+			return archived, err
+		}
+		if len(expired) < 1 {
+			// The batch is claimed by another replica, it is not found again.
+			continue
+		}
+		bunchOfMessage, err := a.inlinePayloads(ctx, expired)
+		if err != nil {
+			return archived, err
+		}
+
+		filename := filepath.Join(a.config.Dir, fmt.Sprintf("dlq-archive-%s-%d.ndjson.gz", now.Format("20060102T150405Z"), archived))
+		if err = writeArchive(filename, bunchOfMessage); err != nil {
+			return archived, err
+		}
+
+		IDs := make([]string, len(bunchOfMessage))
+		for i, message := range bunchOfMessage {
+			IDs[i] = message.ID
+		}
+		if err = a.repository.MarkArchived(ctx, IDs, time.Now().UTC()); err != nil {
+			return archived, err
+		}
+		a.removePayloads(ctx, expired)
+
+		archived += len(bunchOfMessage)
+	}
+}
+
+// claim returns the expired messages that are claimed until the next run, the ones that are claimed by another replica are left out.
+func (a *dlqArchiver) claim(ctx context.Context, expired []entity.Message) (claimed []entity.Message, err error) {
+	IDs := make([]string, len(expired))
+	for i, message := range expired {
+		IDs[i] = message.ID
+	}
+
+	claimedIDs, err := a.repository.ClaimForArchive(ctx, IDs, time.Now().UTC().Add(a.config.Interval))
+	if err != nil {
+		return
+	}
+
+	isClaimed := make(map[string]bool, len(claimedIDs))
+	for _, ID := range claimedIDs {
+		isClaimed[ID] = true
+	}
+	for _, message := range expired {
+		if isClaimed[message.ID] {
+			claimed = append(claimed, message)
+		}
+	}
+
+	return
+}
+
+func (a *dlqArchiver) ReconcileExpiry(ctx context.Context) (updated int, err error) {
+	for skip := int64(0); ; skip += a.config.BatchSize {
+		bunchOfMessage, err := a.repository.FindMany(ctx, "", a.config.BatchSize, skip)
+		if err == repository.ErrNotFound {
+			return updated, nil
+		}
+		if err != nil {
+			return updated, err
+		}
+
+		for _, message := range bunchOfMessage {
+			expireAt, ok := a.expireAt(message)
+			if !ok || sameTime(expireAt, message.ExpireAt) {
+				continue
+			}
+
+			err = a.repository.UpdateExpireAt(ctx, message.ID, message.Status, expireAt)
+			if err == repository.ErrNotFound {
+				// The message is replayed or archived meanwhile.
+				continue
+			}
+			if err != nil {
+				return updated, err
+			}
+			updated++
+		}
+
+		if a.config.BatchSize < 1 || int64(len(bunchOfMessage)) < a.config.BatchSize {
+			return updated, nil
+		}
+	}
+}
+
+// expireAt returns the expiry of the message by the retention policy from the time it is ingested or replayed like the usecase does,
+// the archived messages and the messages without a known base are left out.
+func (a *dlqArchiver) expireAt(message entity.Message) (expireAt *time.Time, ok bool) {
+	if message.ArchivedAt != nil {
+		return
+	}
+
+	switch {
+	case message.Status == entity.MessageStatusNew:
+		expireAt = a.config.Retention.ExpireAt(message.Channel, message.Status, message.IngestedAt)
+	case message.Status == entity.MessageStatusReplayed && message.ReplayedAt != nil:
+		expireAt = a.config.Retention.ExpireAt(message.Channel, message.Status, *message.ReplayedAt)
+	default:
+		return
+	}
+
+	return expireAt, true
+}
+
+func sameTime(t, other *time.Time) bool {
+	if t == nil || other == nil {
+		return t == other
+	}
+
+	return t.Equal(*other)
+}
+
+// inlinePayloads puts the offloaded payloads in place of their references, the payloads are archived as they are stored.
+func (a *dlqArchiver) inlinePayloads(ctx context.Context, expired []entity.Message) (bunchOfMessage []entity.Message, err error) {
+	bunchOfMessage = make([]entity.Message, len(expired))
+	for i, message := range expired {
+		bunchOfMessage[i] = message
+		if message.MessageRef == "" {
+			continue
+		}
+		if a.config.Store == nil {
+			err = fmt.Errorf("payload of message %s is offloaded but the blob store is not configured", message.ID)
+			return
+		}
+
+		if bunchOfMessage[i].Message, err = a.config.Store.Get(ctx, message.MessageRef); err != nil {
+			err = fmt.Errorf("payload of message %s is failed to be fetched: %w", message.ID, err)
+			return
+		}
+		bunchOfMessage[i].MessageRef = ""
+	}
+
+	return
+}
+
+// removePayloads removes the offloaded payloads of the archived messages, the ones that are failed to be removed are only logged.
+func (a *dlqArchiver) removePayloads(ctx context.Context, archived []entity.Message) {
+	for _, message := range archived {
+		if message.MessageRef == "" {
+			continue
+		}
+		if err := a.config.Store.Delete(ctx, message.MessageRef); err != nil {
+			a.logger.Warnf("[DLQArchiver] Offloaded payload of message %s is failed to be removed | %s", message.ID, err.Error())
+		}
+	}
+}
+
+func writeArchive(filename string, bunchOfMessage []entity.Message) (err error) {
+	file, err := os.OpenFile(filename, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return
+	}
+	defer func() {
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+	}()
+
+	writer := gzip.NewWriter(file)
+	encoder := json.NewEncoder(writer)
+	for _, message := range bunchOfMessage {
+		if err = encoder.Encode(message); err != nil {
+			return
+		}
+	}
+	if err = writer.Close(); err != nil {
+		return
+	}
+
+	return file.Sync()
+}
@@ -0,0 +1,255 @@
+package usecase_test
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/blobstore"
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/entity"
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/model"
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/repository"
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/usecase"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+// readArchives returns the messages of the archives of the directory by their file.
+func readArchives(t *testing.T, dir string) (bunchOfMessageByFile map[string][]entity.Message) {
+	filenames, err := filepath.Glob(filepath.Join(dir, "dlq-archive-*.ndjson.gz"))
+	assert.NoError(t, err)
+
+	bunchOfMessageByFile = make(map[string][]entity.Message)
+	for _, filename := range filenames {
+		file, err := os.Open(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer file.Close()
+
+		reader, err := gzip.NewReader(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Every line is a message of its own.
+		scanner := bufio.NewScanner(reader)
+		for scanner.Scan() {
+			var message entity.Message
+			assert.NoError(t, json.Unmarshal(scanner.Bytes(), &message))
+			bunchOfMessageByFile[filename] = append(bunchOfMessageByFile[filename], message)
+		}
+		assert.NoError(t, scanner.Err())
+	}
+
+	return
+}
+
+func TestDLQArchiver_Archive(t *testing.T) {
+	ctx := context.TODO()
+	dir := t.TempDir()
+	dlqRepository := repository.NewMemoryDLQRepository()
+
+	now := time.Now().UTC()
+	for i, expireIn := range []time.Duration{-time.Hour, time.Hour, -time.Minute, 0} {
+		message := entity.Message{ID: string(rune('a' + i)), Channel: "orders", Message: []byte(`{"id":1}`)}
+		if expireIn != 0 {
+			expireAt := now.Add(expireIn)
+			message.ExpireAt = &expireAt
+		}
+		assert.NoError(t, dlqRepository.InsertOne(ctx, message))
+	}
+
+	archiver := usecase.NewDLQArchiver(logrus.New(), dlqRepository, &usecase.DLQArchiverConfig{
+		Dir:       dir,
+		Interval:  time.Minute,
+		BatchSize: 1,
+	})
+
+	archived, err := archiver.Archive(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, archived)
+
+	// Every batch is written to its own file, the oldest expired message first.
+	bunchOfMessageByFile := readArchives(t, dir)
+	assert.Len(t, bunchOfMessageByFile, 2)
+	for filename, bunchOfMessage := range bunchOfMessageByFile {
+		expectedID := "a"
+		if strings.HasSuffix(filename, "-1.ndjson.gz") {
+			expectedID = "c"
+		}
+		if assert.Len(t, bunchOfMessage, 1) {
+			assert.Equal(t, expectedID, bunchOfMessage[0].ID)
+			assert.Equal(t, []byte(`{"id":1}`), bunchOfMessage[0].Message)
+		}
+	}
+
+	for _, ID := range []string{"a", "c"} {
+		message, err := dlqRepository.FindByID(ctx, ID)
+		assert.NoError(t, err)
+		assert.NotNil(t, message.ArchivedAt)
+	}
+	for _, ID := range []string{"b", "d"} {
+		message, err := dlqRepository.FindByID(ctx, ID)
+		assert.NoError(t, err)
+		assert.Nil(t, message.ArchivedAt)
+	}
+
+	// The archived messages are not archived again.
+	archived, err = archiver.Archive(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, archived)
+	assert.Len(t, readArchives(t, dir), 2)
+}
+
+func TestDLQArchiver_Archive_OffloadedPayload(t *testing.T) {
+	ctx := context.TODO()
+	dir := t.TempDir()
+	store := blobstore.NewFileStore(t.TempDir())
+	dlqRepository := repository.NewMemoryDLQRepository()
+	retention, _ := usecase.ParseRetentionPolicy("")
+
+	dlqUsecase := usecase.NewDLQUsecase(logrus.New(), nil, dlqRepository, nil, retention, &usecase.PayloadOffloadConfig{
+		Store:     store,
+		Threshold: 1024,
+	}, nil)
+	large := bytes.Repeat([]byte("a"), 2048)
+	assert.True(t, dlqUsecase.Add(ctx, model.MessageParams{Channel: "orders", Message: large}).IsSuccess)
+
+	stored, err := dlqRepository.FindMany(ctx, "", 1, 0)
+	assert.NoError(t, err)
+	offloaded := stored[0]
+
+	archiver := usecase.NewDLQArchiver(logrus.New(), dlqRepository, &usecase.DLQArchiverConfig{
+		Dir:       dir,
+		Interval:  time.Minute,
+		BatchSize: 10,
+		Store:     store,
+	})
+
+	// The message is stored again as if its retention is over.
+	expireAt := time.Now().UTC().Add(-time.Second)
+	offloaded.ExpireAt = &expireAt
+	assert.NoError(t, dlqRepository.DeleteByID(ctx, offloaded.ID))
+	assert.NoError(t, dlqRepository.InsertOne(ctx, offloaded))
+
+	archived, err := archiver.Archive(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, archived)
+
+	// The archive holds the payload in place of its reference, the blob store does not.
+	for _, bunchOfMessage := range readArchives(t, dir) {
+		if assert.Len(t, bunchOfMessage, 1) {
+			assert.Equal(t, large, bunchOfMessage[0].Message)
+			assert.Empty(t, bunchOfMessage[0].MessageRef)
+			assert.Equal(t, offloaded.MessageChecksum, bunchOfMessage[0].MessageChecksum)
+		}
+	}
+	_, err = store.Get(ctx, offloaded.MessageRef)
+	assert.Equal(t, blobstore.ErrNotFound, err)
+
+	response := dlqUsecase.Get(ctx, offloaded.ID)
+	assert.False(t, response.IsSuccess)
+	assert.Equal(t, usecase.ErrPayloadArchived.Error(), response.Error)
+}
+
+func TestDLQArchiver_Archive_ClaimedByAnotherReplica(t *testing.T) {
+	ctx := context.TODO()
+	dir := t.TempDir()
+	dlqRepository := repository.NewMemoryDLQRepository()
+
+	expireAt := time.Now().UTC().Add(-time.Hour)
+	for _, ID := range []string{"a", "b"} {
+		assert.NoError(t, dlqRepository.InsertOne(ctx, entity.Message{ID: ID, Channel: "orders", ExpireAt: &expireAt}))
+	}
+
+	// Another replica is archiving the message.
+	claimedIDs, err := dlqRepository.ClaimForArchive(ctx, []string{"a"}, time.Now().UTC().Add(time.Minute))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a"}, claimedIDs)
+
+	archiver := usecase.NewDLQArchiver(logrus.New(), dlqRepository, &usecase.DLQArchiverConfig{
+		Dir:       dir,
+		Interval:  time.Minute,
+		BatchSize: 10,
+	})
+
+	archived, err := archiver.Archive(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, archived)
+
+	for _, bunchOfMessage := range readArchives(t, dir) {
+		if assert.Len(t, bunchOfMessage, 1) {
+			assert.Equal(t, "b", bunchOfMessage[0].ID)
+		}
+	}
+
+	message, err := dlqRepository.FindByID(ctx, "a")
+	assert.NoError(t, err)
+	assert.Nil(t, message.ArchivedAt)
+	message, err = dlqRepository.FindByID(ctx, "b")
+	assert.NoError(t, err)
+	assert.NotNil(t, message.ArchivedAt)
+	assert.Nil(t, message.ClaimedUntil)
+}
+
+func TestDLQArchiver_ReconcileExpiry(t *testing.T) {
+	ctx := context.TODO()
+	dlqRepository := repository.NewMemoryDLQRepository()
+
+	ingestedAt := time.Date(2021, 10, 1, 12, 0, 0, 0, time.UTC)
+	replayedAt := ingestedAt.Add(time.Hour)
+	storedExpireAt := ingestedAt.Add(720 * time.Hour)
+	messages := []entity.Message{
+		// Stored before any retention is configured.
+		{ID: "new", Channel: "orders", Status: entity.MessageStatusNew, IngestedAt: ingestedAt},
+		// Stored by the former retention of the new messages.
+		{ID: "new-expiring", Channel: "payments", Status: entity.MessageStatusNew, IngestedAt: ingestedAt, ExpireAt: &storedExpireAt},
+		{ID: "replayed", Channel: "orders", Status: entity.MessageStatusReplayed, IngestedAt: ingestedAt, ReplayedAt: &replayedAt},
+		{ID: "archived", Channel: "orders", Status: entity.MessageStatusNew, IngestedAt: ingestedAt, ArchivedAt: &replayedAt},
+	}
+	for _, message := range messages {
+		assert.NoError(t, dlqRepository.InsertOne(ctx, message))
+	}
+
+	retention, err := usecase.ParseRetentionPolicy("NEW=24h,REPLAYED=1h,payments:NEW=0s")
+	assert.NoError(t, err)
+	archiver := usecase.NewDLQArchiver(logrus.New(), dlqRepository, &usecase.DLQArchiverConfig{
+		Dir:       t.TempDir(),
+		Interval:  time.Minute,
+		BatchSize: 2,
+		Retention: retention,
+	})
+
+	updated, err := archiver.ReconcileExpiry(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, updated)
+
+	expected := map[string]*time.Time{
+		"new":          timeOf(ingestedAt.Add(24 * time.Hour)),
+		"new-expiring": nil,
+		"replayed":     timeOf(replayedAt.Add(time.Hour)),
+		"archived":     nil,
+	}
+	for ID, expireAt := range expected {
+		message, err := dlqRepository.FindByID(ctx, ID)
+		assert.NoError(t, err)
+		assert.Equal(t, expireAt, message.ExpireAt, ID)
+	}
+
+	// The reconciled expiry is not updated again.
+	updated, err = archiver.ReconcileExpiry(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, updated)
+}
+
+func timeOf(t time.Time) *time.Time {
+	return &t
+}
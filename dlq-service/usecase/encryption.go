@@ -0,0 +1,43 @@
+package usecase
+
+import (
+	"context"
+
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/auth"
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/encryption"
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/entity"
+)
+
+// readContext lets the reads of the caller with the decrypt permission return the messages decrypted.
+func readContext(ctx context.Context) context.Context {
+	if auth.HasPermission(ctx, auth.PermissionDecrypt) {
+		return encryption.WithDecryption(ctx)
+	}
+
+	return ctx
+}
+
+// readable reports whether the caller is allowed to read the payload and the header values of the message in plain.
+func readable(ctx context.Context, message entity.Message) bool {
+	return message.Encryption == nil || auth.HasPermission(ctx, auth.PermissionDecrypt)
+}
+
+// withhold leaves out the payload and the encrypted header values of the encrypted message,
+// the offloaded payload is not fetched, the blob store keeps it encrypted by the data key of the message.
+func withhold(message entity.Message) (withheld entity.Message) {
+	withheld = message
+	withheld.Message = nil
+
+	withheld.Headers = make(entity.MessageHeaders, len(message.Headers))
+	for i, header := range message.Headers {
+		withheld.Headers[i] = header
+		for _, key := range message.Encryption.Headers {
+			if header.Key == key {
+				withheld.Headers[i].Value = nil
+				break
+			}
+		}
+	}
+
+	return
+}
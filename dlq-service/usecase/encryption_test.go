@@ -0,0 +1,221 @@
+package usecase_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/auth"
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/blobstore"
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/encryption"
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/entity"
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/eventbus"
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/eventbus/mocks"
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/model"
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/repository"
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/usecase"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// newKeyProvider returns the provider of the keys of the key IDs, the first one is the primary key.
+func newKeyProvider(t *testing.T, keyIDs ...string) encryption.KeyProvider {
+	keysJSON := ""
+	for i, keyID := range keyIDs {
+		if i > 0 {
+			keysJSON += ","
+		}
+		// The key is derived from its ID, so that the providers share the keys of the same ID.
+		key := sha256.Sum256([]byte(keyID))
+		keysJSON += fmt.Sprintf("%q:%q", keyID, base64.StdEncoding.EncodeToString(key[:]))
+	}
+
+	path := filepath.Join(t.TempDir(), "keys.json")
+	assert.NoError(t, ioutil.WriteFile(path, []byte(fmt.Sprintf(`{"primaryKeyId":%q,"keys":{%s}}`, keyIDs[0], keysJSON)), 0600))
+
+	provider, err := encryption.NewFileKeyProvider(path)
+	assert.NoError(t, err)
+
+	return provider
+}
+
+func TestDLQUsecase_DecryptPermission(t *testing.T) {
+	ctx := context.TODO()
+	decryptCtx := auth.WithPermissions(ctx, []auth.Permission{auth.PermissionDecrypt})
+	dlqRepository := repository.NewEncryptedDLQRepository(logrus.New(), repository.NewMemoryDLQRepository(), &repository.EncryptionConfig{
+		Provider: newKeyProvider(t, "2021-11"),
+		Headers:  []string{"authorization"},
+	})
+
+	publisher := &mocks.Publisher{}
+	publisher.On("Send", mock.Anything, "order-created", "order-1", mock.MatchedBy(func(headers eventbus.MessageHeaders) bool {
+		return headers.Get("authorization") == "Bearer token"
+	}), []byte(`{"orderId":"order-1"}`)).Return(nil)
+
+	retention, _ := usecase.ParseRetentionPolicy("")
+	dlqUsecase := usecase.NewDLQUsecase(logrus.New(), publisher, dlqRepository, nil, retention, nil, nil)
+
+	response := dlqUsecase.Add(ctx, model.MessageParams{
+		Channel: "order-created",
+		Key:     []byte("order-1"),
+		Headers: model.MessageHeadersParams{
+			{Key: "authorization", Value: []byte("Bearer token")},
+			{Key: "content-type", Value: []byte("application/json")},
+		},
+		Message: []byte(`{"orderId":"order-1"}`),
+	})
+	assert.True(t, response.IsSuccess)
+
+	response = dlqUsecase.GetMany(ctx, "", 1, 10)
+	assert.True(t, response.IsSuccess)
+	listed := response.Data.([]model.Message)[0]
+	ID := listed.ID
+
+	// The caller without the decrypt permission gets neither the payload nor the encrypted header values,
+	// no caller gets the wrapped data key.
+	withheld := dlqUsecase.Get(ctx, ID).Data.(model.MessageDetail)
+	for _, message := range []model.Message{listed, {Message: withheld.Message, Encryption: withheld.Encryption}} {
+		assert.Empty(t, message.Message.Message)
+		assert.Empty(t, message.Headers[0].Value)
+		assert.Equal(t, []byte("application/json"), message.Headers[1].Value)
+		assert.Equal(t, &model.MessageEncryption{KeyID: "2021-11", Headers: []string{"authorization"}}, message.Encryption)
+	}
+
+	detail := dlqUsecase.Get(decryptCtx, ID).Data.(model.MessageDetail)
+	assert.Equal(t, []byte(`{"orderId":"order-1"}`), detail.Message.Message)
+	assert.Equal(t, []byte("Bearer token"), detail.Headers[0].Value)
+
+	// The message is replayed decrypted whatever the permissions of the caller are.
+	response = dlqUsecase.Republish(ctx, ID, model.RepublishParams{})
+	assert.True(t, response.IsSuccess)
+	assert.Empty(t, response.Data.(model.Message).Message.Message)
+	assert.Equal(t, "2021-11", response.Data.(model.Message).Encryption.KeyID)
+	publisher.AssertExpectations(t)
+}
+
+func TestKeyRotator_Rotate(t *testing.T) {
+	ctx := context.TODO()
+	stored := repository.NewMemoryDLQRepository()
+
+	oldProvider := newKeyProvider(t, "2021-10")
+	encrypted := repository.NewEncryptedDLQRepository(logrus.New(), stored, &repository.EncryptionConfig{Provider: oldProvider})
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, encrypted.InsertOne(ctx, entity.Message{ID: fmt.Sprintf("message-%d", i), Message: []byte("payload")}))
+	}
+
+	// The new key is the primary one, the old key is kept until the messages are rotated.
+	provider := newKeyProvider(t, "2021-11", "2021-10")
+	rotator := usecase.NewKeyRotator(logrus.New(), stored, provider, &usecase.KeyRotatorConfig{Interval: time.Hour, BatchSize: 2})
+
+	rotated, err := rotator.Rotate(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, rotated)
+
+	rotated, err = rotator.Rotate(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, rotated)
+
+	// The key provider of the old key only is not able to read them anymore.
+	decrypted := repository.NewEncryptedDLQRepository(logrus.New(), stored, &repository.EncryptionConfig{Provider: provider})
+	for i := 0; i < 3; i++ {
+		message, err := decrypted.FindByID(encryption.WithDecryption(ctx), fmt.Sprintf("message-%d", i))
+		assert.NoError(t, err)
+		assert.Equal(t, "2021-11", message.Encryption.KeyID)
+		assert.Equal(t, []byte("payload"), message.Message)
+
+		_, err = encrypted.FindByID(encryption.WithDecryption(ctx), fmt.Sprintf("message-%d", i))
+		assert.Error(t, err)
+	}
+}
+
+func TestKeyRotator_Rotate_UnknownKey(t *testing.T) {
+	ctx := context.TODO()
+	stored := repository.NewMemoryDLQRepository()
+	encrypted := repository.NewEncryptedDLQRepository(logrus.New(), stored, &repository.EncryptionConfig{Provider: newKeyProvider(t, "2021-09")})
+	assert.NoError(t, encrypted.InsertOne(ctx, entity.Message{ID: "message-1", Message: []byte("payload")}))
+
+	// The message of the removed key is left as it is instead of being retried forever.
+	rotator := usecase.NewKeyRotator(logrus.New(), stored, newKeyProvider(t, "2021-11"), &usecase.KeyRotatorConfig{Interval: time.Hour, BatchSize: 10})
+	rotated, err := rotator.Rotate(ctx)
+	assert.Equal(t, 0, rotated)
+	assert.Error(t, err)
+}
+
+func TestDLQUsecase_EncryptedPayloadOffload(t *testing.T) {
+	ctx := context.TODO()
+	decryptCtx := auth.WithPermissions(ctx, []auth.Permission{auth.PermissionDecrypt})
+	provider := newKeyProvider(t, "2021-11")
+	store := blobstore.NewFileStore(t.TempDir())
+	stored := repository.NewMemoryDLQRepository()
+	dlqRepository := repository.NewEncryptedDLQRepository(logrus.New(), stored, &repository.EncryptionConfig{
+		Provider: provider,
+		Headers:  []string{"authorization"},
+	})
+
+	large := bytes.Repeat([]byte(`{"card":"4111111111111111"}`), 100)
+	publisher := &mocks.Publisher{}
+	publisher.On("Send", mock.Anything, "order-created", "order-1", mock.MatchedBy(func(headers eventbus.MessageHeaders) bool {
+		return headers.Get("authorization") == "Bearer token"
+	}), large).Return(nil)
+
+	retention, _ := usecase.ParseRetentionPolicy("")
+	dlqUsecase := usecase.NewDLQUsecase(logrus.New(), publisher, dlqRepository, nil, retention, &usecase.PayloadOffloadConfig{
+		Store:     store,
+		Threshold: 1024,
+		Provider:  provider,
+	}, nil)
+
+	response := dlqUsecase.Add(ctx, model.MessageParams{
+		Channel: "order-created",
+		Key:     []byte("order-1"),
+		Headers: model.MessageHeadersParams{{Key: "authorization", Value: []byte("Bearer token")}},
+		Message: large,
+	})
+	assert.True(t, response.IsSuccess)
+
+	// The blob is encrypted by the data key of the message, which encrypts the header values as well.
+	bunchOfMessage, err := stored.FindMany(ctx, "", 10, 0)
+	assert.NoError(t, err)
+	message := bunchOfMessage[0]
+	assert.NotEmpty(t, message.MessageRef)
+	assert.Equal(t, []string{"authorization"}, message.Encryption.Headers)
+	assert.NotEqual(t, []byte("Bearer token"), message.Headers[0].Value)
+
+	blob, err := store.Get(ctx, message.MessageRef)
+	assert.NoError(t, err)
+	assert.False(t, bytes.Contains(blob, []byte("4111111111111111")))
+
+	// The checksum is the one of the encrypted blob, the one of the plain payload would tell a guessed payload apart.
+	assert.Equal(t, checksumOf(blob), message.MessageChecksum)
+	assert.NotEqual(t, checksumOf(large), message.MessageChecksum)
+
+	detail := dlqUsecase.Get(decryptCtx, message.ID).Data.(model.MessageDetail)
+	assert.Equal(t, large, detail.Message.Message)
+	assert.Equal(t, []byte("Bearer token"), detail.Headers[0].Value)
+
+	withheld := dlqUsecase.Get(ctx, message.ID).Data.(model.MessageDetail)
+	assert.Empty(t, withheld.Message.Message)
+
+	response = dlqUsecase.Republish(ctx, message.ID, model.RepublishParams{})
+	assert.True(t, response.IsSuccess)
+	publisher.AssertExpectations(t)
+
+	// The plain payload in place of the encrypted blob is not read.
+	assert.NoError(t, store.Put(ctx, message.MessageRef, large))
+	response = dlqUsecase.Get(decryptCtx, message.ID)
+	assert.False(t, response.IsSuccess)
+	assert.Equal(t, usecase.ErrPayloadChecksumMismatch.Error(), response.Error)
+}
+
+func checksumOf(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
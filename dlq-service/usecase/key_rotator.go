@@ -0,0 +1,106 @@
+package usecase
+
+import (
+	"context"
+	"time"
+
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/encryption"
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/entity"
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/repository"
+	"github.com/sirupsen/logrus"
+)
+
+// KeyRotatorConfig is a configuration of the key rotator.
+type KeyRotatorConfig struct {
+	Interval  time.Duration
+	BatchSize int64
+}
+
+// KeyRotator re-encrypts the data keys of the messages by the primary key of the key provider,
+// the old key can be removed from the provider once every message is rotated.
+type KeyRotator interface {
+	// Run rotates the keys every interval until the context is done.
+	Run(ctx context.Context)
+	Rotate(ctx context.Context) (rotated int, err error)
+}
+
+type keyRotator struct {
+	logger     *logrus.Logger
+	repository repository.DLQRepository
+	provider   encryption.KeyProvider
+	config     *KeyRotatorConfig
+}
+
+// NewKeyRotator is a constructor.
+func NewKeyRotator(logger *logrus.Logger, repository repository.DLQRepository, provider encryption.KeyProvider, config *KeyRotatorConfig) KeyRotator {
+	return &keyRotator{
+		logger:     logger,
+		repository: repository,
+		provider:   provider,
+		config:     config,
+	}
+}
+
+func (k *keyRotator) Run(ctx context.Context) {
+	ticker := time.NewTicker(k.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		rotated, err := k.Rotate(ctx)
+		if err != nil {
+			k.logger.Errorf("[KeyRotator] Keys are failed to be rotated | %s", err.Error())
+		} else if rotated > 0 {
+			k.logger.Infof("[KeyRotator] Keys of %d messages are rotated", rotated)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Rotate wraps the data keys again by the primary key, the encrypted payloads and header values are left as they are.
+// The messages that are failed to be rotated are retried by the next rotation, it stops once a whole batch is failed.
+func (k *keyRotator) Rotate(ctx context.Context) (rotated int, err error) {
+	primaryKeyID := k.provider.PrimaryKeyID()
+
+	for {
+		bunchOfMessage, err := k.repository.FindEncryptedWithOtherKey(ctx, primaryKeyID, k.config.BatchSize)
+		if err != nil || len(bunchOfMessage) < 1 {
+			return rotated, err
+		}
+
+		var rotatedInBatch int
+		for _, message := range bunchOfMessage {
+			if err = k.rotate(ctx, primaryKeyID, message); err != nil {
+				k.logger.Errorf("[KeyRotator] Key of message %s is failed to be rotated | %s", message.ID, err.Error())
+				continue
+			}
+			rotatedInBatch++
+		}
+
+		rotated += rotatedInBatch
+		if rotatedInBatch < 1 {
+			return rotated, err
+		}
+	}
+}
+
+func (k *keyRotator) rotate(ctx context.Context, primaryKeyID string, message entity.Message) (err error) {
+	dataKey, err := k.provider.UnwrapKey(ctx, message.Encryption.KeyID, message.Encryption.DataKey)
+	if err != nil {
+		return
+	}
+	wrapped, err := k.provider.WrapKey(ctx, primaryKeyID, dataKey)
+	if err != nil {
+		return
+	}
+
+	return k.repository.UpdateEncryption(ctx, message.ID, entity.MessageEncryption{
+		KeyID:   primaryKeyID,
+		DataKey: wrapped,
+		Headers: message.Encryption.Headers,
+	})
+}
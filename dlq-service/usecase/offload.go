@@ -0,0 +1,167 @@
+package usecase
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/blobstore"
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/encryption"
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/entity"
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/repository"
+)
+
+// PayloadOffloadConfig is a configuration of the offload of the large payloads to the blob store.
+type PayloadOffloadConfig struct {
+	Store blobstore.Store
+	// Threshold is the payload size in bytes from which the payloads are offloaded.
+	Threshold int
+	// Provider encrypts the offloaded payloads by the data key of their message, the data key is wrapped by its primary key
+	// like the encrypted repository does. It must be the provider of the repository, nil keeps the payloads in plain.
+	Provider encryption.KeyProvider
+}
+
+// ErrPayloadChecksumMismatch is returned when the offloaded payload is not the one that is stored.
+var ErrPayloadChecksumMismatch = errors.New("usecase: checksum of the offloaded payload does not match")
+
+// ErrPayloadArchived is returned when the offloaded payload of the archived message is removed from the blob store,
+// it is kept in the archive.
+var ErrPayloadArchived = errors.New("usecase: offloaded payload is archived")
+
+const (
+	payloadBlobPrefix        = "dlq-message/"
+	payloadChecksumAlgorithm = "sha256"
+)
+
+// offload puts the payload from the threshold to the blob store, the message keeps only its reference and checksum.
+// The checksum is the one of the stored blob so that the checksum of an encrypted payload tells nothing about its plain text.
+func (u *dlqUsecase) offload(ctx context.Context, dlqMessage entity.Message) (offloaded entity.Message, err error) {
+	offloaded = dlqMessage
+	if u.payloadOffload == nil || len(dlqMessage.Message) < u.payloadOffload.Threshold {
+		return
+	}
+
+	data := dlqMessage.Message
+	if u.payloadOffload.Provider != nil {
+		if data, offloaded.Encryption, err = u.sealPayload(ctx, dlqMessage.Message); err != nil {
+			err = fmt.Errorf("payload of message %s is failed to be encrypted: %w", dlqMessage.ID, err)
+			return
+		}
+	}
+
+	key := payloadBlobPrefix + dlqMessage.ID
+	if err = u.payloadOffload.Store.Put(ctx, key, data); err != nil {
+		err = fmt.Errorf("payload of message %s is failed to be offloaded: %w", dlqMessage.ID, err)
+		return
+	}
+
+	offloaded.Message = nil
+	offloaded.MessageRef = key
+	offloaded.MessageChecksum = payloadChecksum(data)
+	offloaded.MessageSize = int64(len(dlqMessage.Message))
+	offloaded.StoredMessageSize = 0
+
+	return
+}
+
+// loadPayload fetches the offloaded payload, the message that keeps its payload is returned as it is.
+func (u *dlqUsecase) loadPayload(ctx context.Context, dlqMessage entity.Message) (loaded entity.Message, err error) {
+	loaded = dlqMessage
+	if dlqMessage.MessageRef == "" {
+		return
+	}
+	if u.payloadOffload == nil {
+		err = fmt.Errorf("payload of message %s is offloaded but the blob store is not configured", dlqMessage.ID)
+		return
+	}
+
+	data, err := u.payloadOffload.Store.Get(ctx, dlqMessage.MessageRef)
+	if err == blobstore.ErrNotFound && dlqMessage.ArchivedAt != nil {
+		err = ErrPayloadArchived
+		return
+	}
+	if err != nil {
+		err = fmt.Errorf("payload of message %s is failed to be fetched: %w", dlqMessage.ID, err)
+		return
+	}
+	if payloadChecksum(data) != dlqMessage.MessageChecksum {
+		err = ErrPayloadChecksumMismatch
+		return
+	}
+	// The offloaded payload of an encrypted message is sealed by its data key since the provider is the one of the repository.
+	if dlqMessage.Encryption != nil {
+		if data, err = u.openPayload(ctx, dlqMessage, data); err != nil {
+			return
+		}
+	}
+
+	loaded.Message = data
+
+	return
+}
+
+// sealPayload encrypts the payload by a new data key, the envelope of the data key becomes the one of the message.
+func (u *dlqUsecase) sealPayload(ctx context.Context, payload []byte) (sealed []byte, envelope *entity.MessageEncryption, err error) {
+	dataKey, err := encryption.NewDataKey()
+	if err != nil {
+		return
+	}
+	keyID := u.payloadOffload.Provider.PrimaryKeyID()
+	wrapped, err := u.payloadOffload.Provider.WrapKey(ctx, keyID, dataKey)
+	if err != nil {
+		return
+	}
+	if sealed, err = encryption.Seal(dataKey, payload); err != nil {
+		return
+	}
+	envelope = &entity.MessageEncryption{KeyID: keyID, DataKey: wrapped}
+
+	return
+}
+
+// openPayload decrypts the offloaded payload by the data key of the message.
+func (u *dlqUsecase) openPayload(ctx context.Context, dlqMessage entity.Message, sealed []byte) (payload []byte, err error) {
+	if u.payloadOffload.Provider == nil {
+		err = fmt.Errorf("payload of message %s is encrypted but the key provider is not configured", dlqMessage.ID)
+		return
+	}
+
+	dataKey, err := u.payloadOffload.Provider.UnwrapKey(ctx, dlqMessage.Encryption.KeyID, dlqMessage.Encryption.DataKey)
+	if err != nil {
+		err = fmt.Errorf("payload of message %s is failed to be decrypted: %w", dlqMessage.ID, err)
+		return
+	}
+	if payload, err = encryption.Open(dataKey, sealed); err != nil {
+		err = fmt.Errorf("payload of message %s is failed to be decrypted: %w", dlqMessage.ID, err)
+		return
+	}
+
+	return
+}
+
+// discardPayload removes the offloaded payload of the message that is not written. The redelivered message is not
+// written either, the stored message of its DLQ coordinates is kept along with its own payload.
+func (u *dlqUsecase) discardPayload(ctx context.Context, dlqMessage entity.Message, written bool) {
+	if dlqMessage.MessageRef == "" {
+		return
+	}
+	if written {
+		if dlqMessage.DLQTopic == "" {
+			return
+		}
+		if _, err := u.repository.FindByID(ctx, dlqMessage.ID); err != repository.ErrNotFound {
+			return
+		}
+	}
+
+	if err := u.payloadOffload.Store.Delete(ctx, dlqMessage.MessageRef); err != nil {
+		u.logger.Warnf("[DLQUsecase] Offloaded payload of message %s is failed to be removed | %s", dlqMessage.ID, err.Error())
+	}
+}
+
+func payloadChecksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return payloadChecksumAlgorithm + ":" + hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,117 @@
+package usecase_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/blobstore"
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/entity"
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/model"
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/repository"
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/usecase"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDLQUsecase_PayloadOffload(t *testing.T) {
+	ctx := context.TODO()
+	dir := t.TempDir()
+	store := blobstore.NewFileStore(dir)
+	dlqRepository := repository.NewMemoryDLQRepository()
+	retention, _ := usecase.ParseRetentionPolicy("")
+
+	dlqUsecase := usecase.NewDLQUsecase(logrus.New(), nil, dlqRepository, nil, retention, &usecase.PayloadOffloadConfig{
+		Store:     store,
+		Threshold: 1024,
+	}, nil)
+
+	large := bytes.Repeat([]byte("a"), 2048)
+	failures := dlqUsecase.AddMany(ctx, []model.MessageParams{
+		{Channel: "order-created", Message: large, DLQTopic: "dead-letter-queue", DLQOffset: 1},
+		{Channel: "order-created", Message: []byte("small"), DLQTopic: "dead-letter-queue", DLQOffset: 2},
+	})
+	assert.Empty(t, failures)
+
+	bunchOfMessage, err := dlqRepository.FindMany(ctx, "", 10, 0)
+	assert.NoError(t, err)
+	offloaded, kept := bunchOfMessage[0], bunchOfMessage[1]
+
+	// The list keeps only the reference of the offloaded payload.
+	assert.Empty(t, offloaded.Message)
+	assert.Equal(t, "dlq-message/"+offloaded.ID, offloaded.MessageRef)
+	assert.NotEmpty(t, offloaded.MessageChecksum)
+	assert.Equal(t, int64(len(large)), offloaded.MessageSize)
+	assert.Equal(t, []byte("small"), kept.Message)
+	assert.Empty(t, kept.MessageRef)
+
+	response := dlqUsecase.Get(ctx, offloaded.ID)
+	assert.True(t, response.IsSuccess)
+	assert.Equal(t, large, response.Data.(model.MessageDetail).Message.Message)
+
+	// The payload that is changed in the blob store is not returned.
+	assert.NoError(t, store.Put(ctx, offloaded.MessageRef, []byte("tampered")))
+	response = dlqUsecase.Get(ctx, offloaded.ID)
+	assert.False(t, response.IsSuccess)
+	assert.Equal(t, usecase.ErrPayloadChecksumMismatch.Error(), response.Error)
+}
+
+// failingDLQRepository fails every write, like a database that is down.
+type failingDLQRepository struct {
+	repository.DLQRepository
+}
+
+func (r *failingDLQRepository) InsertOne(ctx context.Context, message entity.Message) (err error) {
+	return errors.New("server selection timeout")
+}
+
+func (r *failingDLQRepository) InsertMany(ctx context.Context, bunchOfMessage []entity.Message) (failures map[int]error, err error) {
+	err = errors.New("server selection timeout")
+	return
+}
+
+func TestDLQUsecase_PayloadOffload_DiscardsUnwrittenPayloads(t *testing.T) {
+	ctx := context.TODO()
+	large := bytes.Repeat([]byte("a"), 2048)
+	retention, _ := usecase.ParseRetentionPolicy("")
+
+	t.Run("failed write", func(t *testing.T) {
+		dir := t.TempDir()
+		dlqUsecase := usecase.NewDLQUsecase(logrus.New(), nil, &failingDLQRepository{DLQRepository: repository.NewMemoryDLQRepository()}, nil, retention,
+			&usecase.PayloadOffloadConfig{Store: blobstore.NewFileStore(dir), Threshold: 1024}, nil)
+
+		response := dlqUsecase.Add(ctx, model.MessageParams{Channel: "order-created", Message: large})
+		assert.False(t, response.IsSuccess)
+
+		failures := dlqUsecase.AddMany(ctx, []model.MessageParams{{Channel: "order-created", Message: large}})
+		assert.Len(t, failures, 1)
+
+		blobs, err := filepath.Glob(filepath.Join(dir, "dlq-message", "*"))
+		assert.NoError(t, err)
+		assert.Empty(t, blobs)
+	})
+
+	t.Run("redelivered message", func(t *testing.T) {
+		dir := t.TempDir()
+		dlqRepository := repository.NewMemoryDLQRepository()
+		dlqUsecase := usecase.NewDLQUsecase(logrus.New(), nil, dlqRepository, nil, retention,
+			&usecase.PayloadOffloadConfig{Store: blobstore.NewFileStore(dir), Threshold: 1024}, nil)
+
+		payload := model.MessageParams{Channel: "order-created", Message: large, DLQTopic: "dead-letter-queue", DLQOffset: 1}
+		assert.True(t, dlqUsecase.Add(ctx, payload).IsSuccess)
+		assert.True(t, dlqUsecase.Add(ctx, payload).IsSuccess)
+		assert.Empty(t, dlqUsecase.AddMany(ctx, []model.MessageParams{payload}))
+
+		// Only the payload of the stored message is kept.
+		stored, err := dlqRepository.FindMany(ctx, "", 10, 0)
+		assert.NoError(t, err)
+		assert.Len(t, stored, 1)
+
+		blobs, err := filepath.Glob(filepath.Join(dir, "dlq-message", "*"))
+		assert.NoError(t, err)
+		assert.Equal(t, []string{filepath.Join(dir, stored[0].MessageRef)}, blobs)
+		assert.Equal(t, large, dlqUsecase.Get(ctx, stored[0].ID).Data.(model.MessageDetail).Message.Message)
+	})
+}
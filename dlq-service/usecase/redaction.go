@@ -0,0 +1,26 @@
+package usecase
+
+import (
+	"context"
+
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/auth"
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/entity"
+)
+
+// revealed reports whether the caller reads the messages without their redaction.
+func (u *dlqUsecase) revealed(ctx context.Context) bool {
+	return u.redactor == nil || auth.HasPermission(ctx, auth.PermissionReveal)
+}
+
+// redact returns the message with its payload and its header values redacted, the stored message is left as it is.
+func (u *dlqUsecase) redact(message entity.Message) (redacted entity.Message) {
+	redacted = message
+	redacted.Message = u.redactor.Payload(message.Message)
+
+	redacted.Headers = make(entity.MessageHeaders, len(message.Headers))
+	for i, header := range message.Headers {
+		redacted.Headers[i] = entity.MessageHeader{Key: header.Key, Value: u.redactor.Header(header.Key, header.Value)}
+	}
+
+	return
+}
@@ -0,0 +1,62 @@
+package usecase_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/auth"
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/entity"
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/model"
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/redaction"
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/repository"
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/usecase"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDLQUsecase_Redaction(t *testing.T) {
+	ctx := context.TODO()
+	revealCtx := auth.WithPermissions(ctx, []auth.Permission{auth.PermissionReveal})
+	dlqRepository := repository.NewMemoryDLQRepository()
+
+	redactor, err := redaction.NewRedactor(redaction.Rules{
+		Fields:   []string{"$.customer.email"},
+		Headers:  []string{"authorization"},
+		Patterns: []string{`\b\d(?:[ -]?\d){12,15}\b`},
+	})
+	assert.NoError(t, err)
+
+	retention, _ := usecase.ParseRetentionPolicy("")
+	dlqUsecase := usecase.NewDLQUsecase(logrus.New(), nil, dlqRepository, nil, retention, nil, redactor)
+
+	payload := []byte(`{"orderId":"order-1","customer":{"email":"jane@example.com"},"card":"4111 1111 1111 1111"}`)
+	response := dlqUsecase.Add(ctx, model.MessageParams{
+		Channel: "order-created",
+		Headers: model.MessageHeadersParams{
+			{Key: "authorization", Value: []byte("Bearer token")},
+			{Key: "content-type", Value: []byte("application/json")},
+		},
+		Message: payload,
+	})
+	assert.True(t, response.IsSuccess)
+
+	response = dlqUsecase.GetMany(ctx, "", 1, 10)
+	assert.True(t, response.IsSuccess)
+	listed := response.Data.([]model.Message)[0]
+
+	for _, message := range []entity.Message{listed.Message, dlqUsecase.Get(ctx, listed.ID).Data.(model.MessageDetail).Message} {
+		assert.Equal(t, `{"card":"[REDACTED]","customer":{"email":"[REDACTED]"},"orderId":"order-1"}`, string(message.Message))
+		assert.Equal(t, entity.MessageHeaders{
+			{Key: "authorization", Value: []byte(redaction.Redacted)},
+			{Key: "content-type", Value: []byte("application/json")},
+		}, message.Headers)
+	}
+
+	// The caller with the reveal permission reads the raw message, the stored message is not redacted.
+	detail := dlqUsecase.Get(revealCtx, listed.ID).Data.(model.MessageDetail)
+	assert.Equal(t, payload, detail.Message.Message)
+	assert.Equal(t, []byte("Bearer token"), detail.Headers[0].Value)
+
+	revealed := dlqUsecase.GetMany(revealCtx, "", 1, 10).Data.([]model.Message)[0]
+	assert.Equal(t, payload, revealed.Message.Message)
+}
@@ -0,0 +1,88 @@
+package usecase
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// RetentionRule keeps the messages of the channel with the status for the retention,
+// the empty channel or status matches any and the zero retention keeps the messages forever.
+type RetentionRule struct {
+	Channel   string
+	Status    string
+	Retention time.Duration
+}
+
+// RetentionPolicy is the rules of the retention, the most specific rule of a message is applied.
+type RetentionPolicy []RetentionRule
+
+// ParseRetentionPolicy parses the comma separated rules of `[channel:]status=retention`, e.g. `REPLAYED=168h,orders:*=720h`.
+// The `*` matches any channel or status.
+func ParseRetentionPolicy(value string) (policy RetentionPolicy, err error) {
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		selector, duration := entry, ""
+		if i := strings.LastIndex(entry, "="); i >= 0 {
+			selector, duration = entry[:i], entry[i+1:]
+		}
+
+		var rule RetentionRule
+		if rule.Retention, err = time.ParseDuration(duration); err != nil {
+			err = fmt.Errorf("invalid retention rule %q: %w", entry, err)
+			return
+		}
+
+		rule.Status = selector
+		if i := strings.LastIndex(selector, ":"); i >= 0 {
+			rule.Channel, rule.Status = selector[:i], selector[i+1:]
+		}
+		if rule.Channel == "*" {
+			rule.Channel = ""
+		}
+		if rule.Status == "*" {
+			rule.Status = ""
+		}
+		rule.Status = strings.ToUpper(rule.Status)
+
+		policy = append(policy, rule)
+	}
+
+	return
+}
+
+// ExpireAt returns when the message of the channel with the status expires from the time, or nil when it is kept forever.
+func (p RetentionPolicy) ExpireAt(channel, status string, from time.Time) *time.Time {
+	var matched *RetentionRule
+	matchedScore := -1
+
+	for i, rule := range p {
+		if (rule.Channel != "" && rule.Channel != channel) || (rule.Status != "" && rule.Status != status) {
+			continue
+		}
+
+		// The channel is more specific than the status, which is more specific than the wildcard.
+		score := 0
+		if rule.Channel != "" {
+			score += 2
+		}
+		if rule.Status != "" {
+			score++
+		}
+		if score > matchedScore {
+			matched, matchedScore = &p[i], score
+		}
+	}
+
+	if matched == nil || matched.Retention <= 0 {
+		return nil
+	}
+
+	expireAt := from.Add(matched.Retention).UTC()
+
+	return &expireAt
+}
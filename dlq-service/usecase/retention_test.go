@@ -0,0 +1,140 @@
+package usecase_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/entity"
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/usecase"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRetentionPolicy(t *testing.T) {
+	testCases := []struct {
+		name     string
+		value    string
+		expected usecase.RetentionPolicy
+		isError  bool
+	}{
+		{
+			name:  "empty",
+			value: " ",
+		},
+		{
+			name:  "status rules",
+			value: "REPLAYED=168h, new=2160h",
+			expected: usecase.RetentionPolicy{
+				{Status: entity.MessageStatusReplayed, Retention: time.Hour * 168},
+				{Status: entity.MessageStatusNew, Retention: time.Hour * 2160},
+			},
+		},
+		{
+			name:  "channel and status rules with wildcards",
+			value: "orders:*=720h,*:REPLAYED=24h,*=0s",
+			expected: usecase.RetentionPolicy{
+				{Channel: "orders", Retention: time.Hour * 720},
+				{Status: entity.MessageStatusReplayed, Retention: time.Hour * 24},
+				{},
+			},
+		},
+		{
+			name:  "channel with a colon",
+			value: "orders:v2:NEW=1h",
+			expected: usecase.RetentionPolicy{
+				{Channel: "orders:v2", Status: entity.MessageStatusNew, Retention: time.Hour},
+			},
+		},
+		{
+			name:    "missing duration",
+			value:   "REPLAYED",
+			isError: true,
+		},
+		{
+			name:    "bad duration",
+			value:   "REPLAYED=7d",
+			isError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			policy, err := usecase.ParseRetentionPolicy(tc.value)
+
+			if tc.isError {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, policy)
+		})
+	}
+}
+
+func TestRetentionPolicy_ExpireAt(t *testing.T) {
+	from := time.Date(2021, 6, 30, 10, 0, 0, 0, time.FixedZone("WIB", 7*60*60))
+	policy, err := usecase.ParseRetentionPolicy("*=1h,REPLAYED=2h,orders:*=3h,orders:REPLAYED=4h,payments:*=0s")
+	assert.NoError(t, err)
+
+	testCases := []struct {
+		name     string
+		policy   usecase.RetentionPolicy
+		channel  string
+		status   string
+		expected time.Duration
+	}{
+		{
+			name:     "wildcard",
+			policy:   policy,
+			channel:  "users",
+			status:   entity.MessageStatusNew,
+			expected: time.Hour,
+		},
+		{
+			name:     "status is more specific than the wildcard",
+			policy:   policy,
+			channel:  "users",
+			status:   entity.MessageStatusReplayed,
+			expected: time.Hour * 2,
+		},
+		{
+			name:     "channel is more specific than the status",
+			policy:   policy,
+			channel:  "orders",
+			status:   entity.MessageStatusNew,
+			expected: time.Hour * 3,
+		},
+		{
+			name:     "channel and status is the most specific",
+			policy:   policy,
+			channel:  "orders",
+			status:   entity.MessageStatusReplayed,
+			expected: time.Hour * 4,
+		},
+		{
+			name:    "zero retention keeps the message forever",
+			policy:  policy,
+			channel: "payments",
+			status:  entity.MessageStatusReplayed,
+		},
+		{
+			name:    "no matching rule keeps the message forever",
+			policy:  usecase.RetentionPolicy{{Status: entity.MessageStatusReplayed, Retention: time.Hour}},
+			channel: "orders",
+			status:  entity.MessageStatusNew,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			expireAt := tc.policy.ExpireAt(tc.channel, tc.status, from)
+
+			if tc.expected == 0 {
+				assert.Nil(t, expireAt)
+				return
+			}
+			if assert.NotNil(t, expireAt) {
+				assert.Equal(t, from.Add(tc.expected).UTC(), *expireAt)
+			}
+		})
+	}
+}
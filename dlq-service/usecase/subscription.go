@@ -0,0 +1,194 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/entity"
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/eventbus"
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/model"
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/repository"
+	"github.com/sirupsen/logrus"
+)
+
+type SubscriptionUsecase interface {
+	Get(ctx context.Context) (response model.Response)
+	Add(ctx context.Context, payload model.SubscriptionParams) (response model.Response)
+	Remove(ctx context.Context, payload model.SubscriptionParams) (response model.Response)
+	Pause(ctx context.Context, payload model.PartitionParams) (response model.Response)
+	Resume(ctx context.Context, payload model.PartitionParams) (response model.Response)
+}
+
+type subscriptionUsecase struct {
+	// mu serializes the changes of the subscription set, they read the current topics before saving the new set.
+	mu             sync.Mutex
+	logger         *logrus.Logger
+	subscriptionID string
+	subscriber     eventbus.Subscriber
+	repository     repository.SubscriptionRepository
+}
+
+func NewSubscriptionUsecase(logger *logrus.Logger, subscriptionID string, subscriber eventbus.Subscriber, repository repository.SubscriptionRepository) SubscriptionUsecase {
+	return &subscriptionUsecase{
+		logger:         logger,
+		subscriptionID: subscriptionID,
+		subscriber:     subscriber,
+		repository:     repository,
+	}
+}
+
+func (u *subscriptionUsecase) Get(ctx context.Context) (response model.Response) {
+	response.IsSuccess = true
+	response.Status = model.StatusOK
+	response.Data = entity.Subscription{
+		ID:     u.subscriptionID,
+		Topics: u.subscriber.Topics(),
+	}
+
+	return
+}
+
+func (u *subscriptionUsecase) Add(ctx context.Context, payload model.SubscriptionParams) (response model.Response) {
+	if err := validateSubscription(payload); err != nil {
+		response.Status = model.StatusBadRequestError
+		response.Error = err.Error()
+
+		return
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	topics := u.subscriber.Topics()
+	subscribed := make(map[string]bool)
+	for _, topic := range topics {
+		subscribed[topic] = true
+	}
+
+	for _, topic := range payload.Topics {
+		if subscribed[topic] {
+			continue
+		}
+		subscribed[topic] = true
+		topics = append(topics, topic)
+	}
+
+	subscription, err := u.save(ctx, topics)
+	if err != nil {
+		response.Status = model.StatusInternalServerError
+		response.Error = err.Error()
+
+		return
+	}
+
+	u.subscriber.AddTopics(payload.Topics...)
+
+	response.IsSuccess = true
+	response.Status = model.StatusOK
+	response.Data = subscription
+
+	return
+}
+
+func (u *subscriptionUsecase) Remove(ctx context.Context, payload model.SubscriptionParams) (response model.Response) {
+	if err := validateSubscription(payload); err != nil {
+		response.Status = model.StatusBadRequestError
+		response.Error = err.Error()
+
+		return
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	removed := make(map[string]bool)
+	for _, topic := range payload.Topics {
+		removed[topic] = true
+	}
+
+	topics := make([]string, 0)
+	for _, topic := range u.subscriber.Topics() {
+		if !removed[topic] {
+			topics = append(topics, topic)
+		}
+	}
+
+	subscription, err := u.save(ctx, topics)
+	if err != nil {
+		response.Status = model.StatusInternalServerError
+		response.Error = err.Error()
+
+		return
+	}
+
+	u.subscriber.RemoveTopics(payload.Topics...)
+
+	response.IsSuccess = true
+	response.Status = model.StatusOK
+	response.Data = subscription
+
+	return
+}
+
+func (u *subscriptionUsecase) Pause(ctx context.Context, payload model.PartitionParams) (response model.Response) {
+	if payload.Topic == "" || len(payload.Partitions) < 1 {
+		response.Status = model.StatusBadRequestError
+		response.Error = "topic and partitions are required"
+
+		return
+	}
+
+	u.subscriber.Pause(payload.Topic, payload.Partitions)
+
+	response.IsSuccess = true
+	response.Status = model.StatusOK
+	response.Data = payload
+
+	return
+}
+
+func (u *subscriptionUsecase) Resume(ctx context.Context, payload model.PartitionParams) (response model.Response) {
+	if payload.Topic == "" || len(payload.Partitions) < 1 {
+		response.Status = model.StatusBadRequestError
+		response.Error = "topic and partitions are required"
+
+		return
+	}
+
+	u.subscriber.Resume(payload.Topic, payload.Partitions)
+
+	response.IsSuccess = true
+	response.Status = model.StatusOK
+	response.Data = payload
+
+	return
+}
+
+func validateSubscription(payload model.SubscriptionParams) (err error) {
+	if len(payload.Topics) < 1 {
+		err = errors.New("topics are required")
+		return
+	}
+
+	for _, topic := range payload.Topics {
+		if strings.TrimSpace(topic) == "" {
+			err = errors.New("topics must not be empty")
+			return
+		}
+	}
+
+	return
+}
+
+func (u *subscriptionUsecase) save(ctx context.Context, topics []string) (subscription entity.Subscription, err error) {
+	subscription.ID = u.subscriptionID
+	subscription.Topics = topics
+	subscription.UpdatedAt = time.Now().UTC().Format(time.RFC3339Nano)
+
+	err = u.repository.Upsert(ctx, subscription)
+
+	return
+}
@@ -0,0 +1,129 @@
+package usecase_test
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/entity"
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/model"
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/usecase"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeSubscriber struct {
+	mu     sync.Mutex
+	topics []string
+}
+
+func (s *fakeSubscriber) Subscribe()                              {}
+func (s *fakeSubscriber) Pause(topic string, partitions []int32)  {}
+func (s *fakeSubscriber) Resume(topic string, partitions []int32) {}
+func (s *fakeSubscriber) Close() (err error)                      { return }
+
+func (s *fakeSubscriber) Topics() (topics []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append(topics, s.topics...)
+}
+
+func (s *fakeSubscriber) AddTopics(topics ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.topics = append(s.topics, topics...)
+}
+
+func (s *fakeSubscriber) RemoveTopics(topics ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	kept := make([]string, 0)
+	for _, topic := range s.topics {
+		removed := false
+		for _, t := range topics {
+			removed = removed || t == topic
+		}
+		if !removed {
+			kept = append(kept, topic)
+		}
+	}
+	s.topics = kept
+}
+
+type fakeSubscriptionRepository struct {
+	mu           sync.Mutex
+	subscription entity.Subscription
+}
+
+func (r *fakeSubscriptionRepository) FindByID(ctx context.Context, ID string) (subscription entity.Subscription, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.subscription, nil
+}
+
+func (r *fakeSubscriptionRepository) Upsert(ctx context.Context, subscription entity.Subscription) (err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.subscription = subscription
+
+	return
+}
+
+func TestSubscriptionUsecase_Add_Concurrent(t *testing.T) {
+	subscriber := &fakeSubscriber{}
+	subscriptionRepository := &fakeSubscriptionRepository{}
+	u := usecase.NewSubscriptionUsecase(logrus.New(), "dlq-service", subscriber, subscriptionRepository)
+
+	expected := make([]string, 0)
+	wg := sync.WaitGroup{}
+	for i := 0; i < 20; i++ {
+		topic := fmt.Sprintf("topic-%02d", i)
+		expected = append(expected, topic)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			u.Add(context.TODO(), model.SubscriptionParams{Topics: []string{topic}})
+		}()
+	}
+	wg.Wait()
+
+	saved, _ := subscriptionRepository.FindByID(context.TODO(), "dlq-service")
+	sort.Strings(saved.Topics)
+
+	assert.Equal(t, expected, saved.Topics)
+}
+
+func TestSubscriptionUsecase_InvalidPayload(t *testing.T) {
+	testCases := []struct {
+		name    string
+		payload model.SubscriptionParams
+	}{
+		{name: "missing topics", payload: model.SubscriptionParams{}},
+		{name: "empty topics", payload: model.SubscriptionParams{Topics: []string{}}},
+		{name: "blank topic", payload: model.SubscriptionParams{Topics: []string{"orders", " "}}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			subscriber := &fakeSubscriber{topics: []string{"orders"}}
+			subscriptionRepository := &fakeSubscriptionRepository{}
+			u := usecase.NewSubscriptionUsecase(logrus.New(), "dlq-service", subscriber, subscriptionRepository)
+
+			added := u.Add(context.TODO(), tc.payload)
+			removed := u.Remove(context.TODO(), tc.payload)
+
+			assert.Equal(t, model.StatusBadRequestError, added.Status)
+			assert.Equal(t, model.StatusBadRequestError, removed.Status)
+			assert.Equal(t, []string{"orders"}, subscriber.Topics())
+			assert.Empty(t, subscriptionRepository.subscription.Topics)
+		})
+	}
+}
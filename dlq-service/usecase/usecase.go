@@ -2,15 +2,21 @@ package usecase
 
 import (
 	"context"
+	"fmt"
 	"math"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/encryption"
 	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/entity"
 	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/eventbus"
 	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/model"
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/redaction"
 	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/repository"
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/schemaregistry"
 	"github.com/sirupsen/logrus"
-	"go.mongodb.org/mongo-driver/mongo"
 	"golang.org/x/sync/errgroup"
 )
 
@@ -23,29 +29,107 @@ type meta struct {
 
 type DLQUsecase interface {
 	Add(ctx context.Context, payload model.MessageParams) (response model.Response)
-	GetMany(ctx context.Context, page, size int64) (response model.Response)
-	Republish(ctx context.Context, ID string) (response model.Response)
+	AddMany(ctx context.Context, bunchOfPayload []model.MessageParams) (failures map[int]error)
+	// GetMany lists the messages with the status, the new messages that are not replayed yet are listed when it is empty.
+	GetMany(ctx context.Context, status string, page, size int64) (response model.Response)
+	Get(ctx context.Context, ID string) (response model.Response)
+	Republish(ctx context.Context, ID string, payload model.RepublishParams) (response model.Response)
+	// Stats shows the storage that is saved by the compression of the message payloads.
+	Stats(ctx context.Context) (response model.Response)
 }
 
 type dlqUsecase struct {
 	logger     *logrus.Logger
 	publisher  eventbus.Publisher
 	repository repository.DLQRepository
+	serde      schemaregistry.Serde
+	retention  RetentionPolicy
+	// payloadOffload is nil when the payloads are kept in the database whatever their size is.
+	payloadOffload *PayloadOffloadConfig
+	// redactor is nil when the messages are returned without their redaction.
+	redactor redaction.Redactor
 }
 
-func NewDLQUsecase(logger *logrus.Logger, repository repository.DLQRepository) DLQUsecase {
+// NewDLQUsecase is a constructor, the serde is optional and it is used to decode and to re-encode the schema registry payloads.
+// The retention decides when the new and the replayed messages expire, the optional payload offload keeps the large payloads
+// in the blob store which are fetched by the detail and the replay only. The optional redactor redacts the messages that are returned
+// to the callers without the reveal permission.
+func NewDLQUsecase(logger *logrus.Logger, publisher eventbus.Publisher, repository repository.DLQRepository, serde schemaregistry.Serde, retention RetentionPolicy, payloadOffload *PayloadOffloadConfig, redactor redaction.Redactor) DLQUsecase {
 	return &dlqUsecase{
-		logger:     logger,
-		repository: repository,
+		logger:         logger,
+		publisher:      publisher,
+		repository:     repository,
+		serde:          serde,
+		retention:      retention,
+		payloadOffload: payloadOffload,
+		redactor:       redactor,
 	}
 }
 
 func (u *dlqUsecase) Add(ctx context.Context, payload model.MessageParams) (response model.Response) {
-	dlqMessage := entity.Message{}
+	dlqMessage, err := u.offload(ctx, u.newMessage(payload))
+	if err != nil {
+		response.Status = model.StatusInternalServerError
+		response.Error = err.Error()
+
+		return
+	}
+
+	err = u.repository.InsertOne(ctx, dlqMessage)
+	u.discardPayload(ctx, dlqMessage, err == nil)
+	if err != nil {
+		response.Status = model.StatusInternalServerError
+		response.Error = err.Error()
+
+		return
+	}
+
+	response.IsSuccess = true
+	response.Status = model.StatusCreated
+
+	return
+}
+
+// AddMany returns the error of the payloads that are failed to be stored by their index.
+func (u *dlqUsecase) AddMany(ctx context.Context, bunchOfPayload []model.MessageParams) (failures map[int]error) {
+	failures = make(map[int]error)
+
+	// The payloads that are failed to be offloaded are failures, the rest are written in bulk by their index in the payloads.
+	bunchOfMessage := make([]entity.Message, 0, len(bunchOfPayload))
+	indexes := make([]int, 0, len(bunchOfPayload))
+	for i, payload := range bunchOfPayload {
+		dlqMessage, err := u.offload(ctx, u.newMessage(payload))
+		if err != nil {
+			failures[i] = err
+			continue
+		}
+
+		bunchOfMessage = append(bunchOfMessage, dlqMessage)
+		indexes = append(indexes, i)
+	}
+
+	insertFailures, err := u.repository.InsertMany(ctx, bunchOfMessage)
+	for i, dlqMessage := range bunchOfMessage {
+		u.discardPayload(ctx, dlqMessage, err == nil && insertFailures[i] == nil)
+	}
+	if err != nil {
+		for _, i := range indexes {
+			failures[i] = err
+		}
+
+		return
+	}
+	for i, err := range insertFailures {
+		failures[indexes[i]] = err
+	}
+
+	return
+}
 
-	headers := entity.MessageHeaders{}
-	for hk, hv := range payload.Headers {
-		headers[hk] = hv
+func (u *dlqUsecase) newMessage(payload model.MessageParams) (dlqMessage entity.Message) {
+	headers := make(entity.MessageHeaders, 0, len(payload.Headers))
+	for _, header := range payload.Headers {
+		headers = append(headers, entity.MessageHeader{Key: header.Key, Value: header.Value})
 	}
 
 	dlqMessage.ID = uuid.New().String()
@@ -55,29 +139,47 @@ func (u *dlqUsecase) Add(ctx context.Context, payload model.MessageParams) (resp
 	dlqMessage.Publisher = payload.Publisher
 	dlqMessage.Headers = headers
 	dlqMessage.Message = payload.Message
+	dlqMessage.ContentType = payload.ContentType
+	dlqMessage.SchemaVersion = payload.SchemaVersion
 	dlqMessage.CausedBy = payload.CausedBy
+	dlqMessage.StackTrace = payload.StackTrace
 	dlqMessage.FailedConsumeDate = payload.FailedConsumeDate
-
-	if err := u.repository.InsertOne(ctx, dlqMessage); err != nil {
-		response.Status = model.StatusInternalServerError
-		response.Error = err.Error()
-
-		return
-	}
-
-	response.IsSuccess = true
-	response.Status = model.StatusCreated
+	dlqMessage.Partition = payload.Partition
+	dlqMessage.Offset = payload.Offset
+	dlqMessage.ProducedDate = payload.ProducedDate
+	dlqMessage.ConsumerGroup = payload.ConsumerGroup
+	dlqMessage.InstanceID = payload.InstanceID
+	dlqMessage.Attempt = payload.Attempt
+	dlqMessage.DLQTopic = payload.DLQTopic
+	dlqMessage.DLQPartition = payload.DLQPartition
+	dlqMessage.DLQOffset = payload.DLQOffset
+	dlqMessage.DLQKey = payload.DLQKey
+	dlqMessage.IngestedAt = time.Now().UTC()
+	dlqMessage.UpdatedAt = dlqMessage.IngestedAt
+	dlqMessage.Status = entity.MessageStatusNew
+	dlqMessage.ExpireAt = u.retention.ExpireAt(payload.Channel, entity.MessageStatusNew, dlqMessage.IngestedAt)
 
 	return
 }
 
-func (u *dlqUsecase) GetMany(ctx context.Context, page, size int64) (response model.Response) {
+func (u *dlqUsecase) GetMany(ctx context.Context, status string, page, size int64) (response model.Response) {
 	skip := (page - 1) * size
 	limit := size
 
-	bunchOfMessage, totalCounted, err := u.getMany(ctx, limit, skip)
+	switch status = strings.ToUpper(status); status {
+	case "":
+		status = entity.MessageStatusNew
+	case entity.MessageStatusNew, entity.MessageStatusReplayed:
+	default:
+		response.Status = model.StatusBadRequestError
+		response.Error = fmt.Sprintf("unknown status %q", status)
+
+		return
+	}
+
+	bunchOfMessage, totalCounted, err := u.getMany(readContext(ctx), status, limit, skip)
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
+		if err == repository.ErrNotFound {
 			response.Status = model.StatusNotFoundError
 			response.Error = err.Error()
 
@@ -90,6 +192,16 @@ func (u *dlqUsecase) GetMany(ctx context.Context, page, size int64) (response mo
 		return
 	}
 
+	for i, message := range bunchOfMessage {
+		if !readable(ctx, message) {
+			message = withhold(message)
+		}
+		if !u.revealed(ctx) {
+			message = u.redact(message)
+		}
+		bunchOfMessage[i] = message
+	}
+
 	lengthOfMessages := len(bunchOfMessage)
 
 	response.Meta = meta{
@@ -101,16 +213,18 @@ func (u *dlqUsecase) GetMany(ctx context.Context, page, size int64) (response mo
 
 	response.IsSuccess = true
 	response.Status = model.StatusOK
-	response.Data = bunchOfMessage
+	response.Data = model.NewMessages(bunchOfMessage)
 
 	return
 }
 
-func (u *dlqUsecase) Republish(ctx context.Context, ID string) (response model.Response) {
-	dlqMessage, err := u.repository.FindByID(ctx, ID)
+// Get returns the encrypted message without its payload and its encrypted header values unless the caller has the decrypt permission,
+// the message is redacted unless the caller has the reveal permission.
+func (u *dlqUsecase) Get(ctx context.Context, ID string) (response model.Response) {
+	dlqMessage, err := u.repository.FindByID(readContext(ctx), ID)
 
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
+		if err == repository.ErrNotFound {
 			response.Status = model.StatusNotFoundError
 			response.Error = err.Error()
 
@@ -123,59 +237,200 @@ func (u *dlqUsecase) Republish(ctx context.Context, ID string) (response model.R
 		return
 	}
 
-	headers := eventbus.MessageHeaders{}
-	for hk, hv := range dlqMessage.Headers {
-		headers.Add(hk, hv)
+	if !readable(ctx, dlqMessage) {
+		dlqMessage = withhold(dlqMessage)
+	} else if dlqMessage, err = u.loadPayload(ctx, dlqMessage); err != nil {
+		response.Status = model.StatusInternalServerError
+		response.Error = err.Error()
+
+		return
 	}
 
-	u.publisher.Send(ctx, dlqMessage.Channel, dlqMessage.ID, headers, []byte(dlqMessage.Message))
+	detail := model.MessageDetail{Message: dlqMessage, Encryption: model.NewMessageEncryption(dlqMessage.Encryption)}
 
-	if err := u.repository.DeleteByID(ctx, ID); err != nil {
+	if u.serde != nil && schemaregistry.IsWireFormat(dlqMessage.Message) {
+		// The message is still returned as it is stored when it can not be decoded.
+		decoded, err := u.serde.Decode(ctx, dlqMessage.Message)
+		if err != nil {
+			u.logger.Warnf("[DLQUsecase] Message %s is failed to be decoded | %s", ID, err.Error())
+			detail.DecodingError = err.Error()
+		} else {
+			detail.SchemaID = decoded.SchemaID
+			detail.SchemaType = decoded.SchemaType
+			detail.DecodedMessage = decoded.Message
+		}
+	}
+
+	if !u.revealed(ctx) {
+		detail.Message = u.redact(detail.Message)
+		detail.DecodedMessage = u.redactor.Payload(detail.DecodedMessage)
+	}
+
+	response.IsSuccess = true
+	response.Status = model.StatusOK
+	response.Data = detail
+
+	return
+}
+
+func (u *dlqUsecase) Stats(ctx context.Context) (response model.Response) {
+	stats, err := u.repository.StorageStats(ctx)
+	if err != nil {
 		response.Status = model.StatusInternalServerError
 		response.Error = err.Error()
 
 		return
 	}
 
+	response.IsSuccess = true
 	response.Status = model.StatusOK
-	response.Data = dlqMessage
+	response.Data = stats
 
 	return
 }
 
-func (u *dlqUsecase) getMany(ctx context.Context, limit, skip int64) (bunchOfDLQMessage []entity.Message, totalCounted int64, err error) {
-	resultAggregation := make(map[string]interface{})
+// replayClaimTTL is how long a replay holds the message, the claim is taken over once the replica dies during the replay.
+const replayClaimTTL = time.Minute
 
-	g, ctx := errgroup.WithContext(ctx)
+// Republish sends the message decrypted whatever the permissions of the caller are, the encrypted message is returned
+// without its payload and its encrypted header values unless the caller has the decrypt permission and redacted unless the caller
+// has the reveal permission.
+func (u *dlqUsecase) Republish(ctx context.Context, ID string, payload model.RepublishParams) (response model.Response) {
+	dlqMessage, err := u.repository.ClaimForReplay(encryption.WithDecryption(ctx), ID, time.Now().UTC().Add(replayClaimTTL))
 
-	g.Go(func() error {
-		counted, err := u.repository.CountDocuments(ctx)
-		if err != nil {
-			return err
+	if err != nil {
+		if err == repository.ErrNotFound {
+			response.Status = model.StatusNotFoundError
+			response.Error = err.Error()
+
+			return
+		}
+
+		if err == repository.ErrClaimed || err == repository.ErrReplayed {
+			response.Status = model.StatusConflictError
+			response.Error = err.Error()
+
+			return
 		}
 
-		resultAggregation["counted"] = counted
+		response.Status = model.StatusInternalServerError
+		response.Error = err.Error()
 
-		return nil
-	})
+		return
+	}
 
-	g.Go(func() error {
-		bunchOfDLQMessage, err := u.repository.FindMany(ctx, limit, skip)
+	if dlqMessage, err = u.loadPayload(ctx, dlqMessage); err != nil {
+		u.releaseClaim(ctx, ID)
+		response.Status = model.StatusInternalServerError
+		response.Error = err.Error()
+
+		return
+	}
+
+	if len(payload.Message) > 0 {
+		message, err := u.editedMessage(ctx, dlqMessage.Message, payload.Message)
 		if err != nil {
-			return err
+			u.releaseClaim(ctx, ID)
+			response.Status = model.StatusBadRequestError
+			response.Error = err.Error()
+
+			return
 		}
 
-		resultAggregation["bunchOfDLQMessage"] = bunchOfDLQMessage
+		dlqMessage.Message = message
+	}
+
+	headers := make(eventbus.MessageHeaders, 0, len(dlqMessage.Headers)+1)
+	for _, header := range dlqMessage.Headers {
+		headers.AddBytes(header.Key, header.Value)
+	}
+	headers.Set(eventbus.AttemptHeader, strconv.Itoa(dlqMessage.Attempt))
+
+	// The key and the message are sent as the bytes they were consumed with.
+	if err := u.publisher.Send(ctx, dlqMessage.Channel, string(dlqMessage.Key), headers, dlqMessage.Message); err != nil {
+		u.releaseClaim(ctx, ID)
+		response.Status = model.StatusInternalServerError
+		response.Error = err.Error()
 
-		return nil
+		return
+	}
+
+	// The replayed message is kept until it expires by the retention of the replayed messages.
+	replayedAt := time.Now().UTC()
+	expireAt := u.retention.ExpireAt(dlqMessage.Channel, entity.MessageStatusReplayed, replayedAt)
+	if err := u.repository.MarkReplayed(ctx, ID, replayedAt, expireAt); err != nil {
+		response.Status = model.StatusInternalServerError
+		response.Error = err.Error()
+
+		return
+	}
+
+	dlqMessage.Status = entity.MessageStatusReplayed
+	dlqMessage.ReplayedAt = &replayedAt
+	dlqMessage.UpdatedAt = replayedAt
+	dlqMessage.ExpireAt = expireAt
+	dlqMessage.ClaimedUntil = nil
+	if !readable(ctx, dlqMessage) {
+		dlqMessage = withhold(dlqMessage)
+	}
+	if !u.revealed(ctx) {
+		dlqMessage = u.redact(dlqMessage)
+	}
+
+	response.IsSuccess = true
+	response.Status = model.StatusOK
+	response.Data = model.NewMessage(dlqMessage)
+
+	return
+}
+
+// releaseClaim lets the message be replayed again right away when the replay fails before it is sent.
+func (u *dlqUsecase) releaseClaim(ctx context.Context, ID string) {
+	if err := u.repository.ReleaseClaim(ctx, ID); err != nil {
+		u.logger.Error(err)
+	}
+}
+
+// editedMessage re-encodes the edited message with the schema of the stored one,
+// the edited message of a payload which is not serialized by the schema registry is sent as it is.
+func (u *dlqUsecase) editedMessage(ctx context.Context, original []byte, edited []byte) (message []byte, err error) {
+	if !schemaregistry.IsWireFormat(original) {
+		message = edited
+		return
+	}
+
+	if u.serde == nil {
+		err = schemaregistry.ErrUnsupportedSchemaType
+		return
+	}
+
+	return u.serde.Encode(ctx, original, edited)
+}
+
+func (u *dlqUsecase) getMany(ctx context.Context, status string, limit, skip int64) (bunchOfDLQMessage []entity.Message, totalCounted int64, err error) {
+	var (
+		counted int64
+		found   []entity.Message
+	)
+
+	g, ctx := errgroup.WithContext(ctx)
+
+	g.Go(func() (err error) {
+		counted, err = u.repository.CountDocuments(ctx, status)
+		return
+	})
+
+	g.Go(func() (err error) {
+		found, err = u.repository.FindMany(ctx, status, limit, skip)
+		return
 	})
 
 	if err = g.Wait(); err != nil {
 		return
 	}
 
-	totalCounted = resultAggregation["counted"].(int64)
-	bunchOfDLQMessage = resultAggregation["bunchOfDLQMessage"].([]entity.Message)
+	totalCounted = counted
+	bunchOfDLQMessage = found
 
 	return
 }
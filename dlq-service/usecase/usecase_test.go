@@ -0,0 +1,52 @@
+package usecase_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/eventbus/mocks"
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/model"
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/repository"
+	"github.com/sangianpatrick/go-kafka-dlq-demo/dlq-service/usecase"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestDLQUsecase_Republish_ListsReplayedSeparately(t *testing.T) {
+	ctx := context.TODO()
+
+	publisher := &mocks.Publisher{}
+	publisher.On("Send", mock.Anything, "order-created", mock.Anything, mock.Anything, mock.Anything).Return(nil).Once()
+
+	retention, _ := usecase.ParseRetentionPolicy("")
+	dlqUsecase := usecase.NewDLQUsecase(logrus.New(), publisher, repository.NewMemoryDLQRepository(), nil, retention, nil, nil)
+
+	for _, key := range []string{"order-1", "order-2"} {
+		response := dlqUsecase.Add(ctx, model.MessageParams{Channel: "order-created", Key: []byte(key), Message: []byte(`{}`)})
+		assert.True(t, response.IsSuccess)
+	}
+
+	pending := dlqUsecase.GetMany(ctx, "", 1, 10).Data.([]model.Message)
+	ID := pending[0].ID
+
+	response := dlqUsecase.Republish(ctx, ID, model.RepublishParams{})
+	assert.True(t, response.IsSuccess)
+
+	// The replayed message is not pending anymore, it is listed by its status.
+	response = dlqUsecase.GetMany(ctx, "", 1, 10)
+	assert.True(t, response.IsSuccess)
+	assert.Len(t, response.Data, 1)
+
+	response = dlqUsecase.GetMany(ctx, "replayed", 1, 10)
+	assert.True(t, response.IsSuccess)
+	assert.Equal(t, ID, response.Data.([]model.Message)[0].ID)
+
+	// The replayed message is not sent again.
+	response = dlqUsecase.Republish(ctx, ID, model.RepublishParams{})
+	assert.Equal(t, model.StatusConflictError, response.Status)
+	publisher.AssertExpectations(t)
+
+	response = dlqUsecase.GetMany(ctx, "archived", 1, 10)
+	assert.Equal(t, model.StatusBadRequestError, response.Status)
+}